@@ -0,0 +1,75 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// HubDataAnnotation holds the v1beta1 representation of an object on its v1alpha1 representation,
+	// so fields that v1alpha1 can not express survive a round-trip through a v1alpha1 client
+	HubDataAnnotation = "hugo-hoster.cedi.dev/v1beta1-data"
+
+	// SpokeDataAnnotation holds the v1alpha1 representation of an object on its v1beta1 representation,
+	// so v1alpha1 objects are restored exactly as they were written
+	SpokeDataAnnotation = "hugo-hoster.cedi.dev/v1alpha1-data"
+)
+
+// marshalData stores data as JSON in the annotation key of obj
+func marshalData(obj metav1.Object, key string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal conversion data into annotation %s", key)
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[key] = string(raw)
+	obj.SetAnnotations(annotations)
+
+	return nil
+}
+
+// unmarshalData restores data from the annotation key of obj and removes the annotation.
+// It reports whether the annotation was present.
+func unmarshalData(obj metav1.Object, key string, data any) (bool, error) {
+	annotations := obj.GetAnnotations()
+
+	raw, ok := annotations[key]
+	if !ok {
+		return false, nil
+	}
+
+	delete(annotations, key)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+
+	if err := json.Unmarshal([]byte(raw), data); err != nil {
+		return false, errors.Wrapf(err, "Failed to unmarshal conversion data from annotation %s", key)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/cedi/hugo-hoster/api/v1beta1"
+	"github.com/google/go-cmp/cmp"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/randfill"
+)
+
+const fuzzIterations = 1000
+
+// fuzzSeed makes the fuzzed objects reproducible, pass -fuzz-seed to explore other objects
+var fuzzSeed = flag.Int64("fuzz-seed", 1, "seed of the random objects the conversions are tested with")
+
+func newFiller(t *testing.T) *randfill.Filler {
+	t.Logf("Filling objects with seed %d, reproduce with -fuzz-seed=%d", *fuzzSeed, *fuzzSeed)
+
+	return randfill.NewWithSeed(*fuzzSeed).NilChance(0.3).NumElements(0, 3).Funcs(
+		func(in *metav1.TypeMeta, c randfill.Continue) {},
+		func(in *metav1.ObjectMeta, c randfill.Continue) {
+			in.Name = c.String(0)
+			in.Namespace = c.String(0)
+			c.Fill(&in.Labels)
+			c.Fill(&in.Annotations)
+		},
+		// Quantities are serialized in their canonical form
+		func(in *resource.Quantity, c randfill.Continue) {
+			*in = *resource.NewQuantity(int64(c.Uint32()), resource.DecimalSI)
+		},
+		// Timestamps are serialized with second precision
+		func(in *metav1.Time, c randfill.Continue) {
+			*in = metav1.Unix(int64(c.Uint64()%(1<<33)), 0).Rfc3339Copy()
+		},
+	)
+}
+
+// roundTrip converts spoke to the hub and back, and fails if anything got lost on the way
+func roundTrip(t *testing.T, spoke conversion.Convertible, hub conversion.Hub, result conversion.Convertible) {
+	t.Helper()
+
+	original := spoke.DeepCopyObject()
+
+	if err := spoke.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+
+	if err := result.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom failed: %v", err)
+	}
+
+	deleteAnnotation(result.(metav1.Object), HubDataAnnotation)
+
+	if !equality.Semantic.DeepEqual(original, result) {
+		t.Fatalf("round-trip through %T is lossy (-want +got):\n%s", hub, cmp.Diff(original, result))
+	}
+}
+
+// roundTripHub converts hub to the spoke and back, and fails if anything got lost on the way
+func roundTripHub(t *testing.T, hub conversion.Hub, spoke conversion.Convertible, result conversion.Hub) {
+	t.Helper()
+
+	original := hub.DeepCopyObject()
+
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom failed: %v", err)
+	}
+
+	if err := spoke.ConvertTo(result); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+
+	deleteAnnotation(result.(metav1.Object), SpokeDataAnnotation)
+
+	if !equality.Semantic.DeepEqual(original, result) {
+		t.Fatalf("round-trip through %T is lossy (-want +got):\n%s", spoke, cmp.Diff(original, result))
+	}
+}
+
+func deleteAnnotation(obj metav1.Object, key string) {
+	annotations := obj.GetAnnotations()
+	delete(annotations, key)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
+
+func TestHugoPageRoundTrip(t *testing.T) {
+	filler := newFiller(t)
+
+	for i := 0; i < fuzzIterations; i++ {
+		page := &HugoPage{}
+		filler.Fill(page)
+		roundTrip(t, page, &v1beta1.HugoPage{}, &HugoPage{})
+	}
+}
+
+func TestHugoPageHubRoundTrip(t *testing.T) {
+	filler := newFiller(t)
+
+	for i := 0; i < fuzzIterations; i++ {
+		page := &v1beta1.HugoPage{}
+		filler.Fill(page)
+		roundTripHub(t, page, &HugoPage{}, &v1beta1.HugoPage{})
+	}
+}
+
+func TestSettingRoundTrip(t *testing.T) {
+	filler := newFiller(t)
+
+	for i := 0; i < fuzzIterations; i++ {
+		setting := &Setting{}
+		filler.Fill(setting)
+		roundTrip(t, setting, &v1beta1.Setting{}, &Setting{})
+	}
+}
+
+func TestSettingHubRoundTrip(t *testing.T) {
+	filler := newFiller(t)
+
+	for i := 0; i < fuzzIterations; i++ {
+		setting := &v1beta1.Setting{}
+		filler.Fill(setting)
+		roundTripHub(t, setting, &Setting{}, &v1beta1.Setting{})
+	}
+}
+
+// TestHugoPageHubEditedInSpoke makes sure edits made through v1alpha1 are applied
+// without dropping the fields only v1beta1 knows about
+func TestHugoPageHubEditedInSpoke(t *testing.T) {
+	filler := newFiller(t)
+
+	for i := 0; i < fuzzIterations; i++ {
+		original := &v1beta1.HugoPage{}
+		filler.Fill(original)
+
+		spoke := &HugoPage{}
+		if err := spoke.ConvertFrom(original); err != nil {
+			t.Fatalf("ConvertFrom failed: %v", err)
+		}
+
+		spoke.Spec.Branch = original.Spec.Source.Branch + "-edited"
+
+		result := &v1beta1.HugoPage{}
+		if err := spoke.ConvertTo(result); err != nil {
+			t.Fatalf("ConvertTo failed: %v", err)
+		}
+
+		if result.Spec.Source.Branch != spoke.Spec.Branch {
+			t.Fatalf("edit got lost: want branch %q, got %q", spoke.Spec.Branch, result.Spec.Source.Branch)
+		}
+
+		if !equality.Semantic.DeepEqual(original.Spec.Serve, result.Spec.Serve) {
+			t.Fatalf("v1beta1 only fields got lost (-want +got):\n%s", cmp.Diff(original.Spec.Serve, result.Spec.Serve))
+		}
+
+		if !equality.Semantic.DeepEqual(original.Status.Conditions, result.Status.Conditions) {
+			t.Fatalf("v1beta1 only fields got lost (-want +got):\n%s", cmp.Diff(original.Status.Conditions, result.Status.Conditions))
+		}
+	}
+}
+
+func TestHugoPageConvertTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *PageOptionsSpec
+		want    v1beta1.BuildSpec
+	}{
+		{
+			name:    "no options",
+			options: nil,
+			want:    v1beta1.BuildSpec{},
+		},
+		{
+			name:    "custom command",
+			options: &PageOptionsSpec{BuildCommand: "hugo --minify"},
+			want:    v1beta1.BuildSpec{Command: "hugo --minify"},
+		},
+		{
+			name:    "tag only",
+			options: &PageOptionsSpec{BuildImageOptions: &BuildImageOptions{Tag: ptr("v1.2.3")}},
+			want:    v1beta1.BuildSpec{Image: "ghcr.io/SpechtLabs/page_builder:v1.2.3"},
+		},
+		{
+			name:    "image only",
+			options: &PageOptionsSpec{BuildImageOptions: &BuildImageOptions{Image: ptr("registry:5000/builder")}},
+			want:    v1beta1.BuildSpec{Image: "registry:5000/builder:main"},
+		},
+		{
+			name: "image, tag and pull policy",
+			options: &PageOptionsSpec{BuildImageOptions: &BuildImageOptions{
+				Image:           ptr("registry:5000/builder"),
+				Tag:             ptr("v1"),
+				ImagePullPolicy: ptr(apiv1.PullAlways),
+			}},
+			want: v1beta1.BuildSpec{Image: "registry:5000/builder:v1", ImagePullPolicy: apiv1.PullAlways},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &HugoPage{
+				Spec: HugoPageSpec{
+					Repository:   "https://github.com/cedi/cedi.github.io.git",
+					Branch:       "main",
+					URL:          "cedi.dev",
+					BuildType:    "cron",
+					CronInterval: "*/5 * * * *",
+					Options:      tt.options,
+				},
+				Status: HugoPageStatus{
+					LastBuild: "2023-03-01T12:00:00Z",
+					Commit:    "0123abc",
+					Status:    "Success",
+				},
+			}
+
+			hub := &v1beta1.HugoPage{}
+			if err := page.ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo failed: %v", err)
+			}
+
+			tt.want.Trigger = v1beta1.BuildTriggerCron
+			tt.want.Schedule = "*/5 * * * *"
+
+			if diff := cmp.Diff(tt.want, hub.Spec.Build); diff != "" {
+				t.Errorf("unexpected build spec (-want +got):\n%s", diff)
+			}
+
+			if hub.Spec.Source.Repository != page.Spec.Repository || hub.Spec.Source.Branch != page.Spec.Branch || hub.Spec.Routing.Host != page.Spec.URL {
+				t.Errorf("unexpected source or routing spec: %+v %+v", hub.Spec.Source, hub.Spec.Routing)
+			}
+
+			wantTime := metav1.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+			if hub.Status.LastBuild.CompletionTime == nil || !hub.Status.LastBuild.CompletionTime.Equal(&wantTime) {
+				t.Errorf("unexpected completion time %v", hub.Status.LastBuild.CompletionTime)
+			}
+
+			if hub.Status.LastBuild.Result != v1beta1.BuildResultSuccess || hub.Status.LastBuild.Commit != "0123abc" {
+				t.Errorf("unexpected build status %+v", hub.Status.LastBuild)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cedi/hugo-hoster/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// hugoPageData is the part of a HugoPage that is carried in the conversion annotations
+type hugoPageData struct {
+	Spec   HugoPageSpec   `json:"spec"`
+	Status HugoPageStatus `json:"status"`
+}
+
+// hugoPageHubData is the part of a v1beta1 HugoPage that is carried in the conversion annotations
+type hugoPageHubData struct {
+	Spec   v1beta1.HugoPageSpec   `json:"spec"`
+	Status v1beta1.HugoPageStatus `json:"status"`
+}
+
+// ConvertTo converts this HugoPage to the Hub version (v1beta1)
+func (src *HugoPage) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.HugoPage)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = v1beta1.HugoPageSpec{}
+	dst.Status = v1beta1.HugoPageStatus{}
+
+	restored := &hugoPageHubData{}
+	ok, err := unmarshalData(dst, HubDataAnnotation, restored)
+	if err != nil {
+		return err
+	}
+
+	// Start from the v1beta1 object this one was converted from, so fields
+	// unknown to v1alpha1 are kept. Fields known to v1alpha1 are only taken
+	// from src if a v1alpha1 client actually changed them.
+	if ok {
+		dst.Spec = restored.Spec
+		dst.Status = restored.Status
+	}
+
+	restoredSpec := HugoPageSpec{}
+	convertHugoPageSpecFromHub(&restored.Spec, &restoredSpec)
+	if !ok || !equality.Semantic.DeepEqual(restoredSpec, src.Spec) {
+		convertHugoPageSpecToHub(&src.Spec, &dst.Spec)
+	}
+
+	restoredStatus := HugoPageStatus{}
+	convertHugoPageStatusFromHub(&restored.Status, &restoredStatus)
+	if !ok || !equality.Semantic.DeepEqual(restoredStatus, src.Status) {
+		convertHugoPageStatusToHub(&src.Status, &dst.Status)
+	}
+
+	return marshalData(dst, SpokeDataAnnotation, &hugoPageData{Spec: src.Spec, Status: src.Status})
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version
+func (dst *HugoPage) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.HugoPage)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = HugoPageSpec{}
+	dst.Status = HugoPageStatus{}
+
+	restored := &hugoPageData{}
+	ok, err := unmarshalData(dst, SpokeDataAnnotation, restored)
+	if err != nil {
+		return err
+	}
+
+	convertHugoPageSpecFromHub(&src.Spec, &dst.Spec)
+	convertHugoPageStatusFromHub(&src.Status, &dst.Status)
+
+	// Prefer the original v1alpha1 representation as long as it still
+	// describes the same v1beta1 object, as the v1alpha1 fields can not be
+	// derived from v1beta1 without losing pointers and unparsable timestamps
+	if ok {
+		restoredSpec := src.Spec.DeepCopy()
+		convertHugoPageSpecToHub(&restored.Spec, restoredSpec)
+		if equality.Semantic.DeepEqual(*restoredSpec, src.Spec) {
+			dst.Spec = restored.Spec
+		}
+
+		restoredStatus := src.Status.DeepCopy()
+		convertHugoPageStatusToHub(&restored.Status, restoredStatus)
+		if equality.Semantic.DeepEqual(*restoredStatus, src.Status) {
+			dst.Status = restored.Status
+		}
+	}
+
+	return marshalData(dst, HubDataAnnotation, &hugoPageHubData{Spec: src.Spec, Status: src.Status})
+}
+
+// convertHugoPageSpecToHub sets all fields of out that have a v1alpha1 counterpart in.
+// Fields that only exist in v1beta1 are left untouched.
+func convertHugoPageSpecToHub(in *HugoPageSpec, out *v1beta1.HugoPageSpec) {
+	out.Source.Repository = in.Repository
+	out.Source.Branch = in.Branch
+	out.Routing.Host = in.URL
+	out.Build.Trigger = v1beta1.BuildTrigger(in.BuildType)
+	out.Build.Schedule = in.CronInterval
+
+	out.Build.Command = ""
+	out.Build.Image = ""
+	out.Build.ImagePullPolicy = ""
+
+	if in.Options == nil {
+		return
+	}
+
+	out.Build.Command = in.Options.BuildCommand
+
+	if in.Options.BuildImageOptions == nil {
+		return
+	}
+
+	out.Build.Image = joinImage(in.Options.BuildImageOptions.Image, in.Options.BuildImageOptions.Tag)
+	if in.Options.BuildImageOptions.ImagePullPolicy != nil {
+		out.Build.ImagePullPolicy = *in.Options.BuildImageOptions.ImagePullPolicy
+	}
+}
+
+// convertHugoPageSpecFromHub sets all fields of out from their v1beta1 counterpart in
+func convertHugoPageSpecFromHub(in *v1beta1.HugoPageSpec, out *HugoPageSpec) {
+	out.Repository = in.Source.Repository
+	out.Branch = in.Source.Branch
+	out.URL = in.Routing.Host
+	out.BuildType = string(in.Build.Trigger)
+	out.CronInterval = in.Build.Schedule
+	out.Options = nil
+
+	if in.Build.Command == "" && in.Build.Image == "" && in.Build.ImagePullPolicy == "" {
+		return
+	}
+
+	out.Options = &PageOptionsSpec{
+		BuildCommand: in.Build.Command,
+	}
+
+	if in.Build.Image == "" && in.Build.ImagePullPolicy == "" {
+		return
+	}
+
+	out.Options.BuildImageOptions = &BuildImageOptions{}
+
+	if in.Build.Image != "" {
+		image, tag := splitImage(in.Build.Image)
+		out.Options.BuildImageOptions.Image = &image
+
+		// v1alpha1 defaults an empty tag to "main", so an untagged v1beta1
+		// image has to be pinned to the tag a container runtime would pick
+		if tag == "" && !strings.Contains(image, "@") {
+			tag = "latest"
+		}
+
+		if tag != "" {
+			out.Options.BuildImageOptions.Tag = &tag
+		}
+	}
+
+	if in.Build.ImagePullPolicy != "" {
+		pullPolicy := in.Build.ImagePullPolicy
+		out.Options.BuildImageOptions.ImagePullPolicy = &pullPolicy
+	}
+}
+
+func convertHugoPageStatusToHub(in *HugoPageStatus, out *v1beta1.HugoPageStatus) {
+	out.LastBuild.Commit = in.Commit
+	out.LastBuild.Result = v1beta1.BuildResult(in.Status)
+	out.LastBuild.CompletionTime = nil
+
+	if lastBuild, err := time.Parse(time.RFC3339, in.LastBuild); err == nil {
+		completionTime := metav1.NewTime(lastBuild)
+		out.LastBuild.CompletionTime = &completionTime
+	}
+}
+
+func convertHugoPageStatusFromHub(in *v1beta1.HugoPageStatus, out *HugoPageStatus) {
+	out.Commit = in.LastBuild.Commit
+	out.Status = string(in.LastBuild.Result)
+	out.LastBuild = ""
+
+	if in.LastBuild.CompletionTime != nil {
+		out.LastBuild = in.LastBuild.CompletionTime.UTC().Format(time.RFC3339)
+	}
+}
+
+// joinImage merges the v1alpha1 image and tag into one image reference,
+// defaulting them the same way the v1alpha1 controller did
+func joinImage(image, tag *string) string {
+	if image == nil && tag == nil {
+		return ""
+	}
+
+	defaultImage, defaultTag := splitImage(v1beta1.DefaultBuilderImage)
+
+	if image != nil {
+		defaultImage = *image
+	}
+
+	if tag != nil {
+		defaultTag = *tag
+	}
+
+	return defaultImage + ":" + defaultTag
+}
+
+// splitImage splits an image reference into the image name and its tag.
+// References by digest are returned as a whole with an empty tag.
+func splitImage(ref string) (string, string) {
+	if strings.Contains(ref, "@") {
+		return ref, ""
+	}
+
+	idx := strings.LastIndex(ref, ":")
+	if idx < 0 || idx < strings.LastIndex(ref, "/") {
+		return ref, ""
+	}
+
+	return ref[:idx], ref[idx+1:]
+}
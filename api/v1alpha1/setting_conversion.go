@@ -0,0 +1,88 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/cedi/hugo-hoster/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// settingHubData is the part of a v1beta1 Setting that is carried in the conversion annotation
+type settingHubData struct {
+	Spec   v1beta1.SettingSpec   `json:"spec"`
+	Status v1beta1.SettingStatus `json:"status"`
+}
+
+// ConvertTo converts this Setting to the Hub version (v1beta1)
+func (src *Setting) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Setting)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = v1beta1.SettingSpec{}
+	dst.Status = v1beta1.SettingStatus{}
+
+	// Every v1alpha1 field maps 1:1 to a v1beta1 field, so only the
+	// fields unknown to v1alpha1 have to be restored
+	restored := &settingHubData{}
+	ok, err := unmarshalData(dst, HubDataAnnotation, restored)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		dst.Spec = restored.Spec
+		dst.Status = restored.Status
+	}
+
+	dst.Spec.Storage.S3.Endpoint = src.Spec.S3Config.Endpoint
+	dst.Spec.Storage.S3.Bucket = src.Spec.S3Config.BucketName
+	dst.Spec.Storage.S3.CredentialsSecret.Name = src.Spec.S3Config.SecretName
+	dst.Spec.Storage.S3.CredentialsSecret.AccessKeyIDKey = src.Spec.S3Config.AccessKeyIDRef
+	dst.Spec.Storage.S3.CredentialsSecret.SecretAccessKeyKey = src.Spec.S3Config.AccessKeyRef
+	dst.Spec.Storage.ServingURL = src.Spec.ProxyURL
+	dst.Spec.Routing.IngressClassName = src.Spec.IngressClassName
+	dst.Spec.Routing.TLS.Enabled = src.Spec.TLS.Enable
+	dst.Spec.Routing.TLS.Annotations = src.Spec.TLS.DeepCopy().Annotations
+	dst.Spec.Serve.Replicas = src.Spec.NginxProxyReplica
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version
+func (dst *Setting) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Setting)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	dst.Spec = SettingSpec{
+		TLS: TLSSpec{
+			Enable:      src.Spec.Routing.TLS.Enabled,
+			Annotations: src.Spec.Routing.TLS.DeepCopy().Annotations,
+		},
+		IngressClassName: src.Spec.Routing.IngressClassName,
+		S3Config: S3Config{
+			Endpoint:       src.Spec.Storage.S3.Endpoint,
+			BucketName:     src.Spec.Storage.S3.Bucket,
+			SecretName:     src.Spec.Storage.S3.CredentialsSecret.Name,
+			AccessKeyIDRef: src.Spec.Storage.S3.CredentialsSecret.AccessKeyIDKey,
+			AccessKeyRef:   src.Spec.Storage.S3.CredentialsSecret.SecretAccessKeyKey,
+		},
+		ProxyURL:          src.Spec.Storage.ServingURL,
+		NginxProxyReplica: src.Spec.Serve.Replicas,
+	}
+	dst.Status = SettingStatus{}
+
+	return marshalData(dst, HubDataAnnotation, &settingHubData{Spec: src.Spec, Status: src.Status})
+}
@@ -35,7 +35,7 @@ type SettingSpec struct {
 	S3Config S3Config `json:"s3_config"`
 
 	// ProxyURL is the URL from which the static files are served. Most of the time this is the same as `spec.S3Config.Endpoint``. If this is empty, `spec.S3Config.Endpoint` is used
-	// +kubebuilder:example:=https://f003.backblazeb2.com/file
+	// +kubebuilder:example:="https://f003.backblazeb2.com/file"
 	ProxyURL string `json:"serving_url,omitempty"`
 
 	// NginxProxyReplica is the number of replicas for each page
@@ -47,7 +47,7 @@ type SettingSpec struct {
 type S3Config struct {
 	// S3Endpoint is the Endpoint URL for the S3 Bucket to upload pages to
 	// +kubebuilder:validation:Required
-	// +kubebuilder:example:=https://s3.eu-central-003.backblazeb2.com
+	// +kubebuilder:example:="https://s3.eu-central-003.backblazeb2.com"
 	Endpoint string `json:"endpoint"`
 
 	// BucketName is the S3 Bucket to which all sites are uploaded
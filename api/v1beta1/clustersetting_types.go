@@ -0,0 +1,76 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"path"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterSettingSpec defines the desired state of ClusterSetting
+type ClusterSettingSpec struct {
+	SettingSpec `json:",inline"`
+
+	// AllowedNamespaces lists the namespaces whose HugoPages may use the ClusterSetting, by name or by a
+	// pattern like team-*. "*" allows every namespace. Every Hugo Page in an allowed namespace receives a copy of the
+	// S3 credentials in the Secret <page>-s3-credentials, which anyone who can read Secrets in its namespace can read
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+// AllowsNamespace reports whether the HugoPages of namespace may use the ClusterSetting
+func (s *ClusterSettingSpec) AllowsNamespace(namespace string) bool {
+	for _, pattern := range s.AllowedNamespaces {
+		if matched, err := path.Match(pattern, namespace); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="TlsEnabled",type=string,JSONPath=`.spec.routing.tls.enabled`
+// +kubebuilder:printcolumn:name="S3Endpoint",type=string,JSONPath=`.spec.storage.s3.endpoint`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Pages",type=integer,JSONPath=`.status.pages`
+
+// ClusterSetting is the cluster-scoped counterpart of Setting.
+// It configures every HugoPage of its allowed namespaces that has no Setting of its own.
+type ClusterSetting struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterSettingSpec `json:"spec,omitempty"`
+	Status SettingStatus      `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterSettingList contains a list of ClusterSetting
+type ClusterSettingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSetting `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterSetting{}, &ClusterSettingList{})
+}
@@ -0,0 +1,643 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultBuilderImage is the image used to build a Hugo Page if spec.build.image is empty
+	DefaultBuilderImage = "ghcr.io/SpechtLabs/page_builder:main"
+
+	// PausedAnnotation stops the reconciliation and the builds of a Hugo Page while set to "true"
+	PausedAnnotation = "hugo-hoster.cedi.dev/paused"
+
+	// WipeCacheAnnotation wipes the build cache of a Hugo Page whenever it is set to a new value
+	WipeCacheAnnotation = "hugo-hoster.cedi.dev/wipe-cache"
+
+	// TriggerBuildAnnotation queues a build of a Hugo Page whenever it is set to a new value.
+	// Triggered builds are started before scheduled ones
+	TriggerBuildAnnotation = "hugo-hoster.cedi.dev/trigger-build"
+
+	// TraceParentAnnotation is set on builder Jobs to the W3C traceparent of the trace of their build
+	TraceParentAnnotation = "hugo-hoster.cedi.dev/traceparent"
+
+	// HugoPageConditionServing reports whether the Hugo Page passes its probe
+	HugoPageConditionServing = "Serving"
+
+	// HugoPageConditionCacheRecreationPending is true while the build cache waits for a running build to be recreated
+	HugoPageConditionCacheRecreationPending = "CacheRecreationPending"
+
+	// PreviewOfLabel is set on the preview Hugo Pages of a pull request to the name of the Hugo Page they preview
+	PreviewOfLabel = "hugo-hoster.cedi.dev/preview-of"
+
+	// EnvironmentOfLabel is set on the Hugo Pages of environments to the name of the Hugo Page defining them
+	EnvironmentOfLabel = "hugo-hoster.cedi.dev/environment-of"
+
+	// CommitStatusRepositoryAnnotation is set on the preview Hugo Pages of a pull request to the repository
+	// the commit statuses of their builds are reported to, as the pull request may come from a fork
+	CommitStatusRepositoryAnnotation = "hugo-hoster.cedi.dev/commit-status-repository"
+
+	// ForkPreviewAnnotation is set to "true" on the preview Hugo Pages of pull requests from forks.
+	// They are built with the forkPreviewCredentialsSecret of their Setting
+	ForkPreviewAnnotation = "hugo-hoster.cedi.dev/fork-preview"
+)
+
+// BuildTrigger configures what causes a Hugo Page to be rebuilt
+// +kubebuilder:validation:Enum=cron
+type BuildTrigger string
+
+const (
+	// BuildTriggerCron rebuilds the page periodically according to the build schedule
+	BuildTriggerCron BuildTrigger = "cron"
+)
+
+// BuildResult is the outcome of a single build of a Hugo Page
+// +kubebuilder:validation:Enum=Failed;Success;Cancelled
+type BuildResult string
+
+const (
+	BuildResultFailed    BuildResult = "Failed"
+	BuildResultSuccess   BuildResult = "Success"
+	BuildResultCancelled BuildResult = "Cancelled"
+)
+
+// SourceSpec configures where the content of a Hugo Page is pulled from
+type SourceSpec struct {
+	// Repository is the git repository to pull from for building the hugo site
+	// +kubebuilder:validation:Required
+	// +kubebuilder:example:="https://github.com/cedi/cedi.github.io.git"
+	Repository string `json:"repository"`
+
+	// Branch is the branch from which to build the site. Defaults to main
+	// +optional
+	Branch string `json:"branch,omitempty"`
+}
+
+// BuildSpec configures how and when a Hugo Page is built
+// +kubebuilder:validation:XValidation:rule="!has(self.extended) || !self.extended || has(self.hugoVersion)",message="extended requires hugoVersion"
+type BuildSpec struct {
+	// Trigger configures how the Hugo-Site is rebuilt.
+	// cron takes the configured schedule to rebuild the page. Defaults to cron
+	// +optional
+	Trigger BuildTrigger `json:"trigger,omitempty"`
+
+	// Schedule is the interval in which the hugo-site is refreshed as a cron syntax string. Defaults to "*/5 * * * *".
+	// Builds are delayed by an offset derived from the page name, so pages sharing a schedule do not start at once
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Image is the container image used for building the Hugo Page. Defaults to ghcr.io/SpechtLabs/page_builder:main
+	// More info: https://kubernetes.io/docs/concepts/containers/images
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ImagePullPolicy of the builder image.
+	// One of Always, Never, IfNotPresent. Defaults to IfNotPresent
+	// More info: https://kubernetes.io/docs/concepts/containers/images#updating-images
+	// +optional
+	ImagePullPolicy apiv1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// HugoVersion selects the builder image from the Hugo versions configured in the Setting.
+	// Ignored if image is set
+	// +kubebuilder:example:="0.111.3"
+	// +optional
+	HugoVersion string `json:"hugoVersion,omitempty"`
+
+	// Extended selects the extended edition of Hugo, which is required to process SCSS
+	// +optional
+	Extended bool `json:"extended,omitempty"`
+
+	// Flags are passed to hugo when building the page
+	// +optional
+	Flags HugoFlagsSpec `json:"flags,omitempty"`
+
+	// Command replaces the hugo invocation of the builder with a custom shell command.
+	// The command is run unescaped, so it is only allowed if the Setting has allowUnsafeBuildCommand set.
+	// Flags are ignored if command is set
+	// +optional
+	Command string `json:"command,omitempty"`
+
+	// Env sets environment variables of the builder, e.g. HUGO_ENV or HUGO_PARAMS_*.
+	// Variables set by hugo-hoster itself, like AWS_SECRET_ACCESS_KEY or TRACEPARENT, can not be overridden
+	// +optional
+	Env []apiv1.EnvVar `json:"env,omitempty"`
+
+	// EnvFrom sets environment variables of the builder from ConfigMaps and Secrets.
+	// Every source needs a prefix that no variable set by hugo-hoster starts with, e.g. HUGO_PARAMS_.
+	// The prefixes AWS_, S3_ and OTEL_EXPORTER_OTLP_ are reserved
+	// +optional
+	EnvFrom []apiv1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// Cache persists the Hugo cache and generated resources between builds in a PersistentVolumeClaim.
+	// The cache is disabled if empty
+	// +optional
+	Cache *BuildCacheSpec `json:"cache,omitempty"`
+
+	BuilderSpec `json:",inline"`
+}
+
+// BuildCacheSpec configures the build cache volume of a Hugo Page. Changing the size or StorageClass
+// recreates the volume with an empty cache once no build is running
+type BuildCacheSpec struct {
+	// Size of the cache volume. Defaults to 1Gi
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName of the cache volume. Defaults to the default StorageClass of the cluster
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+// HugoFlagsSpec configures the command line of hugo
+type HugoFlagsSpec struct {
+	// Minify minifies any supported output format (--minify)
+	// +optional
+	Minify bool `json:"minify,omitempty"`
+
+	// BuildDrafts includes content marked as draft (--buildDrafts)
+	// +optional
+	BuildDrafts bool `json:"buildDrafts,omitempty"`
+
+	// BuildFuture includes content with a publish date in the future (--buildFuture)
+	// +optional
+	BuildFuture bool `json:"buildFuture,omitempty"`
+
+	// Environment is the Hugo build environment (--environment)
+	// +kubebuilder:example:=production
+	// +optional
+	Environment string `json:"environment,omitempty"`
+
+	// BaseURL overrides the baseURL of the site config (--baseURL). Defaults to the URL of routing.host
+	// +kubebuilder:example:="https://cedi.dev/"
+	// +optional
+	BaseURL string `json:"baseURL,omitempty"`
+
+	// InjectBaseURL passes the URL of routing.host as baseURL to hugo, using https if TLS is enabled in the Setting.
+	// Defaults to true
+	// +optional
+	InjectBaseURL *bool `json:"injectBaseURL,omitempty"`
+
+	// Config is the list of config files to use, relative to sourceDir (--config)
+	// +optional
+	Config []string `json:"config,omitempty"`
+
+	// Destination is the directory the site is written to and uploaded from, relative to sourceDir. Defaults to public (--destination)
+	// It must be a relative path without ..
+	// +kubebuilder:validation:Pattern=`^(([^/.][^/]*|\.|\.[^/.][^/]*|\.\.[^/]+)(/([^/.][^/]*|\.|\.[^/.][^/]*|\.\.[^/]+)?)*)?$`
+	// +optional
+	Destination string `json:"destination,omitempty"`
+
+	// SourceDir is the directory of the site in the repository, for repositories holding more than the site (--source)
+	// It must be a relative path without ..
+	// +kubebuilder:example:=docs
+	// +kubebuilder:validation:Pattern=`^(([^/.][^/]*|\.|\.[^/.][^/]*|\.\.[^/]+)(/([^/.][^/]*|\.|\.[^/.][^/]*|\.\.[^/]+)?)*)?$`
+	// +optional
+	SourceDir string `json:"sourceDir,omitempty"`
+}
+
+// BuilderSpec configures the resources and scheduling of the builder Job.
+// Fields left empty on a Hugo Page are taken from its Setting.
+type BuilderSpec struct {
+	// Resources of the builder container
+	// More info: https://kubernetes.io/docs/concepts/configuration/manage-resources-containers/
+	// +optional
+	Resources *apiv1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector restricts the nodes the builder is scheduled on
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the builder pod
+	// +optional
+	Tolerations []apiv1.Toleration `json:"tolerations,omitempty"`
+
+	// Timeout after which a build is cancelled. Defaults to 30m
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// BackoffLimit is the number of retries before a build is considered failed. Defaults to 6
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+}
+
+// ServeSpec configures the nginx proxy serving a Hugo Page
+type ServeSpec struct {
+	// Replicas overrides the number of nginx proxy replicas configured in the Setting
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Autoscaled leaves the number of nginx proxy replicas to a HorizontalPodAutoscaler scaling the
+	// Deployment nginx-proxy-<page>. Replicas is ignored
+	// +optional
+	Autoscaled bool `json:"autoscaled,omitempty"`
+
+	// Image is the container image of the nginx proxy. Defaults to nginx:alpine
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// RoutingSpec configures how a Hugo Page is exposed
+type RoutingSpec struct {
+	// Host is the hostname under which the Hugo Page is served
+	// +kubebuilder:validation:Required
+	// +kubebuilder:example:=cedi.dev
+	Host string `json:"host"`
+
+	// IngressClassName overrides the ingress-class configured in the Setting
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+}
+
+const (
+	// SettingKind references a namespaced Setting
+	SettingKind = "Setting"
+
+	// ClusterSettingKind references a cluster-scoped ClusterSetting
+	ClusterSettingKind = "ClusterSetting"
+)
+
+// SettingRef references the Setting or ClusterSetting that configures a Hugo Page
+type SettingRef struct {
+	// Kind of the referenced object. Defaults to Setting
+	// +kubebuilder:validation:Enum=Setting;ClusterSetting
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the referenced object. A Setting is always looked up in the namespace of the Hugo Page
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+// HugoPageSpec defines the desired state of HugoPage
+// +kubebuilder:validation:XValidation:rule="!has(self.environments) || self.environments.all(e, e.host != self.routing.host)",message="environments must be served under another host than the page"
+type HugoPageSpec struct {
+	// SettingRef selects the Setting or ClusterSetting used for this Hugo Page.
+	// If empty, the Setting configured on the controller is used from the namespace of the Hugo Page,
+	// falling back to the ClusterSetting of the same name
+	// +optional
+	SettingRef *SettingRef `json:"settingRef,omitempty"`
+
+	// Source configures the git repository the Hugo Page is built from
+	// +kubebuilder:validation:Required
+	Source SourceSpec `json:"source"`
+
+	// Build configures how and when the Hugo Page is built
+	// +optional
+	Build BuildSpec `json:"build,omitempty"`
+
+	// Serve configures the nginx proxy serving the Hugo Page
+	// +optional
+	Serve ServeSpec `json:"serve,omitempty"`
+
+	// Routing configures under which host the Hugo Page is served
+	// +kubebuilder:validation:Required
+	Routing RoutingSpec `json:"routing"`
+
+	// Previews builds every open pull request of the source repository into a preview Hugo Page.
+	// The pull requests are discovered with the forge configured in the Setting
+	// +optional
+	Previews *PreviewSpec `json:"previews,omitempty"`
+
+	// Environments builds further branches of the source repository, each into its own Hugo Page
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Environments []EnvironmentSpec `json:"environments,omitempty"`
+
+	// Notifications are sent for the builds of the Hugo Page, in addition to the notifications of the Setting.
+	// Secrets are read from the namespace of the Hugo Page
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Notifications []NotificationSinkSpec `json:"notifications,omitempty"`
+
+	// Probe configures the synthetic probing of the Hugo Page, which is probed with the defaults if empty
+	// +optional
+	Probe *ProbeSpec `json:"probe,omitempty"`
+}
+
+// ProbeTarget is what a Hugo Page is probed through
+// +kubebuilder:validation:Enum=Service;URL
+type ProbeTarget string
+
+const (
+	// ProbeTargetService probes the nginx proxy Service of the Hugo Page with the host of the page. The name of the
+	// Service only resolves inside the cluster, a controller running outside of it probes the URL instead
+	ProbeTargetService ProbeTarget = "Service"
+
+	// ProbeTargetURL probes the URL the Hugo Page is served under, through the Ingress
+	ProbeTargetURL ProbeTarget = "URL"
+)
+
+// ProbeSpec configures the synthetic probing of a Hugo Page
+type ProbeSpec struct {
+	// Disabled turns off probing and removes the Serving condition of the Hugo Page
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Target is what the Hugo Page is probed through
+	// +kubebuilder:default:=Service
+	// +optional
+	Target ProbeTarget `json:"target,omitempty"`
+
+	// Path that is requested
+	// +kubebuilder:default:=/
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Interval in which the Hugo Page is probed. Defaults to 1m
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Timeout after which a probe fails. Defaults to 10s
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// ExpectedStatus is the HTTP status code of a successful probe
+	// +kubebuilder:default:=200
+	// +kubebuilder:validation:Minimum=100
+	// +kubebuilder:validation:Maximum=599
+	// +optional
+	ExpectedStatus int32 `json:"expectedStatus,omitempty"`
+
+	// ExpectedContent must be contained in the first MiB of the response of a successful probe
+	// +optional
+	ExpectedContent string `json:"expectedContent,omitempty"`
+
+	// FailureThreshold is the number of consecutive failed probes after which the Hugo Page is not serving
+	// +kubebuilder:default:=3
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+
+	// Rollback keeps a copy of the last build that passed the probe and restores it when a new build fails the probe.
+	// Scheduled builds are held after a rollback until the Hugo Page changes or a build is triggered
+	// +optional
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+// EnvironmentSpec configures a branch of a Hugo Page that is built and served separately
+type EnvironmentSpec struct {
+	// Name of the environment. The Hugo Page of the environment is named after the page and the environment
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:example:=staging
+	Name string `json:"name"`
+
+	// Branch is the git branch the environment is built from
+	// +kubebuilder:validation:Required
+	Branch string `json:"branch"`
+
+	// Host is the hostname under which the environment is served
+	// +kubebuilder:validation:Required
+	// +kubebuilder:example:=staging.cedi.dev
+	Host string `json:"host"`
+
+	// Flags replace the build flags of the page for the environment
+	// +optional
+	Flags *HugoFlagsSpec `json:"flags,omitempty"`
+
+	// Schedule replaces the build schedule of the page for the environment
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// PreviewSpec configures the preview Hugo Pages of pull requests
+type PreviewSpec struct {
+	// HostTemplate is a Go template rendering the host of a preview.
+	// .Number, .Branch and .Page are available
+	// +kubebuilder:validation:Required
+	// +kubebuilder:example:="pr-{{ .Number }}.preview.cedi.dev"
+	HostTemplate string `json:"hostTemplate"`
+
+	// PollInterval is the interval in which the open pull requests are listed. Defaults to 5m
+	// +optional
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// AllowForks builds pull requests from forks of the source repository.
+	// The author of a fork controls what the builder runs, e.g. through the Hugo config of the site,
+	// so previews of forks are built without env, envFrom and command of the page and with the
+	// forkPreviewCredentialsSecret of the Setting. They are not built if the Setting has none
+	// +optional
+	AllowForks bool `json:"allowForks,omitempty"`
+}
+
+// BuildStatus describes a single build of a Hugo Page
+type BuildStatus struct {
+	// CompletionTime is the time the build finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Commit is the commit-id the build was made from
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Result is the outcome of the build
+	// +optional
+	Result BuildResult `json:"result,omitempty"`
+
+	// HugoVersion is the version of Hugo the build ran with
+	// +optional
+	HugoVersion string `json:"hugoVersion,omitempty"`
+
+	// StartTime is the time the build started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// Number counts the builds of the Hugo Page
+	// +optional
+	Number int32 `json:"number,omitempty"`
+
+	// Log references the tail of the build log
+	// +optional
+	Log *BuildLogRef `json:"log,omitempty"`
+
+	// CommitTime is the commit time of the commit the build was made from
+	// +optional
+	CommitTime *metav1.Time `json:"commitTime,omitempty"`
+
+	// PublishedBytes is the size of the site the build published
+	// +optional
+	PublishedBytes int64 `json:"publishedBytes,omitempty"`
+
+	// PublishedFiles is the number of files the build published
+	// +optional
+	PublishedFiles int32 `json:"publishedFiles,omitempty"`
+}
+
+// BuildLogRef references the tail of a build log stored in a ConfigMap next to the Hugo Page
+type BuildLogRef struct {
+	// ConfigMap is the name of the ConfigMap holding the logs of the recent builds
+	ConfigMap string `json:"configMap"`
+
+	// Key is the key of the log in the ConfigMap
+	Key string `json:"key"`
+}
+
+// BuildLogKey returns the key of the log of build number in the build log ConfigMap
+func BuildLogKey(number int32) string {
+	return fmt.Sprintf("build-%d.log", number)
+}
+
+// RollbackStatus describes a rollback of a Hugo Page to its known-good build
+type RollbackStatus struct {
+	// FromBuild is the number of the build that failed the probe
+	FromBuild int32 `json:"fromBuild"`
+
+	// ToBuild is the number of the known-good build that is served instead
+	ToBuild int32 `json:"toBuild"`
+
+	// Time of the rollback
+	Time metav1.Time `json:"time"`
+
+	// Generation of the Hugo Page that was rolled back. Scheduled builds resume once the generation changes
+	Generation int64 `json:"generation"`
+}
+
+// PreviewStatus describes the preview Hugo Page of a pull request
+type PreviewStatus struct {
+	// Number of the pull request
+	Number int32 `json:"number"`
+
+	// Page is the name of the preview Hugo Page
+	Page string `json:"page"`
+
+	// Host is the host the preview is served under
+	Host string `json:"host"`
+
+	// Commit is the head commit of the pull request
+	// +optional
+	Commit string `json:"commit,omitempty"`
+}
+
+// EnvironmentStatus describes the Hugo Page of an environment
+type EnvironmentStatus struct {
+	// Name of the environment
+	Name string `json:"name"`
+
+	// Page is the name of the Hugo Page of the environment
+	Page string `json:"page"`
+
+	// Host is the host the environment is served under
+	Host string `json:"host"`
+
+	// LastBuild describes the most recent build of the environment
+	// +optional
+	LastBuild BuildStatus `json:"lastBuild,omitempty"`
+
+	// LastSuccessTime is the time the last successful build finished
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+}
+
+// HugoPageStatus defines the observed state of HugoPage
+type HugoPageStatus struct {
+	// ObservedGeneration is the generation of the HugoPage the status was computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastBuild describes the most recent build of the Hugo Page
+	// +optional
+	LastBuild BuildStatus `json:"lastBuild,omitempty"`
+
+	// LastSuccessTime is the time the last successful build finished
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+
+	// StoragePrefix is the prefix in the bucket the Hugo Page is published under
+	// +optional
+	StoragePrefix string `json:"storagePrefix,omitempty"`
+
+	// ProbedBuild is the number of the last build of the Hugo Page when it was last probed
+	// +optional
+	ProbedBuild int32 `json:"probedBuild,omitempty"`
+
+	// KnownGoodBuild is the number of the build that last passed the probe and is kept to roll back to
+	// +optional
+	KnownGoodBuild int32 `json:"knownGoodBuild,omitempty"`
+
+	// Rollback describes the rollback to the known-good build until the next build finished
+	// +optional
+	Rollback *RollbackStatus `json:"rollback,omitempty"`
+
+	// LastCacheWipe is the value of the wipe-cache annotation the build cache was last wiped for
+	// +optional
+	LastCacheWipe string `json:"lastCacheWipe,omitempty"`
+
+	// LastTrigger is the value of the trigger-build annotation a build was last queued for
+	// +optional
+	LastTrigger string `json:"lastTrigger,omitempty"`
+
+	// Previews are the preview Hugo Pages of the open pull requests
+	// +listType=map
+	// +listMapKey=number
+	// +optional
+	Previews []PreviewStatus `json:"previews,omitempty"`
+
+	// Environments are the Hugo Pages of the environments
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Environments []EnvironmentStatus `json:"environments,omitempty"`
+
+	// Conditions describe the current state of the Hugo Page
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// HugoPage is the Schema for the HugoPages API
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:scope=Namespaced
+// +kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.routing.host`
+// +kubebuilder:printcolumn:name="LastBuild",type=string,format=date-time,JSONPath=`.status.lastBuild.completionTime`
+// +kubebuilder:printcolumn:name="Commit",type=string,JSONPath=`.status.lastBuild.commit`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.lastBuild.result`
+// +kubebuilder:printcolumn:name="Serving",type=string,JSONPath=`.status.conditions[?(@.type=="Serving")].status`
+// +k8s:openapi-gen=true
+type HugoPage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HugoPageSpec   `json:"spec,omitempty"`
+	Status HugoPageStatus `json:"status,omitempty"`
+}
+
+// HugoPageList contains a list of HugoPage
+// +kubebuilder:object:root=true
+type HugoPageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HugoPage `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HugoPage{}, &HugoPageList{})
+}
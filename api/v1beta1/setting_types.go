@@ -0,0 +1,376 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SettingSpec defines the desired state of Setting
+type SettingSpec struct {
+	// Storage configures the S3 bucket the pages are uploaded to and served from
+	// +kubebuilder:validation:Required
+	Storage StorageSpec `json:"storage"`
+
+	// Routing configures how the pages are exposed
+	// +kubebuilder:default:={}
+	// +optional
+	Routing SettingRoutingSpec `json:"routing,omitempty"`
+
+	// Serve configures the nginx proxies serving the pages
+	// +kubebuilder:default:={}
+	// +optional
+	Serve SettingServeSpec `json:"serve,omitempty"`
+
+	// Build configures the defaults of the builder Job for every page
+	// +optional
+	Build BuilderSpec `json:"build,omitempty"`
+
+	// MaxConcurrentBuilds limits the number of builds running at once for the pages using the Setting.
+	// Further builds are queued. 0 means no limit
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxConcurrentBuilds int32 `json:"maxConcurrentBuilds,omitempty"`
+
+	// AllowUnsafeBuildCommand allows Hugo Pages to replace the hugo invocation with a shell command using build.command
+	// +optional
+	AllowUnsafeBuildCommand bool `json:"allowUnsafeBuildCommand,omitempty"`
+
+	// HugoVersions maps the Hugo versions pages can select to builder images
+	// +listType=atomic
+	// +optional
+	HugoVersions []HugoVersionSpec `json:"hugoVersions,omitempty"`
+
+	// Forge configures the API of the git forge hosting the repositories of the pages
+	// +optional
+	Forge *ForgeSpec `json:"forge,omitempty"`
+
+	// Notifications are sent for the builds of every page using the Setting
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Notifications []NotificationSinkSpec `json:"notifications,omitempty"`
+
+	// BuildLogURL is a Go template of the URL notifications link the log of a build with, for a log viewer collecting
+	// the logs of the builder pods. .Namespace, .Page, .Build and .Job are available. Without it, notifications tell
+	// the kubectl command printing the log
+	// +kubebuilder:example:="https://logs.example.com/{{ .Namespace }}/{{ .Job }}"
+	// +optional
+	BuildLogURL string `json:"buildLogURL,omitempty"`
+}
+
+// NotificationEvent is a change of the state of a Hugo Page that is notified about
+// +kubebuilder:validation:Enum=BuildFailed;BuildRecovered;DeploySucceeded
+type NotificationEvent string
+
+const (
+	// NotificationBuildFailed is sent for every failed or cancelled build
+	NotificationBuildFailed NotificationEvent = "BuildFailed"
+
+	// NotificationBuildRecovered is sent for the first successful build after a failed one
+	NotificationBuildRecovered NotificationEvent = "BuildRecovered"
+
+	// NotificationDeploySucceeded is sent for every successful build
+	NotificationDeploySucceeded NotificationEvent = "DeploySucceeded"
+)
+
+// NotificationSinkType is the kind of service notifications are sent to
+// +kubebuilder:validation:Enum=slack;matrix;webhook
+type NotificationSinkType string
+
+const (
+	NotificationSinkSlack   NotificationSinkType = "slack"
+	NotificationSinkMatrix  NotificationSinkType = "matrix"
+	NotificationSinkWebhook NotificationSinkType = "webhook"
+)
+
+// NotificationSinkSpec configures a service notifications are sent to
+// +kubebuilder:validation:XValidation:rule="self.type != 'matrix' || (has(self.roomID) && has(self.tokenSecret))",message="matrix requires roomID and tokenSecret"
+// +kubebuilder:validation:XValidation:rule="has(self.url) != has(self.urlSecret)",message="exactly one of url and urlSecret is required"
+type NotificationSinkSpec struct {
+	// Name of the sink
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Type of the sink. slack posts to an incoming webhook, matrix sends a message to a room,
+	// webhook posts the notification as JSON
+	// +kubebuilder:validation:Required
+	Type NotificationSinkType `json:"type"`
+
+	// URL is the incoming webhook of slack, the homeserver of matrix or the URL of the webhook.
+	// Only the sinks of a ClusterSetting may point to loopback, link-local or private addresses
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// URLSecret references a Secret holding the URL, for URLs that contain credentials like Slack incoming webhooks
+	// +optional
+	URLSecret *SecretKeyRef `json:"urlSecret,omitempty"`
+
+	// RoomID is the matrix room messages are sent to
+	// +kubebuilder:example:="!abcdef:matrix.org"
+	// +optional
+	RoomID string `json:"roomID,omitempty"`
+
+	// TokenSecret references a Secret holding the matrix access token, or a bearer token for the webhook
+	// +optional
+	TokenSecret *SecretKeyRef `json:"tokenSecret,omitempty"`
+
+	// Events filters the events sent to the sink. Defaults to BuildFailed and BuildRecovered
+	// +listType=set
+	// +optional
+	Events []NotificationEvent `json:"events,omitempty"`
+
+	// Template is a Go template rendering the message. .Event, .Page, .Namespace, .URL, .Build, .Commit,
+	// .Duration and .Logs are available
+	// +optional
+	Template string `json:"template,omitempty"`
+}
+
+// ForgeType is the kind of API a git forge provides
+// +kubebuilder:validation:Enum=github;gitlab;gitea
+type ForgeType string
+
+const (
+	ForgeTypeGitHub ForgeType = "github"
+	ForgeTypeGitLab ForgeType = "gitlab"
+	ForgeTypeGitea  ForgeType = "gitea"
+)
+
+// ForgeSpec configures the API of a git forge
+// +kubebuilder:validation:XValidation:rule="self.type != 'gitea' || has(self.url)",message="gitea requires the url of its API"
+type ForgeSpec struct {
+	// Type of the forge
+	// +kubebuilder:validation:Required
+	Type ForgeType `json:"type"`
+
+	// URL is the base URL of the forge API, like https://gitea.example.com/api/v1 for gitea.
+	// Defaults to the public API of github and gitlab
+	// +kubebuilder:example:="https://gitlab.example.com/api/v4"
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// TokenSecret references the Kubernetes Secret that contains the API token
+	// +optional
+	TokenSecret *SecretKeyRef `json:"tokenSecret,omitempty"`
+
+	// CommitStatus marks the built commits pending, success or failure on the forge, which requires the token
+	// to be allowed to write commit statuses
+	// +optional
+	CommitStatus *CommitStatusSpec `json:"commitStatus,omitempty"`
+}
+
+// CommitStatusSpec configures the commit statuses reported to the forge
+type CommitStatusSpec struct {
+	// Context tells the commit statuses of hugo-hoster apart from those of other systems
+	// +kubebuilder:default:=hugo-hoster
+	// +optional
+	Context string `json:"context,omitempty"`
+
+	// Repositories the token may report commit statuses to, as patterns of their host and path like github.com/cedi/*.
+	// Hugo Pages building other repositories get no commit statuses, as the token would otherwise write to any
+	// repository a tenant names
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:example:={"github.com/cedi/*"}
+	Repositories []string `json:"repositories"`
+}
+
+// SecretKeyRef references a key of a Kubernetes Secret
+type SecretKeyRef struct {
+	// Name is the name of the Kubernetes Secret
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the Kubernetes Secret. It is required for a ClusterSetting
+	// and ignored for a Setting, which always reads the Secret from its own namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key is the key in the Secret that contains the value
+	// +kubebuilder:default:=token
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// HugoVersionSpec maps a Hugo version and edition to the builder image providing it
+type HugoVersionSpec struct {
+	// Version of Hugo
+	// +kubebuilder:validation:Required
+	// +kubebuilder:example:="0.111.3"
+	Version string `json:"version"`
+
+	// Extended is true if the image provides the extended edition of Hugo
+	// +optional
+	Extended bool `json:"extended,omitempty"`
+
+	// Image is the builder image providing this version of Hugo
+	// +kubebuilder:validation:Required
+	Image string `json:"image"`
+}
+
+// StorageSpec configures where the built pages are stored
+type StorageSpec struct {
+	// S3 contains the configuration of the S3 bucket to upload the pages to
+	// +kubebuilder:validation:Required
+	S3 S3Spec `json:"s3"`
+
+	// ServingURL is the URL from which the static files are served. Most of the time this is the same as `spec.storage.s3.endpoint`. If this is empty, `spec.storage.s3.endpoint` is used
+	// +kubebuilder:example:="https://f003.backblazeb2.com/file"
+	// +optional
+	ServingURL string `json:"servingURL,omitempty"`
+}
+
+// S3Spec configures an S3 bucket
+type S3Spec struct {
+	// Endpoint is the Endpoint URL for the S3 Bucket to upload pages to
+	// +kubebuilder:validation:Required
+	// +kubebuilder:example:="https://s3.eu-central-003.backblazeb2.com"
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the S3 Bucket to which all sites are uploaded
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+
+	// CredentialsSecret references the Kubernetes Secret that contains the S3 AccessKeyId and the AccessKey
+	// +kubebuilder:validation:Required
+	CredentialsSecret S3CredentialsSecretRef `json:"credentialsSecret"`
+
+	// ForkPreviewCredentialsSecret references the S3 credentials the previews of pull requests from forks are built with.
+	// They should only be allowed to write the prefixes of previews, _sites/<namespace>/*-pr-*,
+	// as anyone opening a pull request can read them. Previews of forks are not built without them
+	// +optional
+	ForkPreviewCredentialsSecret *S3CredentialsSecretRef `json:"forkPreviewCredentialsSecret,omitempty"`
+}
+
+// S3CredentialsSecretRef references the keys of a Kubernetes Secret that hold S3 credentials
+type S3CredentialsSecretRef struct {
+	// Name is the name of the Kubernetes Secret
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the Kubernetes Secret. It is required for a ClusterSetting
+	// and ignored for a Setting, which always reads the Secret from its own namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// AccessKeyIDKey is the name of the key in the Secret that contains the AccessKeyId
+	// +kubebuilder:default:=AccessKeyId
+	// +optional
+	AccessKeyIDKey string `json:"accessKeyIDKey,omitempty"`
+
+	// SecretAccessKeyKey is the name of the key in the Secret that contains the AccessKey
+	// +kubebuilder:default:=AccessKey
+	// +optional
+	SecretAccessKeyKey string `json:"secretAccessKeyKey,omitempty"`
+}
+
+// SettingRoutingSpec configures how pages are exposed
+type SettingRoutingSpec struct {
+	// IngressClassName makes it possible to override the ingress-class
+	// +kubebuilder:default:=nginx
+	// +optional
+	IngressClassName string `json:"ingressClassName,omitempty"`
+
+	// TLS configure if you want to enable TLS
+	// +optional
+	TLS TLSSpec `json:"tls,omitempty"`
+}
+
+// TLSSpec holds the TLS configuration used
+type TLSSpec struct {
+	// Enabled enables TLS on the Ingress of every page
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Annotations are added to the Ingress of every page if TLS is enabled
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SettingServeSpec configures the nginx proxies serving the pages
+type SettingServeSpec struct {
+	// Replicas is the number of nginx proxy replicas for each page
+	// +kubebuilder:default:=1
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+const (
+	// SettingConditionCredentialsValid reports whether the S3 credentials Secret and its keys exist
+	SettingConditionCredentialsValid = "CredentialsValid"
+
+	// SettingConditionBucketReachable reports whether the S3 bucket can be reached with the credentials
+	SettingConditionBucketReachable = "BucketReachable"
+
+	// SettingConditionBucketWritable reports whether objects can be written to the S3 bucket
+	SettingConditionBucketWritable = "BucketWritable"
+
+	// SettingConditionReady reports whether Hugo Pages can be built and served with the Setting
+	SettingConditionReady = "Ready"
+)
+
+// SettingStatus defines the observed state of Setting
+type SettingStatus struct {
+	// ObservedGeneration is the generation of the Setting the status was computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastCheckTime is the time the S3 storage was last checked
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+
+	// Pages is the number of Hugo Pages using the Setting
+	// +optional
+	Pages int32 `json:"pages,omitempty"`
+
+	// Conditions describe the current state of the Setting
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:scope=Namespaced
+// +kubebuilder:printcolumn:name="TlsEnabled",type=string,JSONPath=`.spec.routing.tls.enabled`
+// +kubebuilder:printcolumn:name="S3Endpoint",type=string,JSONPath=`.spec.storage.s3.endpoint`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Pages",type=integer,JSONPath=`.status.pages`
+
+// Setting is the Schema for the settings API
+type Setting struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SettingSpec   `json:"spec,omitempty"`
+	Status SettingStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SettingList contains a list of Setting
+type SettingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Setting `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Setting{}, &SettingList{})
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-hugo is a kubectl plugin to inspect and operate Hugo Pages
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	"github.com/pkg/errors"
+)
+
+const usage = `kubectl hugo operates Hugo Pages.
+
+Usage:
+  kubectl hugo logs <page> [--build N]   Print the log of the last or the N-th build
+  kubectl hugo build <page>              Queue a build ahead of the scheduled ones
+  kubectl hugo wipe-cache <page>         Wipe the build cache before the next build
+
+Flags:
+  -n, --namespace    Namespace of the Hugo Page
+      --kubeconfig   Path to the kubeconfig file
+`
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(out, usage)
+		return nil
+	}
+
+	command := args[0]
+
+	flags := flag.NewFlagSet("kubectl hugo "+command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+
+	var namespace, kubeconfig string
+	var build int
+	flags.StringVar(&namespace, "namespace", "", "Namespace of the Hugo Page")
+	flags.StringVar(&namespace, "n", "", "Namespace of the Hugo Page")
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file")
+	if command == "logs" {
+		flags.IntVar(&build, "build", 0, "Number of the build. Defaults to the last build")
+	}
+
+	positional, err := parseInterspersed(flags, args[1:])
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 {
+		return errors.Errorf("%s expects exactly one Hugo Page, got %d arguments", command, len(positional))
+	}
+
+	c, defaultNamespace, err := newClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	page := &hugohosterv1beta1.HugoPage{}
+	if err := c.Get(ctx, types.NamespacedName{Name: positional[0], Namespace: namespace}, page); err != nil {
+		return errors.Wrapf(err, "Failed to get Hugo Page %s/%s", namespace, positional[0])
+	}
+
+	switch command {
+	case "logs":
+		return printLog(ctx, c, page, int32(build), out)
+
+	case "build":
+		return annotate(ctx, c, page, hugohosterv1beta1.TriggerBuildAnnotation, out, "build queued")
+
+	case "wipe-cache":
+		return annotate(ctx, c, page, hugohosterv1beta1.WipeCacheAnnotation, out, "build cache wipe requested")
+
+	default:
+		return errors.Errorf("Unknown command %q, see kubectl hugo --help", command)
+	}
+}
+
+// parseInterspersed parses flags that may appear before and after the positional arguments, which it returns
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// newClient creates a client from the kubeconfig and returns the namespace of its current context
+func newClient(kubeconfig string) (client.Client, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to read namespace from kubeconfig")
+	}
+
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to load kubeconfig")
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(hugohosterv1beta1.AddToScheme(scheme))
+
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to create client")
+	}
+
+	return c, namespace, nil
+}
+
+// printLog prints the log of build number of page, or of its last build if number is 0
+func printLog(ctx context.Context, c client.Client, page *hugohosterv1beta1.HugoPage, number int32, out io.Writer) error {
+	last := page.Status.LastBuild
+	if last.Log == nil {
+		return errors.Errorf("No build log of Hugo Page %s was captured yet", page.Name)
+	}
+
+	if number == 0 {
+		number = last.Number
+	}
+
+	configMap := &apiv1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Name: last.Log.ConfigMap, Namespace: page.Namespace}, configMap); err != nil {
+		return errors.Wrapf(err, "Failed to get build log ConfigMap %s", last.Log.ConfigMap)
+	}
+
+	log, ok := configMap.Data[hugohosterv1beta1.BuildLogKey(number)]
+	if !ok {
+		keys := []string{}
+		for key := range configMap.Data {
+			keys = append(keys, strings.TrimSuffix(strings.TrimPrefix(key, "build-"), ".log"))
+		}
+		sort.Strings(keys)
+
+		return errors.Errorf("No log of build %d of Hugo Page %s, logs are kept for builds %s", number, page.Name, strings.Join(keys, ", "))
+	}
+
+	_, err := fmt.Fprint(out, log)
+	return err
+}
+
+// annotate sets annotation of page to the current time in nanoseconds, which the controller acts on once for every new value,
+// so that two calls within the same second still both take effect
+func annotate(ctx context.Context, c client.Client, page *hugohosterv1beta1.HugoPage, annotation string, out io.Writer, done string) error {
+	patch := client.MergeFrom(page.DeepCopy())
+
+	if page.Annotations == nil {
+		page.Annotations = map[string]string{}
+	}
+	page.Annotations[annotation] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	if err := c.Patch(ctx, page, patch); err != nil {
+		return errors.Wrapf(err, "Failed to annotate Hugo Page %s", page.Name)
+	}
+
+	_, err := fmt.Fprintf(out, "hugopage/%s %s\n", page.Name, done)
+	return err
+}
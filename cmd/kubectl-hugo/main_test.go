@@ -0,0 +1,44 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	namespace := flags.String("n", "", "")
+	build := flags.Int("build", 0, "")
+
+	positional, err := parseInterspersed(flags, []string{"-n", "web", "site", "--build", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(positional, []string{"site"}) || *namespace != "web" || *build != 3 {
+		t.Errorf("unexpected parse result %v, namespace %q, build %d", positional, *namespace, *build)
+	}
+
+	if _, err := parseInterspersed(flags, []string{"site", "--unknown"}); err == nil {
+		t.Error("want error for unknown flag")
+	}
+}
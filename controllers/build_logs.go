@@ -0,0 +1,117 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// buildLogTailLines and maxBuildLogBytes limit the part of a build log that is kept
+	buildLogTailLines = 200
+	maxBuildLogBytes  = 64 * 1024
+
+	// buildLogsHistoryLimit is the number of build logs kept per page
+	buildLogsHistoryLimit = failedBuildsHistoryLimit
+)
+
+func buildLogsName(page *hugohosterv1beta1.HugoPage) string {
+	return fmt.Sprintf("%s-build-logs", page.Name)
+}
+
+// storeBuildLog stores the tail of the log of the page-builder container of pod in the build log ConfigMap of page
+// and references it from build. previous reads the log of the previous run of the container.
+// A log that cannot be read is reported as event, as the pod may already be gone.
+func (r *HugoPageReconciler) storeBuildLog(ctx context.Context, page *hugohosterv1beta1.HugoPage, pod string, previous bool, build *hugohosterv1beta1.BuildStatus) error {
+	tailLines := int64(buildLogTailLines)
+	limitBytes := int64(maxBuildLogBytes)
+
+	log, err := r.podLogs.Pods(page.Namespace).GetLogs(pod, &apiv1.PodLogOptions{
+		Container:  "page-builder",
+		Previous:   previous,
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	}).DoRaw(ctx)
+	if err != nil {
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "BuildLogUnavailable", "Failed to read the log of build %d: %s", build.Number, err.Error())
+		return nil
+	}
+
+	existing := &apiv1.ConfigMap{}
+	if err := r.client.Get(ctx, client.ObjectKey{Name: buildLogsName(page), Namespace: page.Namespace}, existing); err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrap(err, "Failed to get build log ConfigMap")
+	}
+
+	key := hugohosterv1beta1.BuildLogKey(build.Number)
+	data := map[string]string{}
+	for k, v := range existing.Data {
+		data[k] = v
+	}
+
+	data[key] = strings.ToValidUTF8(string(log), "�")
+	pruneBuildLogs(data, buildLogsHistoryLimit)
+
+	configMap := &apiv1.ConfigMap{}
+	configMap.ObjectMeta = metav1.ObjectMeta{
+		Name:      buildLogsName(page),
+		Namespace: page.Namespace,
+		Labels:    makeLabels(page, "builder"),
+	}
+	configMap.Data = data
+
+	if err := r.apply(ctx, page, configMap); err != nil {
+		return errors.Wrap(err, "Failed to apply build log ConfigMap")
+	}
+
+	build.Log = &hugohosterv1beta1.BuildLogRef{
+		ConfigMap: configMap.Name,
+		Key:       key,
+	}
+
+	return nil
+}
+
+// pruneBuildLogs removes all but the limit most recent build logs from data
+func pruneBuildLogs(data map[string]string, limit int) {
+	numbers := []int32{}
+	for key := range data {
+		var number int32
+		if _, err := fmt.Sscanf(key, "build-%d.log", &number); err == nil && hugohosterv1beta1.BuildLogKey(number) == key {
+			numbers = append(numbers, number)
+		}
+	}
+
+	if len(numbers) <= limit {
+		return
+	}
+
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	for _, number := range numbers[:len(numbers)-limit] {
+		delete(data, hugohosterv1beta1.BuildLogKey(number))
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestPruneBuildLogs(t *testing.T) {
+	data := map[string]string{"notes": "kept"}
+	for number := int32(1); number <= 12; number++ {
+		data[hugohosterv1beta1.BuildLogKey(number)] = "log"
+	}
+
+	pruneBuildLogs(data, 10)
+
+	for number := int32(1); number <= 12; number++ {
+		_, ok := data[hugohosterv1beta1.BuildLogKey(number)]
+		if want := number > 2; ok != want {
+			t.Errorf("want log of build %d kept: %t, got %t", number, want, ok)
+		}
+	}
+
+	if data["notes"] != "kept" {
+		t.Error("pruned a key that is no build log")
+	}
+}
@@ -0,0 +1,626 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// buildQueueInterval is the interval in which due builds are queued and queued builds are started
+	buildQueueInterval = 1 * time.Second
+
+	// startedTimeout is how long a started build counts as running while its Job is not in the cache yet
+	startedTimeout = 1 * time.Minute
+
+	// maxBuildJitter caps the offset builds are delayed by, so pages with rare schedules are not delayed for hours
+	maxBuildJitter = 10 * time.Minute
+)
+
+// BuildPriority orders the queued builds. Builds of a higher priority are started first
+type BuildPriority int
+
+const (
+	BuildPriorityScheduled BuildPriority = iota
+	BuildPriorityTriggered
+)
+
+func (p BuildPriority) String() string {
+	if p == BuildPriorityTriggered {
+		return "triggered"
+	}
+
+	return "scheduled"
+}
+
+// scheduledPage is a Hugo Page known to the BuildQueue
+type scheduledPage struct {
+	setting      string
+	settingLimit int
+	cronSchedule string
+	schedule     cron.Schedule
+	next         time.Time
+	held         bool
+	paused       bool
+	suspended    bool
+}
+
+// queuedBuild is a build waiting for a free slot
+type queuedBuild struct {
+	page     types.NamespacedName
+	priority BuildPriority
+	enqueued time.Time
+
+	// trigger is the span the build was triggered in, the trace of the build continues it
+	trigger trace.SpanContext
+}
+
+// BuildQueue starts the builder Jobs of Hugo Pages from their CronJob, according to the schedule of every page or on demand.
+// At most maxConcurrent builds run in the cluster and at most the limit of a Setting run for the pages using it.
+type BuildQueue struct {
+	client        client.Client
+	tracer        trace.Tracer
+	maxConcurrent int
+
+	// builderEnv points the OpenTelemetry SDK of the builders at the collector
+	builderEnv map[string]string
+
+	// recorder records the started builds as events of their page
+	recorder record.EventRecorder
+
+	// tickMu is held while a tick starts builds
+	tickMu sync.Mutex
+
+	mu     sync.Mutex
+	pages  map[types.NamespacedName]*scheduledPage
+	queued []*queuedBuild
+	now    func() time.Time
+
+	// started holds the builds started recently, as the cache may not contain their Jobs yet
+	started map[types.NamespacedName]startedBuild
+}
+
+// startedBuild is a builder Job created by the BuildQueue
+type startedBuild struct {
+	job string
+	at  time.Time
+}
+
+// NewBuildQueue creates a new BuildQueue. A maxConcurrent of 0 means no limit.
+// builderEnv is added to the environment of the builders, next to the TRACEPARENT of their build
+func NewBuildQueue(client client.Client, maxConcurrent int, builderEnv map[string]string, recorder record.EventRecorder, tracer trace.Tracer) *BuildQueue {
+	return &BuildQueue{
+		client:        client,
+		tracer:        tracer,
+		maxConcurrent: maxConcurrent,
+		builderEnv:    builderEnv,
+		recorder:      recorder,
+		pages:         map[types.NamespacedName]*scheduledPage{},
+		started:       map[types.NamespacedName]startedBuild{},
+		now:           time.Now,
+	}
+}
+
+// settingKey identifies a Setting or ClusterSetting in the BuildQueue
+func settingKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// Schedule registers page with its cron schedule, or updates its registration.
+// settingLimit is the limit of concurrent builds of the Setting identified by setting
+func (q *BuildQueue) Schedule(page types.NamespacedName, setting string, settingLimit int, schedule string) error {
+	parsed, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to parse build schedule %q", schedule)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	scheduled, ok := q.pages[page]
+	if !ok || scheduled.cronSchedule != schedule {
+		scheduled = &scheduledPage{
+			cronSchedule: schedule,
+			schedule:     parsed,
+			next:         jitteredNext(parsed, page.String(), q.now()),
+		}
+		q.pages[page] = scheduled
+	}
+
+	scheduled.setting = setting
+	scheduled.settingLimit = settingLimit
+
+	return nil
+}
+
+// Forget removes page and its queued build
+func (q *BuildQueue) Forget(page types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.pages, page)
+	q.queued = removeQueued(q.queued, page)
+	q.updateDepth()
+}
+
+// Hold stops or resumes the scheduled builds of page. Triggered builds of a held page still run
+func (q *BuildQueue) Hold(page types.NamespacedName, held bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if scheduled, ok := q.pages[page]; ok {
+		scheduled.held = held
+	}
+}
+
+// Pause stops or resumes all builds of page. Builds triggered while page is paused stay queued until it is resumed
+func (q *BuildQueue) Pause(page types.NamespacedName, paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if scheduled, ok := q.pages[page]; ok {
+		scheduled.paused = paused
+	}
+}
+
+// Suspend stops all builds of page until resume is called. It waits for a running tick to finish and reports
+// whether a build of page was started recently, whose Job may not be in the cache yet
+func (q *BuildQueue) Suspend(page types.NamespacedName) (resume func(), started bool) {
+	q.tickMu.Lock()
+	defer q.tickMu.Unlock()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if scheduled, ok := q.pages[page]; ok {
+		scheduled.suspended = true
+	}
+
+	build, started := q.started[page]
+	started = started && q.now().Sub(build.at) <= startedTimeout
+
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		if scheduled, ok := q.pages[page]; ok {
+			scheduled.suspended = false
+		}
+	}, started
+}
+
+// Enqueue queues a build of page, which is traced as part of the span in ctx.
+// A page is queued at most once, a queued build is raised to priority if it is higher.
+func (q *BuildQueue) Enqueue(ctx context.Context, page types.NamespacedName, priority BuildPriority) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.enqueue(page, priority, trace.SpanContextFromContext(ctx))
+}
+
+func (q *BuildQueue) enqueue(page types.NamespacedName, priority BuildPriority, trigger trace.SpanContext) {
+	defer q.updateDepth()
+
+	for _, build := range q.queued {
+		if build.page == page {
+			if build.priority < priority {
+				build.priority = priority
+				build.trigger = trigger
+			}
+
+			return
+		}
+	}
+
+	q.queued = append(q.queued, &queuedBuild{page: page, priority: priority, enqueued: q.now(), trigger: trigger})
+}
+
+// Start runs the BuildQueue until ctx is done
+func (q *BuildQueue) Start(ctx context.Context) error {
+	ticker := time.NewTicker(buildQueueInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			if err := q.tick(ctx); err != nil {
+				log.FromContext(ctx).Error(err, "Failed to start queued builds")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection makes sure only the leader starts builds
+func (q *BuildQueue) NeedLeaderElection() bool {
+	return true
+}
+
+// tick queues the builds that are due and starts as many queued builds as the limits allow.
+// The queue is only locked to take a snapshot and to record the started builds, not while calling the API server
+func (q *BuildQueue) tick(ct context.Context) error {
+	q.tickMu.Lock()
+	defer q.tickMu.Unlock()
+
+	now, candidates, pages, started := q.snapshot()
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	ctx, span := q.tracer.Start(ct, "BuildQueue.tick", trace.WithAttributes(attribute.Int("queued", len(candidates))))
+	defer span.End()
+
+	jobs := &batchv1.JobList{}
+	if err := q.client.List(ctx, jobs, client.MatchingLabels{"app": "hugo-hoster", "component": "builder"}); err != nil {
+		span.RecordError(err)
+		return errors.Wrap(err, "Failed to list page-builder Jobs")
+	}
+
+	running := 0
+	runningPages := map[types.NamespacedName]bool{}
+	runningPerSetting := map[string]int{}
+
+	// listed holds the Jobs in the cache, the builds started with them no longer need to be tracked
+	listed := map[types.NamespacedName]bool{}
+
+	for i := range jobs.Items {
+		page := types.NamespacedName{Name: jobs.Items[i].Labels["page"], Namespace: jobs.Items[i].Namespace}
+		listed[types.NamespacedName{Name: jobs.Items[i].Name, Namespace: jobs.Items[i].Namespace}] = true
+
+		if _, finished := buildStatusFromJob(&jobs.Items[i]); finished {
+			continue
+		}
+
+		running++
+		runningPages[page] = true
+
+		if scheduled, ok := pages[page]; ok {
+			runningPerSetting[scheduled.setting]++
+		}
+	}
+
+	for page, build := range started {
+		if listed[types.NamespacedName{Name: build.job, Namespace: page.Namespace}] || now.Sub(build.at) > startedTimeout {
+			continue
+		}
+
+		running++
+		runningPages[page] = true
+
+		if scheduled, ok := pages[page]; ok {
+			runningPerSetting[scheduled.setting]++
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority > candidates[j].priority
+		}
+
+		return candidates[i].enqueued.Before(candidates[j].enqueued)
+	})
+
+	// done holds the builds that leave the queue, as they were started or their page is gone
+	done := map[*queuedBuild]bool{}
+	startedNow := map[types.NamespacedName]startedBuild{}
+
+	for _, candidate := range candidates {
+		build := candidate.queuedBuild
+
+		scheduled, ok := pages[build.page]
+		if !ok {
+			done[candidate.queued] = true
+			continue
+		}
+
+		// like the Forbid concurrency policy of a CronJob, a page is never built twice at once
+		if scheduled.paused || scheduled.suspended || runningPages[build.page] ||
+			(q.maxConcurrent > 0 && running >= q.maxConcurrent) ||
+			(scheduled.settingLimit > 0 && runningPerSetting[scheduled.setting] >= scheduled.settingLimit) {
+			continue
+		}
+
+		job, err := q.startBuild(ctx, &build)
+		if err != nil {
+			span.RecordError(err)
+			continue
+		}
+
+		done[candidate.queued] = true
+
+		if job != "" {
+			startedNow[build.page] = startedBuild{job: job, at: now}
+			running++
+			runningPages[build.page] = true
+			runningPerSetting[scheduled.setting]++
+			buildQueueWait.WithLabelValues(build.priority.String()).Observe(now.Sub(build.enqueued).Seconds())
+		}
+	}
+
+	q.commit(now, listed, startedNow, done)
+
+	return nil
+}
+
+// queueSnapshot is a copy of a queued build taken by snapshot
+type queueSnapshot struct {
+	queuedBuild
+
+	// queued is the build in the queue the copy was taken of
+	queued *queuedBuild
+}
+
+// snapshot queues the builds that are due and returns copies of the queued builds, the pages and the started builds
+func (q *BuildQueue) snapshot() (time.Time, []queueSnapshot, map[types.NamespacedName]scheduledPage, map[types.NamespacedName]startedBuild) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	for page, scheduled := range q.pages {
+		if scheduled.next.After(now) {
+			continue
+		}
+
+		if !scheduled.held && !scheduled.paused && !scheduled.suspended {
+			q.enqueue(page, BuildPriorityScheduled, trace.SpanContext{})
+		}
+
+		scheduled.next = jitteredNext(scheduled.schedule, page.String(), now)
+	}
+
+	candidates := make([]queueSnapshot, 0, len(q.queued))
+	for _, build := range q.queued {
+		candidates = append(candidates, queueSnapshot{queuedBuild: *build, queued: build})
+	}
+
+	pages := make(map[types.NamespacedName]scheduledPage, len(q.pages))
+	for page, scheduled := range q.pages {
+		pages[page] = *scheduled
+	}
+
+	started := make(map[types.NamespacedName]startedBuild, len(q.started))
+	for page, build := range q.started {
+		started[page] = build
+	}
+
+	return now, candidates, pages, started
+}
+
+// commit records the builds started by a tick and removes the builds that are done from the queue.
+// Builds queued while the tick ran stay queued
+func (q *BuildQueue) commit(now time.Time, listed map[types.NamespacedName]bool, startedNow map[types.NamespacedName]startedBuild, done map[*queuedBuild]bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for page, build := range q.started {
+		if listed[types.NamespacedName{Name: build.job, Namespace: page.Namespace}] || now.Sub(build.at) > startedTimeout {
+			delete(q.started, page)
+		}
+	}
+
+	for page, build := range startedNow {
+		q.started[page] = build
+	}
+
+	remaining := []*queuedBuild{}
+	for _, build := range q.queued {
+		if !done[build] {
+			remaining = append(remaining, build)
+		}
+	}
+
+	q.queued = remaining
+	q.updateDepth()
+}
+
+// startBuild creates a builder Job of build from the job template of its CronJob and returns its name.
+// It returns an empty name if the page has no CronJob (yet), in which case the build is dropped.
+// Triggered builds continue the trace of their trigger, scheduled builds start a trace of their own.
+func (q *BuildQueue) startBuild(tickCtx context.Context, build *queuedBuild) (string, error) {
+	page := build.page
+
+	parent := trace.ContextWithSpanContext(tickCtx, build.trigger)
+	options := []trace.SpanStartOption{
+		trace.WithLinks(trace.LinkFromContext(tickCtx)),
+		trace.WithAttributes(
+			attribute.String("page", page.Name),
+			attribute.String("namespace", page.Namespace),
+			attribute.String("priority", build.priority.String()),
+		),
+	}
+
+	if !build.trigger.IsValid() {
+		options = append(options, trace.WithNewRoot())
+	}
+
+	ctx, span := q.tracer.Start(parent, "BuildQueue.startBuild", options...)
+	defer span.End()
+
+	cronJob := &batchv1.CronJob{}
+	if err := q.client.Get(ctx, page, cronJob); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", nil
+		}
+
+		return "", errors.Wrapf(err, "Failed to get page-builder CronJob %s", page)
+	}
+
+	job := &batchv1.Job{}
+	job.ObjectMeta = metav1.ObjectMeta{
+		Name:        fmt.Sprintf("%s-%d", cronJob.Name, q.now().Unix()),
+		Namespace:   cronJob.Namespace,
+		Labels:      cronJob.Spec.JobTemplate.Labels,
+		Annotations: map[string]string{},
+	}
+	for key, value := range cronJob.Spec.JobTemplate.Annotations {
+		job.Annotations[key] = value
+	}
+	cronJob.Spec.JobTemplate.Spec.DeepCopyInto(&job.Spec)
+
+	q.propagateTrace(ctx, job)
+
+	// the Job is owned by the page like its CronJob. A suspended CronJob warns about Jobs it did not create itself
+	if owner := metav1.GetControllerOf(cronJob); owner != nil {
+		job.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+
+	if err := q.client.Create(ctx, job); err != nil && !k8serrors.IsAlreadyExists(err) {
+		span.RecordError(err)
+		return "", errors.Wrapf(err, "Failed to create page-builder Job for %s", page)
+	}
+
+	span.SetAttributes(attribute.String("job", job.Name))
+
+	if owner := metav1.GetControllerOf(cronJob); owner != nil {
+		page := &apiv1.ObjectReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Name:       owner.Name,
+			Namespace:  cronJob.Namespace,
+			UID:        owner.UID,
+		}
+
+		q.recorder.Eventf(page, apiv1.EventTypeNormal, "BuildStarted", "Started %s build in Job %s", build.priority, job.Name)
+	}
+
+	return job.Name, nil
+}
+
+// propagateTrace hands the trace in ctx to the builder of job. The traceparent annotation parents the spans of the
+// build phases, the TRACEPARENT variable lets builder images instrumented with OpenTelemetry join the trace.
+func (q *BuildQueue) propagateTrace(ctx context.Context, job *batchv1.Job) {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	if traceParent := carrier.Get("traceparent"); traceParent != "" {
+		job.Annotations[hugohosterv1beta1.TraceParentAnnotation] = traceParent
+	}
+
+	names := make([]string, 0, len(q.builderEnv))
+	for name := range q.builderEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i := range job.Spec.Template.Spec.Containers {
+		container := &job.Spec.Template.Spec.Containers[i]
+		if container.Name != "page-builder" {
+			continue
+		}
+
+		// the OpenTelemetry configuration of build.env, like OTEL_SERVICE_NAME, takes precedence
+		for _, name := range names {
+			if !hasEnv(container.Env, name) {
+				container.Env = append(container.Env, apiv1.EnvVar{Name: name, Value: q.builderEnv[name]})
+			}
+		}
+
+		for _, key := range carrier.Keys() {
+			container.Env = setEnv(container.Env, strings.ToUpper(key), carrier.Get(key))
+		}
+	}
+}
+
+// hasEnv reports whether env sets the variable name
+func hasEnv(env []apiv1.EnvVar, name string) bool {
+	for _, variable := range env {
+		if variable.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setEnv sets the variable name in env to value
+func setEnv(env []apiv1.EnvVar, name, value string) []apiv1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			env[i] = apiv1.EnvVar{Name: name, Value: value}
+			return env
+		}
+	}
+
+	return append(env, apiv1.EnvVar{Name: name, Value: value})
+}
+
+// updateDepth exports the number of queued builds by priority
+func (q *BuildQueue) updateDepth() {
+	depth := map[BuildPriority]int{}
+	for _, build := range q.queued {
+		depth[build.priority]++
+	}
+
+	for _, priority := range []BuildPriority{BuildPriorityScheduled, BuildPriorityTriggered} {
+		buildQueueDepth.WithLabelValues(priority.String()).Set(float64(depth[priority]))
+	}
+}
+
+func removeQueued(queued []*queuedBuild, page types.NamespacedName) []*queuedBuild {
+	remaining := queued[:0]
+	for _, build := range queued {
+		if build.page != page {
+			remaining = append(remaining, build)
+		}
+	}
+
+	return remaining
+}
+
+// jitteredNext returns when schedule fires next after after, delayed by an offset derived from key.
+// The offset is shorter than the interval of the schedule, so pages sharing a schedule start spread over the interval.
+func jitteredNext(schedule cron.Schedule, key string, after time.Time) time.Time {
+	first := schedule.Next(after)
+	period := schedule.Next(first).Sub(first)
+	if period > maxBuildJitter {
+		period = maxBuildJitter
+	}
+
+	if period < time.Second {
+		return first
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	offset := time.Duration(hash.Sum64() % uint64(period)).Truncate(time.Second)
+
+	return schedule.Next(after.Add(-offset)).Add(offset)
+}
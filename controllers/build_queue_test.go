@@ -0,0 +1,423 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+func builderCronJobFor(name string) *batchv1.CronJob {
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web"}}
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web"},
+		Spec: batchv1.CronJobSpec{
+			Schedule: defaultSchedule,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: makeLabels(page, "builder")},
+			},
+		},
+	}
+}
+
+// runningBuilds returns the pages with an unfinished builder Job
+func runningBuilds(t *testing.T, c client.Client) map[string]*batchv1.Job {
+	jobs := &batchv1.JobList{}
+	if err := c.List(context.Background(), jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	running := map[string]*batchv1.Job{}
+	for i := range jobs.Items {
+		if _, finished := buildStatusFromJob(&jobs.Items[i]); !finished {
+			running[jobs.Items[i].Labels["page"]] = &jobs.Items[i]
+		}
+	}
+
+	return running
+}
+
+func TestBuildQueueLimits(t *testing.T) {
+	c := fake.NewClientBuilder().
+		WithScheme(clientgoscheme.Scheme).
+		WithObjects(builderCronJobFor("a"), builderCronJobFor("b"), builderCronJobFor("c")).
+		Build()
+
+	now := time.Date(2023, 4, 1, 12, 0, 30, 0, time.UTC)
+	queue := NewBuildQueue(c, 2, nil, record.NewFakeRecorder(10), noop.NewTracerProvider().Tracer("build_queue_test"))
+	queue.now = func() time.Time { return now }
+
+	// a and b share a Setting that allows a single build at once
+	for page, setting := range map[string]string{"a": "limited", "b": "limited", "c": "unlimited"} {
+		limit := 0
+		if setting == "limited" {
+			limit = 1
+		}
+
+		if err := queue.Schedule(types.NamespacedName{Name: page, Namespace: "web"}, setting, limit, "@yearly"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue.Enqueue(context.Background(), types.NamespacedName{Name: "a", Namespace: "web"}, BuildPriorityScheduled)
+	now = now.Add(time.Second)
+	queue.Enqueue(context.Background(), types.NamespacedName{Name: "b", Namespace: "web"}, BuildPriorityScheduled)
+	queue.Enqueue(context.Background(), types.NamespacedName{Name: "c", Namespace: "web"}, BuildPriorityTriggered)
+
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	running := runningBuilds(t, c)
+	if len(running) != 2 || running["a"] == nil || running["c"] == nil {
+		t.Fatalf("want the triggered build of c and the oldest build a started, got %v", running)
+	}
+
+	// a running page is not built twice at once
+	queue.Enqueue(context.Background(), types.NamespacedName{Name: "c", Namespace: "web"}, BuildPriorityTriggered)
+	now = now.Add(time.Second)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); len(running) != 2 {
+		t.Fatalf("want limits to hold, got %d running builds", len(running))
+	}
+
+	// once c finished, the cluster limit allows another build, but the Setting of b does not
+	finish(t, c, running["c"])
+	now = now.Add(time.Second)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	running = runningBuilds(t, c)
+	if len(running) != 2 || running["b"] != nil || running["c"] == nil {
+		t.Fatalf("want c built again and b waiting for a, got %v", running)
+	}
+
+	finish(t, c, running["a"])
+	now = now.Add(time.Second)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); running["b"] == nil {
+		t.Fatalf("want b started after a finished, got %v", running)
+	}
+
+	if len(queue.queued) != 0 {
+		t.Errorf("want empty queue, got %d queued builds", len(queue.queued))
+	}
+}
+
+func TestBuildQueueHold(t *testing.T) {
+	c := fake.NewClientBuilder().
+		WithScheme(clientgoscheme.Scheme).
+		WithObjects(builderCronJobFor("a")).
+		Build()
+
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	queue := NewBuildQueue(c, 0, nil, record.NewFakeRecorder(10), noop.NewTracerProvider().Tracer("build_queue_test"))
+	queue.now = func() time.Time { return now }
+
+	page := types.NamespacedName{Name: "a", Namespace: "web"}
+	if err := queue.Schedule(page, "default", 0, "@hourly"); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.Hold(page, true)
+	now = now.Add(2 * time.Hour)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); len(running) != 0 {
+		t.Fatalf("want the scheduled build of a held page skipped, got %v", running)
+	}
+
+	// triggered builds of a held page still run
+	queue.Enqueue(context.Background(), page, BuildPriorityTriggered)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); running["a"] == nil {
+		t.Fatalf("want the triggered build of a started, got %v", running)
+	}
+}
+
+func TestPausedPageStartsNoBuild(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	paused := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{
+		Name:        "a",
+		Namespace:   "web",
+		Annotations: map[string]string{hugohosterv1beta1.PausedAnnotation: "true"},
+	}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(paused, builderCronJobFor("a")).Build()
+
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	tracer := noop.NewTracerProvider().Tracer("build_queue_test")
+	queue := NewBuildQueue(c, 0, nil, record.NewFakeRecorder(10), tracer)
+	queue.now = func() time.Time { return now }
+
+	page := client.ObjectKeyFromObject(paused)
+	if err := queue.Schedule(page, "default", 0, "@hourly"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &HugoPageReconciler{client: c, pageClient: pageClient.NewHugoPageClient(c, "", tracer), buildQueue: queue, tracer: tracer}
+	t.Cleanup(func() { activePages.forget(page) })
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: page}); err != nil {
+		t.Fatal(err)
+	}
+
+	// neither the schedule nor a trigger start a build of a paused page
+	now = now.Add(2 * time.Hour)
+	queue.Enqueue(context.Background(), page, BuildPriorityTriggered)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); len(running) != 0 {
+		t.Fatalf("want no build of a paused page, got %v", running)
+	}
+
+	// the triggered build runs once the page is resumed
+	queue.Pause(page, false)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); running["a"] == nil {
+		t.Fatalf("want the build of the resumed page started, got %v", running)
+	}
+}
+
+func TestBuildQueueSuspend(t *testing.T) {
+	c := fake.NewClientBuilder().
+		WithScheme(clientgoscheme.Scheme).
+		WithObjects(builderCronJobFor("a")).
+		Build()
+
+	queue := NewBuildQueue(c, 0, nil, record.NewFakeRecorder(10), noop.NewTracerProvider().Tracer("build_queue_test"))
+
+	page := types.NamespacedName{Name: "a", Namespace: "web"}
+	if err := queue.Schedule(page, "default", 0, "@yearly"); err != nil {
+		t.Fatal(err)
+	}
+
+	resume, started := queue.Suspend(page)
+	if started {
+		t.Error("want no started build reported before the first build")
+	}
+
+	queue.Enqueue(context.Background(), page, BuildPriorityTriggered)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); len(running) != 0 {
+		t.Fatalf("want no build of a suspended page, got %v", running)
+	}
+
+	resume()
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if running := runningBuilds(t, c); running["a"] == nil {
+		t.Fatalf("want the build started once the page is resumed, got %v", running)
+	}
+
+	// the Job of the build is not listed by a tick yet
+	resume, started = queue.Suspend(page)
+	defer resume()
+
+	if !started {
+		t.Error("want the recently started build reported")
+	}
+}
+
+func TestBuildQueuePropagatesTrace(t *testing.T) {
+	cronJob := builderCronJobFor("a")
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers = []apiv1.Container{{
+		Name: "page-builder",
+		Env:  []apiv1.EnvVar{{Name: "OTEL_SERVICE_NAME", Value: "my-blog"}},
+	}}
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(cronJob).Build()
+
+	builderEnv := map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SERVICE_NAME": "hugo-hoster-builder"}
+	queue := NewBuildQueue(c, 0, builderEnv, record.NewFakeRecorder(10), sdkTrace.NewTracerProvider().Tracer("build_queue_test"))
+
+	// the build continues the trace of the reconcile that triggered it
+	trigger, span := sdkTrace.NewTracerProvider().Tracer("build_queue_test").Start(context.Background(), "Reconcile")
+	span.End()
+
+	page := types.NamespacedName{Name: "a", Namespace: "web"}
+	if err := queue.Schedule(page, "default", 0, "@yearly"); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.Enqueue(trigger, page, BuildPriorityTriggered)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	job := runningBuilds(t, c)["a"]
+	if job == nil {
+		t.Fatal("want the build of a started")
+	}
+
+	traceParent := job.Annotations[hugohosterv1beta1.TraceParentAnnotation]
+	if !strings.HasPrefix(traceParent, "00-"+span.SpanContext().TraceID().String()+"-") {
+		t.Errorf("want traceparent in the trace of the trigger, got %q", traceParent)
+	}
+
+	env := map[string]string{}
+	for _, variable := range job.Spec.Template.Spec.Containers[0].Env {
+		env[variable.Name] = variable.Value
+	}
+
+	want := map[string]string{
+		"TRACEPARENT":                 traceParent,
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+		"OTEL_SERVICE_NAME":           "my-blog",
+	}
+
+	for name, value := range want {
+		if env[name] != value {
+			t.Errorf("want %s=%q, got %q", name, value, env[name])
+		}
+	}
+}
+
+func finish(t *testing.T, c client.Client, job *batchv1.Job) {
+	job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+		Type:   batchv1.JobComplete,
+		Status: apiv1.ConditionTrue,
+	})
+
+	if err := c.Status().Update(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJitteredNext(t *testing.T) {
+	schedule, err := cron.ParseStandard(defaultSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := time.Date(2023, 4, 1, 12, 1, 0, 0, time.UTC)
+
+	starts := map[time.Time]bool{}
+	for _, page := range []string{"web/a", "web/b", "web/c", "web/d"} {
+		next := jitteredNext(schedule, page, after)
+		if next != jitteredNext(schedule, page, after) {
+			t.Errorf("jitter of %s is not deterministic", page)
+		}
+
+		if !next.After(after) || next.Sub(after) > 10*time.Minute {
+			t.Errorf("next build of %s at %s is not within the next two intervals", page, next)
+		}
+
+		if following := jitteredNext(schedule, page, next); following.Sub(next) != 5*time.Minute {
+			t.Errorf("builds of %s at %s and %s do not keep the schedule interval", page, next, following)
+		}
+
+		starts[next] = true
+	}
+
+	if len(starts) < 2 {
+		t.Error("pages sharing a schedule start at the same time")
+	}
+}
+
+func TestBuildQueueTickDoesNotBlockQueue(t *testing.T) {
+	var queue *BuildQueue
+	blocked := false
+
+	c := fake.NewClientBuilder().
+		WithScheme(clientgoscheme.Scheme).
+		WithObjects(builderCronJobFor("a")).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				// a reconcile enqueues a build while the API server handles the request of the tick
+				enqueued := make(chan struct{})
+				go func() {
+					queue.Enqueue(ctx, types.NamespacedName{Name: "b", Namespace: "web"}, BuildPriorityTriggered)
+					close(enqueued)
+				}()
+
+				select {
+				case <-enqueued:
+				case <-time.After(5 * time.Second):
+					blocked = true
+				}
+
+				return c.Create(ctx, obj, opts...)
+			},
+		}).
+		Build()
+
+	queue = NewBuildQueue(c, 0, nil, record.NewFakeRecorder(10), noop.NewTracerProvider().Tracer("build_queue_test"))
+	for _, page := range []string{"a", "b"} {
+		if err := queue.Schedule(types.NamespacedName{Name: page, Namespace: "web"}, "settings", 0, "@yearly"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue.Enqueue(context.Background(), types.NamespacedName{Name: "a", Namespace: "web"}, BuildPriorityScheduled)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if blocked {
+		t.Fatal("want Enqueue not to wait for the API calls of a tick")
+	}
+
+	if len(queue.queued) != 1 || queue.queued[0].page.Name != "b" {
+		t.Errorf("want the build of b enqueued during the tick to stay queued, got %v", queue.queued)
+	}
+}
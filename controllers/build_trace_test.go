@@ -0,0 +1,109 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestParseBuildPhases(t *testing.T) {
+	finished := time.Unix(1680350500, 0)
+
+	details := parseTerminationMessage("CLONE_START=1680350400.250000\nCLONE_END=1680350410,5\nCOMMIT=abc\nHUGO_START=1680350411\n")
+	phases := parseBuildPhases(details, finished)
+
+	if len(phases) != 2 {
+		t.Fatalf("want the clone and hugo phases, got %v", phases)
+	}
+
+	if clone := phases[0]; !clone.finished || clone.start != time.Unix(1680350400, 250000000) || clone.end != time.Unix(1680350410, 500000000) {
+		t.Errorf("want clone from .25 to .5, got %v", clone)
+	}
+
+	// the build failed in hugo, so the phase ends with the builder
+	if hugo := phases[1]; hugo.finished || !hugo.end.Equal(finished) {
+		t.Errorf("want unfinished hugo phase ending at %v, got %v", finished, hugo)
+	}
+
+	if phases := parseBuildPhases(parseTerminationMessage("COMMIT=abc"), finished); len(phases) != 0 {
+		t.Errorf("want no phases of a builder not recording them, got %v", phases)
+	}
+}
+
+func TestTraceBuild(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	r := &HugoPageReconciler{tracer: sdkTrace.NewTracerProvider(sdkTrace.WithSpanProcessor(recorder)).Tracer("build_trace_test")}
+
+	started := metav1.NewTime(time.Unix(1680350400, 0))
+	finished := metav1.NewTime(time.Unix(1680350500, 0))
+
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:        "blog-1680350400",
+		Annotations: map[string]string{hugohosterv1beta1.TraceParentAnnotation: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}}
+	build := hugohosterv1beta1.BuildStatus{Number: 3, Result: hugohosterv1beta1.BuildResultFailed, StartTime: &started, CompletionTime: &finished}
+	phases := []buildPhase{
+		{name: "clone", start: started.Time, end: started.Add(10 * time.Second), finished: true},
+		{name: "hugo", start: started.Add(10 * time.Second), end: finished.Time},
+	}
+
+	r.traceBuild(context.Background(), page, job, build, phases)
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("want builder, clone and hugo spans, got %d", len(spans))
+	}
+
+	builder := spans[2]
+	if builder.Name() != "builder" || builder.Parent().SpanID().String() != "00f067aa0ba902b7" || builder.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("want builder span continuing the propagated trace, got %s with parent %s", builder.Name(), builder.Parent().SpanID())
+	}
+
+	if builder.Status().Code != codes.Error || !builder.EndTime().Equal(finished.Time) {
+		t.Errorf("want failed builder span ending at %v, got %v at %v", finished.Time, builder.Status().Code, builder.EndTime())
+	}
+
+	for i, name := range []string{"builder.clone", "builder.hugo"} {
+		if spans[i].Name() != name || spans[i].Parent().SpanID() != builder.SpanContext().SpanID() {
+			t.Errorf("want %s as child of the builder span, got %s", name, spans[i].Name())
+		}
+	}
+
+	if spans[1].Status().Code != codes.Error {
+		t.Error("want the hugo phase the build failed in marked as error")
+	}
+
+	// Jobs without a propagated trace are not traced
+	recorder = tracetest.NewSpanRecorder()
+	r.tracer = sdkTrace.NewTracerProvider(sdkTrace.WithSpanProcessor(recorder)).Tracer("build_trace_test")
+	r.traceBuild(context.Background(), page, &batchv1.Job{}, build, phases)
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("want no spans without a traceparent, got %d", len(spans))
+	}
+}
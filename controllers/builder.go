@@ -0,0 +1,638 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBuildTimeout = 30 * time.Minute
+
+	// jobReasonDeadlineExceeded is the reason of the Failed condition of a Job that ran longer than activeDeadlineSeconds
+	jobReasonDeadlineExceeded = "DeadlineExceeded"
+
+	// successfulBuildsHistoryLimit and failedBuildsHistoryLimit are the numbers of finished builder Jobs kept per page
+	successfulBuildsHistoryLimit = 3
+	failedBuildsHistoryLimit     = 10
+)
+
+// builderSpec returns the builder configuration of page, with every empty field taken from settings
+func builderSpec(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) hugohosterv1beta1.BuilderSpec {
+	spec := *page.Spec.Build.BuilderSpec.DeepCopy()
+	defaults := settings.Spec.Build.DeepCopy()
+
+	if spec.Resources == nil {
+		spec.Resources = defaults.Resources
+	}
+
+	if spec.NodeSelector == nil {
+		spec.NodeSelector = defaults.NodeSelector
+	}
+
+	if spec.Tolerations == nil {
+		spec.Tolerations = defaults.Tolerations
+	}
+
+	if spec.Timeout == nil {
+		spec.Timeout = defaults.Timeout
+	}
+
+	if spec.Timeout == nil {
+		spec.Timeout = &metav1.Duration{Duration: defaultBuildTimeout}
+	}
+
+	if spec.BackoffLimit == nil {
+		spec.BackoffLimit = defaults.BackoffLimit
+	}
+
+	return spec
+}
+
+// builderImage returns the image building page. An explicit image takes precedence over
+// the Hugo version, which is looked up in the Hugo versions of the Setting.
+func builderImage(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (string, error) {
+	if page.Spec.Build.Image != "" {
+		return page.Spec.Build.Image, nil
+	}
+
+	if page.Spec.Build.HugoVersion == "" {
+		return hugohosterv1beta1.DefaultBuilderImage, nil
+	}
+
+	for _, version := range settings.Spec.HugoVersions {
+		if version.Version == page.Spec.Build.HugoVersion && version.Extended == page.Spec.Build.Extended {
+			return version.Image, nil
+		}
+	}
+
+	edition := ""
+	if page.Spec.Build.Extended {
+		edition = " extended"
+	}
+
+	return "", errors.Errorf("Hugo%s %s is not configured in %s %s", edition, page.Spec.Build.HugoVersion, settings.Kind, settings.Name)
+}
+
+// s3Credentials returns the S3 credentials page is built with. Previews of forks are built with the
+// fork preview credentials of settings, so it returns an error if settings have none
+func s3Credentials(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (hugohosterv1beta1.S3CredentialsSecretRef, error) {
+	if page.Annotations[hugohosterv1beta1.ForkPreviewAnnotation] != "true" {
+		return settings.Spec.Storage.S3.CredentialsSecret, nil
+	}
+
+	if settings.Spec.Storage.S3.ForkPreviewCredentialsSecret == nil {
+		return hugohosterv1beta1.S3CredentialsSecretRef{}, errors.Errorf("previews of forks require storage.s3.forkPreviewCredentialsSecret to be configured in %s %s", settings.Kind, settings.Name)
+	}
+
+	return *settings.Spec.Storage.S3.ForkPreviewCredentialsSecret, nil
+}
+
+// builderJobSpec returns the spec of the Job building page
+func builderJobSpec(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, credentialsSecretName string) (batchv1.JobSpec, error) {
+	builder := builderSpec(page, settings)
+
+	credentials, err := s3Credentials(page, settings)
+	if err != nil {
+		return batchv1.JobSpec{}, reconcile.TerminalError(err)
+	}
+
+	builderContainerImage, err := builderImage(page, settings)
+	if err != nil {
+		return batchv1.JobSpec{}, reconcile.TerminalError(err)
+	}
+
+	imagePullPolicy := apiv1.PullIfNotPresent
+	if page.Spec.Build.ImagePullPolicy != "" {
+		imagePullPolicy = page.Spec.Build.ImagePullPolicy
+	}
+
+	branch := defaultBranch
+	if page.Spec.Source.Branch != "" {
+		branch = page.Spec.Source.Branch
+	}
+
+	activeDeadlineSeconds := int64(builder.Timeout.Seconds())
+
+	resources := apiv1.ResourceRequirements{}
+	if builder.Resources != nil {
+		resources = *builder.Resources
+	}
+
+	env := []apiv1.EnvVar{
+		{
+			Name:  "REPO_URL",
+			Value: page.Spec.Source.Repository,
+		},
+		{
+			Name:  "GIT_BRANCH",
+			Value: branch,
+		},
+		{
+			Name:  "PAGE_NAME",
+			Value: page.Name,
+		},
+		{
+			Name:  "PAGE_PATH",
+			Value: pagePrefix(page),
+		},
+		{
+			Name:  "S3_BUCKET_NAME",
+			Value: settings.Spec.Storage.S3.Bucket,
+		},
+		{
+			Name: "AWS_ACCESS_KEY_ID",
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{
+						Name: credentialsSecretName,
+					},
+					Key: credentials.AccessKeyIDKey,
+				},
+			},
+		},
+		{
+			Name: "AWS_SECRET_ACCESS_KEY",
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{
+						Name: credentialsSecretName,
+					},
+					Key: credentials.SecretAccessKeyKey,
+				},
+			},
+		},
+		{
+			Name:  "S3_ENDPOINT",
+			Value: settings.Spec.Storage.S3.Endpoint,
+		},
+	}
+
+	volumeMounts := []apiv1.VolumeMount{
+		{
+			Name:      "hugo-buildcmd",
+			MountPath: "/home/builder/build-hugo.sh",
+			SubPath:   "build-hugo.sh",
+			ReadOnly:  true,
+		},
+	}
+
+	volumes := []apiv1.Volume{
+		{
+			Name: "hugo-buildcmd",
+			VolumeSource: apiv1.VolumeSource{
+				ConfigMap: &apiv1.ConfigMapVolumeSource{
+					LocalObjectReference: apiv1.LocalObjectReference{
+						Name: fmt.Sprintf("nginx-proxy-conf-%s", page.Name),
+					},
+				},
+			},
+		},
+	}
+
+	if page.Spec.Build.Cache != nil {
+		// Hugo reads its configuration from HUGO_ prefixed variables, so the
+		// generated resources are kept in the cache instead of the cloned repository
+		env = append(env,
+			apiv1.EnvVar{Name: "HUGO_CACHEDIR", Value: cacheMountPath + "/hugo"},
+			apiv1.EnvVar{Name: "HUGO_RESOURCEDIR", Value: cacheMountPath + "/resources"},
+		)
+
+		volumeMounts = append(volumeMounts, apiv1.VolumeMount{
+			Name:      "build-cache",
+			MountPath: cacheMountPath,
+		})
+
+		volumes = append(volumes, apiv1.Volume{
+			Name: "build-cache",
+			VolumeSource: apiv1.VolumeSource{
+				PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{
+					ClaimName: buildCacheName(page),
+				},
+			},
+		})
+	}
+
+	if err := validateBuildEnv(page.Spec.Build.Env, env); err != nil {
+		return batchv1.JobSpec{}, err
+	}
+
+	if err := validateBuildEnvFrom(page.Spec.Build.EnvFrom, env); err != nil {
+		return batchv1.JobSpec{}, err
+	}
+
+	env = append(env, page.Spec.Build.Env...)
+
+	jobSpec := batchv1.JobSpec{
+		ActiveDeadlineSeconds: &activeDeadlineSeconds,
+		BackoffLimit:          builder.BackoffLimit,
+		Template: apiv1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: makeLabels(page, "builder"),
+			},
+			Spec: apiv1.PodSpec{
+				RestartPolicy: apiv1.RestartPolicyOnFailure,
+				NodeSelector:  builder.NodeSelector,
+				Tolerations:   builder.Tolerations,
+				Containers: []apiv1.Container{
+					{
+						Name:            "page-builder",
+						Image:           builderContainerImage,
+						ImagePullPolicy: imagePullPolicy,
+						Resources:       resources,
+						Env:             env,
+						EnvFrom:         page.Spec.Build.EnvFrom,
+						VolumeMounts:    volumeMounts,
+					},
+				},
+				Volumes: volumes,
+			},
+		},
+	}
+
+	return jobSpec, nil
+}
+
+// reservedEnvPrefixes can not be set through build.env, as they would redirect the upload of the page
+// or the telemetry of the builder
+var reservedEnvPrefixes = []string{"AWS_", "S3_", "OTEL_EXPORTER_OTLP_"}
+
+// reservedEnvNames are set on the builder when its build is started, so they are not part of its job template
+var reservedEnvNames = []string{"TRACEPARENT", "TRACESTATE"}
+
+// validateBuildEnv rejects variables of env that would override a variable set by hugo-hoster
+func validateBuildEnv(env []apiv1.EnvVar, reserved []apiv1.EnvVar) error {
+	for _, variable := range env {
+		for _, reservedVariable := range reserved {
+			if variable.Name == reservedVariable.Name {
+				return reconcile.TerminalError(errors.Errorf("build.env must not set %s, it is set by hugo-hoster", variable.Name))
+			}
+		}
+
+		for _, name := range reservedEnvNames {
+			if variable.Name == name {
+				return reconcile.TerminalError(errors.Errorf("build.env must not set %s, it is set by hugo-hoster to trace the build", variable.Name))
+			}
+		}
+
+		for _, prefix := range reservedEnvPrefixes {
+			if strings.HasPrefix(variable.Name, prefix) {
+				return reconcile.TerminalError(errors.Errorf("build.env must not set %s, variables prefixed with %s are reserved", variable.Name, prefix))
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateBuildEnvFrom rejects sources of envFrom that could set a variable set by hugo-hoster or a reserved variable.
+// The keys of ConfigMaps and Secrets are not known up front, so every source needs a prefix that no reserved name can
+// start with, e.g. HUGO_PARAMS_
+func validateBuildEnvFrom(envFrom []apiv1.EnvFromSource, reserved []apiv1.EnvVar) error {
+	for _, source := range envFrom {
+		if source.Prefix == "" {
+			return reconcile.TerminalError(errors.New("build.envFrom must set a prefix, the variables could override those set by hugo-hoster"))
+		}
+
+		for _, reservedVariable := range reserved {
+			if strings.HasPrefix(reservedVariable.Name, source.Prefix) {
+				return reconcile.TerminalError(errors.Errorf("build.envFrom must not use the prefix %s, it could set %s that is set by hugo-hoster", source.Prefix, reservedVariable.Name))
+			}
+		}
+
+		for _, name := range reservedEnvNames {
+			if strings.HasPrefix(name, source.Prefix) {
+				return reconcile.TerminalError(errors.Errorf("build.envFrom must not use the prefix %s, it could set %s that is set by hugo-hoster to trace the build", source.Prefix, name))
+			}
+		}
+
+		for _, prefix := range reservedEnvPrefixes {
+			if strings.HasPrefix(source.Prefix, prefix) || strings.HasPrefix(prefix, source.Prefix) {
+				return reconcile.TerminalError(errors.Errorf("build.envFrom must not use the prefix %s, variables prefixed with %s are reserved", source.Prefix, prefix))
+			}
+		}
+	}
+
+	return nil
+}
+
+// updateBuildStatus sets the last build of page from the most recently finished builder Job
+// and reports a new build to the forge and the notification sinks
+func (r *HugoPageReconciler) updateBuildStatus(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) error {
+	jobs := &batchv1.JobList{}
+	if err := r.client.List(ctx, jobs, client.InNamespace(page.Namespace), client.MatchingLabels(makeLabels(page, "builder"))); err != nil {
+		return errors.Wrap(err, "Failed to list page-builder Jobs")
+	}
+
+	if err := r.pruneBuilderJobs(ctx, jobs.Items); err != nil {
+		return err
+	}
+
+	status := page.Status.DeepCopy()
+	status.ObservedGeneration = page.Generation
+
+	var lastJob *batchv1.Job
+	lastBuild := hugohosterv1beta1.BuildStatus{}
+
+	for i := range jobs.Items {
+		build, finished := buildStatusFromJob(&jobs.Items[i])
+		if !finished {
+			if err := r.reportBuildPending(ctx, page, settings, &jobs.Items[i], status.LastBuild.Number+1); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if lastBuild.CompletionTime == nil || lastBuild.CompletionTime.Before(build.CompletionTime) {
+			lastJob = &jobs.Items[i]
+			lastBuild = build
+		}
+	}
+
+	previous := status.LastBuild
+	newBuild := false
+	var phases []buildPhase
+
+	// The details of a build are only read once, as the pods of a Job are gone before the Job is
+	if lastJob != nil && !lastBuild.CompletionTime.Equal(status.LastBuild.CompletionTime) {
+		lastBuild.Number = status.LastBuild.Number + 1
+
+		var err error
+		if phases, err = r.readBuildDetails(ctx, page, lastJob, &lastBuild); err != nil {
+			return err
+		}
+
+		status.LastBuild = lastBuild
+		if lastBuild.Result == hugohosterv1beta1.BuildResultSuccess {
+			status.LastSuccessTime = lastBuild.CompletionTime
+		}
+
+		newBuild = true
+	}
+
+	if equality.Semantic.DeepEqual(*status, page.Status) {
+		return nil
+	}
+
+	page.Status = *status
+	if err := r.client.Status().Update(ctx, page); err != nil {
+		return errors.Wrap(err, "Failed to update HugoPage status")
+	}
+
+	if newBuild {
+		observeBuild(page, previous, lastBuild)
+		activePages.track(page)
+		r.recordBuildEvent(page, lastBuild)
+		r.traceBuild(ctx, page, lastJob, lastBuild, phases)
+
+		// a commit rebuilt with the same result is not reported again, as forges keep every status
+		if lastBuild.Commit != previous.Commit || lastBuild.Result != previous.Result {
+			state, description := buildCommitStatus(page, lastBuild)
+			r.reportCommitStatus(ctx, page, settings, lastBuild.Commit, state, description)
+		}
+
+		r.notifyBuild(ctx, page, settings, previous.Result, lastBuild, lastJob.Name)
+	}
+
+	return nil
+}
+
+// recordBuildEvent records the end of build as an event of page
+func (r *HugoPageReconciler) recordBuildEvent(page *hugohosterv1beta1.HugoPage, build hugohosterv1beta1.BuildStatus) {
+	commit := build.Commit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+
+	duration := ""
+	if build.StartTime != nil {
+		duration = " after " + build.CompletionTime.Sub(build.StartTime.Time).Round(time.Second).String()
+	}
+
+	switch build.Result {
+	case hugohosterv1beta1.BuildResultSuccess:
+		r.recorder.Eventf(page, apiv1.EventTypeNormal, "BuildSucceeded", "Build #%d of commit %s published %d files%s", build.Number, commit, build.PublishedFiles, duration)
+
+	case hugohosterv1beta1.BuildResultCancelled:
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "BuildCancelled", "Build #%d exceeded its timeout and was cancelled%s, see kubectl hugo logs %s --build %d", build.Number, duration, page.Name, build.Number)
+
+	default:
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "BuildFailed", "Build #%d failed%s, see kubectl hugo logs %s --build %d", build.Number, duration, page.Name, build.Number)
+	}
+}
+
+// pruneBuilderJobs deletes the oldest finished Jobs beyond the history limits, like a CronJob does for the Jobs it started
+func (r *HugoPageReconciler) pruneBuilderJobs(ctx context.Context, jobs []batchv1.Job) error {
+	successful := []*batchv1.Job{}
+	failed := []*batchv1.Job{}
+
+	for i := range jobs {
+		build, finished := buildStatusFromJob(&jobs[i])
+		if !finished {
+			continue
+		}
+
+		if build.Result == hugohosterv1beta1.BuildResultSuccess {
+			successful = append(successful, &jobs[i])
+		} else {
+			failed = append(failed, &jobs[i])
+		}
+	}
+
+	for _, history := range []struct {
+		jobs  []*batchv1.Job
+		limit int
+	}{{successful, successfulBuildsHistoryLimit}, {failed, failedBuildsHistoryLimit}} {
+		if len(history.jobs) <= history.limit {
+			continue
+		}
+
+		sort.Slice(history.jobs, func(i, j int) bool {
+			return history.jobs[i].CreationTimestamp.Before(&history.jobs[j].CreationTimestamp)
+		})
+
+		for _, job := range history.jobs[:len(history.jobs)-history.limit] {
+			if err := r.client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !k8serrors.IsNotFound(err) {
+				return errors.Wrapf(err, "Failed to delete page-builder Job %s", job.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// triggerBuild queues a build of page with priority if the trigger-build annotation changed
+func (r *HugoPageReconciler) triggerBuild(ctx context.Context, page *hugohosterv1beta1.HugoPage) error {
+	trigger := page.Annotations[hugohosterv1beta1.TriggerBuildAnnotation]
+	if trigger == "" || trigger == page.Status.LastTrigger {
+		return nil
+	}
+
+	r.buildQueue.Enqueue(ctx, client.ObjectKeyFromObject(page), BuildPriorityTriggered)
+	r.recorder.Eventf(page, apiv1.EventTypeNormal, "BuildTriggered", "Queued build triggered by %s", trigger)
+
+	page.Status.LastTrigger = trigger
+	if err := r.client.Status().Update(ctx, page); err != nil {
+		return errors.Wrap(err, "Failed to update HugoPage status")
+	}
+
+	return nil
+}
+
+// readBuildDetails sets the commit, Hugo version and published size of build from the termination message of the builder
+// and stores its log. It returns the phases of the build the builder recorded
+func (r *HugoPageReconciler) readBuildDetails(ctx context.Context, page *hugohosterv1beta1.HugoPage, job *batchv1.Job, build *hugohosterv1beta1.BuildStatus) ([]buildPhase, error) {
+	pods := &apiv1.PodList{}
+	if err := r.apiReader.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return nil, errors.Wrap(err, "Failed to list page-builder Pods")
+	}
+
+	var last *apiv1.ContainerStateTerminated
+	lastPod := ""
+	lastPrevious := false
+
+	for _, pod := range pods.Items {
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.Name != "page-builder" {
+				continue
+			}
+
+			for i, terminated := range []*apiv1.ContainerStateTerminated{container.State.Terminated, container.LastTerminationState.Terminated} {
+				if terminated != nil && (last == nil || last.FinishedAt.Before(&terminated.FinishedAt)) {
+					last = terminated
+					lastPod = pod.Name
+					lastPrevious = i == 1
+				}
+			}
+		}
+	}
+
+	if last == nil {
+		return nil, nil
+	}
+
+	details := parseTerminationMessage(last.Message)
+	build.Commit = details["COMMIT"]
+	build.HugoVersion = parseHugoVersion(details["HUGO_VERSION"])
+
+	if commitTime, err := strconv.ParseInt(details["COMMIT_TIME"], 10, 64); err == nil {
+		build.CommitTime = &metav1.Time{Time: time.Unix(commitTime, 0)}
+	}
+
+	if size, err := strconv.ParseInt(strings.TrimSpace(details["PUBLISHED_BYTES"]), 10, 64); err == nil {
+		build.PublishedBytes = size
+	}
+
+	if files, err := strconv.ParseInt(strings.TrimSpace(details["PUBLISHED_FILES"]), 10, 32); err == nil {
+		build.PublishedFiles = int32(files)
+	}
+
+	return parseBuildPhases(details, last.FinishedAt.Time), r.storeBuildLog(ctx, page, lastPod, lastPrevious, build)
+}
+
+// parseTerminationMessage parses the KEY=VALUE lines the build script writes to its termination message
+func parseTerminationMessage(message string) map[string]string {
+	details := make(map[string]string)
+
+	for _, line := range strings.Split(message, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok {
+			details[key] = value
+		}
+	}
+
+	return details
+}
+
+// parseHugoVersion returns the version from the output of `hugo version`, e.g.
+// "hugo v0.111.3-5d4eb5154e1fed125ca8e9b5a0315c4180dab192+extended linux/amd64 BuildDate=..." is 0.111.3+extended
+func parseHugoVersion(output string) string {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != "hugo" {
+		return ""
+	}
+
+	version, edition, _ := strings.Cut(fields[1], "+")
+	version, _, _ = strings.Cut(strings.TrimPrefix(version, "v"), "-")
+
+	if edition != "" {
+		return version + "+" + edition
+	}
+
+	return version
+}
+
+// buildStatusFromJob returns the build status of a finished Job. It reports false if the Job is still running
+func buildStatusFromJob(job *batchv1.Job) (hugohosterv1beta1.BuildStatus, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != apiv1.ConditionTrue {
+			continue
+		}
+
+		completionTime := condition.LastTransitionTime
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			if job.Status.CompletionTime != nil {
+				completionTime = *job.Status.CompletionTime
+			}
+
+			return hugohosterv1beta1.BuildStatus{StartTime: job.Status.StartTime, CompletionTime: &completionTime, Result: hugohosterv1beta1.BuildResultSuccess}, true
+
+		case batchv1.JobFailed:
+			result := hugohosterv1beta1.BuildResultFailed
+			if condition.Reason == jobReasonDeadlineExceeded {
+				result = hugohosterv1beta1.BuildResultCancelled
+			}
+
+			return hugohosterv1beta1.BuildStatus{StartTime: job.Status.StartTime, CompletionTime: &completionTime, Result: result}, true
+		}
+	}
+
+	return hugohosterv1beta1.BuildStatus{}, false
+}
+
+// pageForBuilderJob maps a builder Job to the Hugo Page it builds
+func pageForBuilderJob(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels["app"] != "hugo-hoster" || labels["component"] != "builder" || labels["page"] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: labels["page"], Namespace: obj.GetNamespace()}},
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+func TestBuildStatusFromJob(t *testing.T) {
+	finishedAt := metav1.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		conditions []batchv1.JobCondition
+		finished   bool
+		result     hugohosterv1beta1.BuildResult
+	}{
+		{
+			name:     "running",
+			finished: false,
+		},
+		{
+			name:       "complete",
+			conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: apiv1.ConditionTrue, LastTransitionTime: finishedAt}},
+			finished:   true,
+			result:     hugohosterv1beta1.BuildResultSuccess,
+		},
+		{
+			name:       "failed",
+			conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: apiv1.ConditionTrue, Reason: "BackoffLimitExceeded", LastTransitionTime: finishedAt}},
+			finished:   true,
+			result:     hugohosterv1beta1.BuildResultFailed,
+		},
+		{
+			name:       "timed out",
+			conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: apiv1.ConditionTrue, Reason: "DeadlineExceeded", LastTransitionTime: finishedAt}},
+			finished:   true,
+			result:     hugohosterv1beta1.BuildResultCancelled,
+		},
+		{
+			name:       "suspended",
+			conditions: []batchv1.JobCondition{{Type: batchv1.JobSuspended, Status: apiv1.ConditionTrue, LastTransitionTime: finishedAt}},
+			finished:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &batchv1.Job{Status: batchv1.JobStatus{Conditions: tt.conditions}}
+
+			build, finished := buildStatusFromJob(job)
+			if finished != tt.finished {
+				t.Fatalf("want finished %v, got %v", tt.finished, finished)
+			}
+
+			if !finished {
+				return
+			}
+
+			if build.Result != tt.result {
+				t.Errorf("want result %s, got %s", tt.result, build.Result)
+			}
+
+			if build.CompletionTime == nil || !build.CompletionTime.Equal(&finishedAt) {
+				t.Errorf("want completion time %v, got %v", finishedAt, build.CompletionTime)
+			}
+		})
+	}
+}
+
+func TestParseHugoVersion(t *testing.T) {
+	tests := map[string]string{
+		"hugo v0.111.3-5d4eb5154e1fed125ca8e9b5a0315c4180dab192+extended linux/amd64 BuildDate=2023-03-12T11:40:50Z": "0.111.3+extended",
+		"hugo v0.111.3-5d4eb5154e1fed125ca8e9b5a0315c4180dab192 linux/amd64 BuildDate=2023-03-12T11:40:50Z":          "0.111.3",
+		"hugo v0.92.2+extended linux/amd64 BuildDate=unknown":                                                        "0.92.2+extended",
+		"bash: hugo: command not found": "",
+		"":                              "",
+	}
+
+	for output, want := range tests {
+		if got := parseHugoVersion(output); got != want {
+			t.Errorf("parseHugoVersion(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
+
+func TestBuilderImage(t *testing.T) {
+	settings := &pageClient.ResolvedSetting{
+		Kind: hugohosterv1beta1.SettingKind,
+		Name: "settings",
+		Spec: hugohosterv1beta1.SettingSpec{
+			HugoVersions: []hugohosterv1beta1.HugoVersionSpec{
+				{Version: "0.111.3", Image: "builder:0.111.3"},
+				{Version: "0.111.3", Extended: true, Image: "builder:0.111.3-extended"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		build   hugohosterv1beta1.BuildSpec
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: hugohosterv1beta1.DefaultBuilderImage},
+		{name: "image", build: hugohosterv1beta1.BuildSpec{Image: "custom:1", HugoVersion: "0.111.3"}, want: "custom:1"},
+		{name: "version", build: hugohosterv1beta1.BuildSpec{HugoVersion: "0.111.3"}, want: "builder:0.111.3"},
+		{name: "extended", build: hugohosterv1beta1.BuildSpec{HugoVersion: "0.111.3", Extended: true}, want: "builder:0.111.3-extended"},
+		{name: "unknown version", build: hugohosterv1beta1.BuildSpec{HugoVersion: "0.100.0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &hugohosterv1beta1.HugoPage{Spec: hugohosterv1beta1.HugoPageSpec{Build: tt.build}}
+
+			got, err := builderImage(page, settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want image %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateBuildEnv(t *testing.T) {
+	reserved := []apiv1.EnvVar{{Name: "REPO_URL"}, {Name: "HUGO_CACHEDIR"}}
+
+	tests := []struct {
+		name    string
+		env     []apiv1.EnvVar
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "hugo variables", env: []apiv1.EnvVar{{Name: "HUGO_ENV", Value: "production"}, {Name: "HUGO_PARAMS_API_TOKEN"}}},
+		{name: "reserved variable", env: []apiv1.EnvVar{{Name: "HUGO_CACHEDIR", Value: "/tmp"}}, wantErr: true},
+		{name: "reserved prefix", env: []apiv1.EnvVar{{Name: "AWS_SECRET_ACCESS_KEY"}}, wantErr: true},
+		{name: "reserved prefix not set by hugo-hoster", env: []apiv1.EnvVar{{Name: "AWS_ENDPOINT_URL"}}, wantErr: true},
+		{name: "traceparent", env: []apiv1.EnvVar{{Name: "TRACEPARENT", Value: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}, wantErr: true},
+		{name: "otlp exporter", env: []apiv1.EnvVar{{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: "http://collector:4318"}}, wantErr: true},
+		{name: "otel service name", env: []apiv1.EnvVar{{Name: "OTEL_SERVICE_NAME", Value: "blog-builder"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBuildEnv(tt.env, reserved); (err != nil) != tt.wantErr {
+				t.Errorf("want error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateBuildEnvFrom(t *testing.T) {
+	reserved := []apiv1.EnvVar{{Name: "REPO_URL"}, {Name: "HUGO_CACHEDIR"}}
+	secret := &apiv1.SecretEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "tokens"}}
+
+	tests := []struct {
+		name    string
+		envFrom []apiv1.EnvFromSource
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "hugo params", envFrom: []apiv1.EnvFromSource{{Prefix: "HUGO_PARAMS_", SecretRef: secret}}},
+		{name: "no prefix", envFrom: []apiv1.EnvFromSource{{SecretRef: secret}}, wantErr: true},
+		{name: "prefix of a reserved variable", envFrom: []apiv1.EnvFromSource{{Prefix: "HUGO_", SecretRef: secret}}, wantErr: true},
+		{name: "reserved prefix", envFrom: []apiv1.EnvFromSource{{Prefix: "AWS_", SecretRef: secret}}, wantErr: true},
+		{name: "prefix of a reserved prefix", envFrom: []apiv1.EnvFromSource{{Prefix: "S", SecretRef: secret}}, wantErr: true},
+		{name: "within a reserved prefix", envFrom: []apiv1.EnvFromSource{{Prefix: "S3_EXTRA_", SecretRef: secret}}, wantErr: true},
+		{name: "prefix of traceparent", envFrom: []apiv1.EnvFromSource{{Prefix: "TRACE", SecretRef: secret}}, wantErr: true},
+		{name: "otel prefix", envFrom: []apiv1.EnvFromSource{{Prefix: "OTEL_", SecretRef: secret}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBuildEnvFrom(tt.envFrom, reserved); (err != nil) != tt.wantErr {
+				t.Errorf("want error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRecordBuildEvent(t *testing.T) {
+	started := metav1.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	finished := metav1.NewTime(started.Add(95 * time.Second))
+
+	tests := []struct {
+		name   string
+		result hugohosterv1beta1.BuildResult
+		want   string
+	}{
+		{name: "success", result: hugohosterv1beta1.BuildResultSuccess, want: "Normal BuildSucceeded Build #4 of commit 5d4eb51 published 12 files after 1m35s"},
+		{name: "failure", result: hugohosterv1beta1.BuildResultFailed, want: "Warning BuildFailed Build #4 failed after 1m35s, see kubectl hugo logs blog --build 4"},
+		{name: "timeout", result: hugohosterv1beta1.BuildResultCancelled, want: "Warning BuildCancelled Build #4 exceeded its timeout and was cancelled after 1m35s, see kubectl hugo logs blog --build 4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			r := &HugoPageReconciler{recorder: recorder}
+
+			page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+			r.recordBuildEvent(page, hugohosterv1beta1.BuildStatus{
+				Number:         4,
+				Result:         tt.result,
+				Commit:         "5d4eb5154e1fed125ca8e9b5a0315c4180dab192",
+				StartTime:      &started,
+				CompletionTime: &finished,
+				PublishedFiles: 12,
+			})
+
+			if got := <-recorder.Events; got != tt.want {
+				t.Errorf("want event %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// cacheMountPath is where the build cache volume is mounted into the builder
+	cacheMountPath = "/cache"
+)
+
+var defaultCacheSize = resource.MustParse("1Gi")
+
+func buildCacheName(page *hugohosterv1beta1.HugoPage) string {
+	return fmt.Sprintf("%s-build-cache", page.Name)
+}
+
+// upsertBuildCache applies the build cache PersistentVolumeClaim of page.
+// If the wipe-cache annotation changed, or the size or StorageClass of the cache changed, which can not be changed on
+// an existing claim, the claim is deleted first, so the next build starts with a new cache. The claim is not deleted
+// while a build is running, it is deleted once the build finished. No build is started while the claim is deleted.
+func (r *HugoPageReconciler) upsertBuildCache(ctx context.Context, page *hugohosterv1beta1.HugoPage) (*apiv1.PersistentVolumeClaim, error) {
+	if page.Spec.Build.Cache == nil {
+		return nil, nil
+	}
+
+	pvc := &apiv1.PersistentVolumeClaim{}
+	pvc.ObjectMeta = metav1.ObjectMeta{
+		Name:      buildCacheName(page),
+		Namespace: page.Namespace,
+		Labels:    makeLabels(page, "builder"),
+	}
+
+	size := defaultCacheSize
+	if page.Spec.Build.Cache.Size != nil {
+		size = *page.Spec.Build.Cache.Size
+	}
+
+	pvc.Spec = apiv1.PersistentVolumeClaimSpec{
+		AccessModes:      []apiv1.PersistentVolumeAccessMode{apiv1.ReadWriteOnce},
+		StorageClassName: page.Spec.Build.Cache.StorageClassName,
+		Resources: apiv1.VolumeResourceRequirements{
+			Requests: apiv1.ResourceList{
+				apiv1.ResourceStorage: size,
+			},
+		},
+	}
+
+	existing := &apiv1.PersistentVolumeClaim{}
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(pvc), existing); err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return nil, errors.Wrap(err, "Failed to get build cache PersistentVolumeClaim")
+		}
+
+		existing = nil
+	}
+
+	// The claim is recreated once the deletion is finished and the claim is gone
+	if existing != nil && existing.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	wipeToken := page.Annotations[hugohosterv1beta1.WipeCacheAnnotation]
+	wipe := wipeToken != "" && wipeToken != page.Status.LastCacheWipe
+
+	reason := ""
+	if wipe {
+		reason = "the wipe-cache annotation changed"
+	} else if existing != nil {
+		reason = buildCacheChange(existing, pvc)
+	}
+
+	if reason != "" {
+		// no build may start and mount the claim between checking for running builds and deleting it
+		resume, started := r.buildQueue.Suspend(client.ObjectKeyFromObject(page))
+		defer resume()
+
+		running, err := r.buildRunning(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+
+		// the builder may have the claim mounted, the Job finishing triggers another reconcile
+		if running || started {
+			condition := metav1.Condition{
+				Type:               hugohosterv1beta1.HugoPageConditionCacheRecreationPending,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: page.Generation,
+				Reason:             "BuildRunning",
+				Message:            fmt.Sprintf("The build cache is recreated once the running build finished, as %s", reason),
+			}
+
+			if meta.SetStatusCondition(&page.Status.Conditions, condition) {
+				r.recorder.Eventf(page, apiv1.EventTypeNormal, "CacheRecreationDeferred", "Deferred recreating build cache %s until the running build finished, as %s", pvc.Name, reason)
+
+				if err := r.client.Status().Update(ctx, page); err != nil {
+					return nil, errors.Wrap(err, "Failed to update HugoPage status")
+				}
+			}
+
+			return existing, nil
+		}
+
+		if existing != nil {
+			if err := r.client.Delete(ctx, existing, client.Preconditions{UID: &existing.UID}); err != nil && !k8serrors.IsNotFound(err) {
+				return nil, errors.Wrap(err, "Failed to delete build cache")
+			}
+		}
+
+		statusChanged := meta.RemoveStatusCondition(&page.Status.Conditions, hugohosterv1beta1.HugoPageConditionCacheRecreationPending)
+
+		if wipe {
+			r.recorder.Eventf(page, apiv1.EventTypeNormal, "CacheWiped", "Wiped build cache %s", pvc.Name)
+
+			page.Status.LastCacheWipe = wipeToken
+			statusChanged = true
+		} else {
+			r.recorder.Eventf(page, apiv1.EventTypeNormal, "CacheRecreated", "Recreating build cache %s, as %s", pvc.Name, reason)
+		}
+
+		if statusChanged {
+			if err := r.client.Status().Update(ctx, page); err != nil {
+				return nil, errors.Wrap(err, "Failed to update HugoPage status")
+			}
+		}
+
+		return nil, nil
+	}
+
+	// the change a recreation waited for was reverted
+	if meta.RemoveStatusCondition(&page.Status.Conditions, hugohosterv1beta1.HugoPageConditionCacheRecreationPending) {
+		if err := r.client.Status().Update(ctx, page); err != nil {
+			return nil, errors.Wrap(err, "Failed to update HugoPage status")
+		}
+	}
+
+	if err := r.apply(ctx, page, pvc); err != nil {
+		return nil, errors.Wrap(err, "Failed to apply build cache PersistentVolumeClaim")
+	}
+
+	return pvc, nil
+}
+
+// buildCacheChange returns why the existing build cache claim has to be recreated to become desired,
+// or an empty string if it can be updated in place
+func buildCacheChange(existing, desired *apiv1.PersistentVolumeClaim) string {
+	// an unset StorageClass was defaulted by the cluster
+	if class := desired.Spec.StorageClassName; class != nil && (existing.Spec.StorageClassName == nil || *existing.Spec.StorageClassName != *class) {
+		return fmt.Sprintf("its StorageClass changed to %s", *class)
+	}
+
+	size := desired.Spec.Resources.Requests[apiv1.ResourceStorage]
+	if current, ok := existing.Spec.Resources.Requests[apiv1.ResourceStorage]; ok && current.Cmp(size) != 0 {
+		return fmt.Sprintf("its size changed from %s to %s", current.String(), size.String())
+	}
+
+	return ""
+}
+
+// buildRunning reports whether a builder Job of page has not finished yet
+func (r *HugoPageReconciler) buildRunning(ctx context.Context, page *hugohosterv1beta1.HugoPage) (bool, error) {
+	jobs := &batchv1.JobList{}
+	if err := r.client.List(ctx, jobs, client.InNamespace(page.Namespace), client.MatchingLabels(makeLabels(page, "builder"))); err != nil {
+		return false, errors.Wrap(err, "Failed to list page-builder Jobs")
+	}
+
+	for i := range jobs.Items {
+		if _, finished := buildStatusFromJob(&jobs.Items[i]); !finished {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
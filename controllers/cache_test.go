@@ -0,0 +1,175 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestBuildCacheChange(t *testing.T) {
+	claim := func(size string, class *string) *apiv1.PersistentVolumeClaim {
+		return &apiv1.PersistentVolumeClaim{Spec: apiv1.PersistentVolumeClaimSpec{
+			StorageClassName: class,
+			Resources:        apiv1.VolumeResourceRequirements{Requests: apiv1.ResourceList{apiv1.ResourceStorage: resource.MustParse(size)}},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		existing *apiv1.PersistentVolumeClaim
+		desired  *apiv1.PersistentVolumeClaim
+		want     bool
+	}{
+		{name: "unchanged", existing: claim("1Gi", ptr("fast")), desired: claim("1024Mi", ptr("fast"))},
+		{name: "defaulted StorageClass", existing: claim("1Gi", ptr("standard")), desired: claim("1Gi", nil)},
+		{name: "StorageClass changed", existing: claim("1Gi", ptr("standard")), desired: claim("1Gi", ptr("fast")), want: true},
+		{name: "grown", existing: claim("1Gi", nil), desired: claim("2Gi", nil), want: true},
+		{name: "shrunk", existing: claim("2Gi", nil), desired: claim("1Gi", nil), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildCacheChange(tt.existing, tt.desired); (got != "") != tt.want {
+				t.Errorf("want recreation %v, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUpsertBuildCacheRecreation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+	page.Spec.Build.Cache = &hugohosterv1beta1.BuildCacheSpec{Size: ptr(resource.MustParse("2Gi"))}
+
+	pvc := &apiv1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: buildCacheName(page), Namespace: "web"},
+		Spec: apiv1.PersistentVolumeClaimSpec{
+			Resources: apiv1.VolumeResourceRequirements{Requests: apiv1.ResourceList{apiv1.ResourceStorage: resource.MustParse("1Gi")}},
+		},
+	}
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "blog-1", Namespace: "web", Labels: makeLabels(page, "builder")}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(page, pvc, job).WithStatusSubresource(page).Build()
+	recorder := record.NewFakeRecorder(10)
+	queue := NewBuildQueue(c, 0, nil, recorder, noop.NewTracerProvider().Tracer("cache_test"))
+	r := &HugoPageReconciler{client: c, buildQueue: queue, recorder: recorder}
+
+	// the running build keeps the claim, the deferral is reported once
+	for range 2 {
+		if _, err := r.upsertBuildCache(context.Background(), page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pvc), &apiv1.PersistentVolumeClaim{}); err != nil {
+		t.Fatalf("want the claim kept while a build is running, got %v", err)
+	}
+
+	if len(recorder.Events) != 1 {
+		t.Fatalf("want the deferral reported once, got %d events", len(recorder.Events))
+	}
+
+	if event := <-recorder.Events; !strings.Contains(event, "CacheRecreationDeferred") {
+		t.Errorf("want a CacheRecreationDeferred event, got %s", event)
+	}
+
+	if !meta.IsStatusConditionTrue(page.Status.Conditions, hugohosterv1beta1.HugoPageConditionCacheRecreationPending) {
+		t.Errorf("want the pending recreation in the status, got %+v", page.Status.Conditions)
+	}
+
+	finish(t, c, job)
+	if _, err := r.upsertBuildCache(context.Background(), page); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pvc), &apiv1.PersistentVolumeClaim{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("want the claim of the resized cache deleted once the build finished, got %v", err)
+	}
+
+	if meta.FindStatusCondition(page.Status.Conditions, hugohosterv1beta1.HugoPageConditionCacheRecreationPending) != nil {
+		t.Errorf("want the pending recreation removed from the status, got %+v", page.Status.Conditions)
+	}
+}
+
+func TestUpsertBuildCacheWaitsForStartedBuild(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+	page.Spec.Build.Cache = &hugohosterv1beta1.BuildCacheSpec{Size: ptr(resource.MustParse("2Gi"))}
+
+	pvc := &apiv1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: buildCacheName(page), Namespace: "web"},
+		Spec: apiv1.PersistentVolumeClaimSpec{
+			Resources: apiv1.VolumeResourceRequirements{Requests: apiv1.ResourceList{apiv1.ResourceStorage: resource.MustParse("1Gi")}},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(page, pvc, builderCronJobFor("blog")).WithStatusSubresource(page).Build()
+	queue := NewBuildQueue(c, 0, nil, record.NewFakeRecorder(10), noop.NewTracerProvider().Tracer("cache_test"))
+	if err := queue.Schedule(client.ObjectKeyFromObject(page), "default", 0, "@yearly"); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.Enqueue(context.Background(), client.ObjectKeyFromObject(page), BuildPriorityTriggered)
+	if err := queue.tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cache does not list the Job of the build yet
+	jobs := &batchv1.JobList{}
+	if err := c.List(context.Background(), jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range jobs.Items {
+		if err := c.Delete(context.Background(), &jobs.Items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &HugoPageReconciler{client: c, buildQueue: queue, recorder: record.NewFakeRecorder(10)}
+	if _, err := r.upsertBuildCache(context.Background(), page); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pvc), &apiv1.PersistentVolumeClaim{}); err != nil {
+		t.Fatalf("want the claim kept while a started build is not in the cache, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/pkg/errors"
+)
+
+// maxChildPageNameLength is the longest name of a child Hugo Page, as the name of the Service of its nginx proxy,
+// nginx-proxy-<name>-svc, has to be a DNS label of at most 63 characters. It is also short enough for the 52 characters
+// of a CronJob name
+const maxChildPageNameLength = 47
+
+// childPageName returns the name of a child Hugo Page of the Hugo Page prefix with suffix, like its pull request.
+// A name that is too long has prefix shortened and a hash of the full name appended, so the names of the children
+// of pages with long names stay distinct.
+func childPageName(prefix, suffix string) string {
+	name := prefix + suffix
+	if len(name) <= maxChildPageNameLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := "-" + hex.EncodeToString(sum[:])[:8]
+
+	keep := maxChildPageNameLength - len(hash) - len(suffix)
+	if keep < 1 {
+		return strings.TrimRight(name[:maxChildPageNameLength-len(hash)], "-.") + hash
+	}
+
+	return strings.TrimRight(prefix[:keep], "-.") + hash + suffix
+}
+
+// syncChildPages applies children and deletes the Hugo Pages controlled by page that carry label but are not among children.
+// It returns the names of the deleted Hugo Pages.
+func (r *HugoPageReconciler) syncChildPages(ctx context.Context, page *hugohosterv1beta1.HugoPage, label string, children []*hugohosterv1beta1.HugoPage) ([]string, error) {
+	desired := map[string]bool{}
+	for _, child := range children {
+		desired[child.Name] = true
+
+		if err := r.apply(ctx, page, child); err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply Hugo Page %s", child.Name)
+		}
+	}
+
+	existing := &hugohosterv1beta1.HugoPageList{}
+	if err := r.client.List(ctx, existing, client.InNamespace(page.Namespace), client.MatchingLabels{label: page.Name}); err != nil {
+		return nil, errors.Wrap(err, "Failed to list child Hugo Pages")
+	}
+
+	deleted := []string{}
+	for i := range existing.Items {
+		child := &existing.Items[i]
+		if desired[child.Name] || !metav1.IsControlledBy(child, page) {
+			continue
+		}
+
+		// the child resources of the page are garbage collected through their owner references
+		if err := r.client.Delete(ctx, child); err != nil && !k8serrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "Failed to delete Hugo Page %s", child.Name)
+		}
+
+		deleted = append(deleted, child.Name)
+	}
+
+	return deleted, nil
+}
+
+// childPage returns a Hugo Page named name with the spec of page, without the previews and environments of page.
+// The child uses the Setting resolved for page, even if page relies on the default.
+// It carries the labels of page, so it matches the --watch-label-selector page does.
+func childPage(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, name, label string) *hugohosterv1beta1.HugoPage {
+	labels := map[string]string{}
+	for key, value := range page.Labels {
+		labels[key] = value
+	}
+	labels[label] = page.Name
+
+	child := &hugohosterv1beta1.HugoPage{}
+	child.ObjectMeta = metav1.ObjectMeta{
+		Name:      name,
+		Namespace: page.Namespace,
+		Labels:    labels,
+	}
+
+	page.Spec.DeepCopyInto(&child.Spec)
+	child.Spec.Previews = nil
+	child.Spec.Environments = nil
+	child.Spec.SettingRef = &hugohosterv1beta1.SettingRef{Kind: settings.Kind, Name: settings.Name}
+
+	return child
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/forge"
+)
+
+const (
+	defaultCommitStatusContext = "hugo-hoster"
+
+	// commitStatusTimeout bounds the calls to the forge API made while reconciling
+	commitStatusTimeout = 10 * time.Second
+
+	// pendingCommitAnnotation is set on builder Jobs once the commit they build was marked pending
+	pendingCommitAnnotation = "hugo-hoster.cedi.dev/pending-commit"
+)
+
+// commitStatusRepository returns the repository the commit statuses of page are reported to
+func commitStatusRepository(page *hugohosterv1beta1.HugoPage) string {
+	if repository := page.Annotations[hugohosterv1beta1.CommitStatusRepositoryAnnotation]; repository != "" {
+		return repository
+	}
+
+	return page.Spec.Source.Repository
+}
+
+// buildCommitStatus returns the commit status of a finished build of page
+func buildCommitStatus(page *hugohosterv1beta1.HugoPage, build hugohosterv1beta1.BuildStatus) (forge.CommitState, string) {
+	switch build.Result {
+	case hugohosterv1beta1.BuildResultSuccess:
+		return forge.CommitStateSuccess, fmt.Sprintf("Deployed to %s", page.Spec.Routing.Host)
+
+	case hugohosterv1beta1.BuildResultCancelled:
+		return forge.CommitStateFailure, fmt.Sprintf("Build #%d timed out", build.Number)
+
+	default:
+		return forge.CommitStateFailure, fmt.Sprintf("Build #%d failed", build.Number)
+	}
+}
+
+// reportCommitStatus sets the status of commit of page on the forge configured in settings, if commit statuses are enabled
+// for the repository of page. The status links to the site of page. Failures are reported as events, as commit statuses
+// are informational.
+func (r *HugoPageReconciler) reportCommitStatus(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, commit string, state forge.CommitState, description string) {
+	forgeSpec := settings.Spec.Forge
+	if forgeSpec == nil || forgeSpec.CommitStatus == nil || commit == "" {
+		return
+	}
+
+	repository := commitStatusRepository(page)
+	if !forge.MatchRepository(forgeSpec.CommitStatus.Repositories, repository) {
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "CommitStatusSkipped", "Not marking commit %s %s, %s is not in forge.commitStatus.repositories of %s %s", commit, state, repository, settings.Kind, settings.Name)
+		return
+	}
+
+	status := forge.CommitStatus{
+		State:       state,
+		Context:     forgeSpec.CommitStatus.Context,
+		Description: description,
+		TargetURL:   pageBaseURL(page, settings),
+	}
+
+	if status.Context == "" {
+		status.Context = defaultCommitStatusContext
+	}
+
+	// a slow forge must not hold up the reconcile for long
+	ctx, cancel := context.WithTimeout(ctx, commitStatusTimeout)
+	defer cancel()
+
+	forgeClient, err := r.forgeFor(ctx, settings)
+	if err == nil {
+		err = forgeClient.SetCommitStatus(ctx, repository, commit, status)
+	}
+
+	if err != nil {
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "CommitStatusFailed", "Failed to mark commit %s %s: %s", commit, state, err.Error())
+	}
+}
+
+// reportBuildPending marks the commit the running builder job of page checks out pending, once per job.
+// The commit is the head of the branch of page, as the builder clones it when it starts. Previews are marked
+// pending with the commit of their pull request instead
+func (r *HugoPageReconciler) reportBuildPending(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, job *batchv1.Job, number int32) error {
+	forgeSpec := settings.Spec.Forge
+	if forgeSpec == nil || forgeSpec.CommitStatus == nil || page.Labels[hugohosterv1beta1.PreviewOfLabel] != "" || job.Annotations[pendingCommitAnnotation] != "" {
+		return nil
+	}
+
+	// the token is not used to look up the branches of repositories it may not report to
+	if !forge.MatchRepository(forgeSpec.CommitStatus.Repositories, commitStatusRepository(page)) {
+		return nil
+	}
+
+	branch := defaultBranch
+	if page.Spec.Source.Branch != "" {
+		branch = page.Spec.Source.Branch
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, commitStatusTimeout)
+	forgeClient, err := r.forgeFor(lookupCtx, settings)
+
+	commit := ""
+	if err == nil {
+		commit, err = forgeClient.BranchCommit(lookupCtx, page.Spec.Source.Repository, branch)
+	}
+	cancel()
+
+	if err != nil {
+		// the job is not looked up again, the status of its commit is still reported once it finished
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "CommitStatusFailed", "Failed to look up the commit of branch %s: %s", branch, err.Error())
+		commit = "unknown"
+	} else {
+		r.reportCommitStatus(ctx, page, settings, commit, forge.CommitStatePending, fmt.Sprintf("Build #%d running", number))
+	}
+
+	patch := client.MergeFrom(job.DeepCopy())
+	metav1.SetMetaDataAnnotation(&job.ObjectMeta, pendingCommitAnnotation, commit)
+	if err := r.client.Patch(ctx, job, patch); err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrapf(err, "Failed to annotate page-builder Job %s", job.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/forge"
+)
+
+func TestReportCommitStatus(t *testing.T) {
+	fake := forge.NewFake()
+	recorder := record.NewFakeRecorder(10)
+	r := &HugoPageReconciler{forges: fake.Factory(), recorder: recorder}
+
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.ClusterSettingKind, Name: "default"}
+	settings.Spec.Routing.TLS.Enabled = true
+	settings.Spec.Forge = &hugohosterv1beta1.ForgeSpec{Type: hugohosterv1beta1.ForgeTypeGitHub}
+
+	page := previewTestPage("pr-{{ .Number }}.preview.cedi.dev")
+	build := hugohosterv1beta1.BuildStatus{Number: 4, Result: hugohosterv1beta1.BuildResultFailed, Commit: "abc"}
+
+	// commit statuses are opt-in
+	state, description := buildCommitStatus(page, build)
+	r.reportCommitStatus(context.Background(), page, settings, build.Commit, state, description)
+	if len(fake.Statuses) != 0 {
+		t.Fatalf("want no commit status without commitStatus, got %v", fake.Statuses)
+	}
+
+	settings.Spec.Forge.CommitStatus = &hugohosterv1beta1.CommitStatusSpec{Repositories: []string{"github.com/cedi/*"}}
+	r.reportCommitStatus(context.Background(), page, settings, build.Commit, state, description)
+
+	preview := previewPage(page, settings, forge.PullRequest{Number: 9, Branch: "fork", Commit: "def", CloneURL: "https://github.com/someone/site.git"}, "pr-9.preview.cedi.dev")
+	r.reportCommitStatus(context.Background(), preview, settings, "def", forge.CommitStatePending, "Building preview")
+
+	want := []forge.SetStatus{
+		{
+			Repository: previewRepository,
+			Commit:     "abc",
+			Status:     forge.CommitStatus{State: forge.CommitStateFailure, Context: "hugo-hoster", Description: "Build #4 failed", TargetURL: "https://cedi.dev/"},
+		},
+		{
+			Repository: previewRepository,
+			Commit:     "def",
+			Status:     forge.CommitStatus{State: forge.CommitStatePending, Context: "hugo-hoster", Description: "Building preview", TargetURL: "https://pr-9.preview.cedi.dev/"},
+		},
+	}
+
+	if diff := cmp.Diff(want, fake.Statuses); diff != "" {
+		t.Errorf("unexpected commit statuses (-want +got):\n%s", diff)
+	}
+
+	// the token does not write to repositories outside the allow-list
+	other := page.DeepCopy()
+	other.Spec.Source.Repository = "https://github.com/someone/site.git"
+	r.reportCommitStatus(context.Background(), other, settings, build.Commit, state, description)
+
+	if len(fake.Statuses) != 2 || len(recorder.Events) != 1 {
+		t.Errorf("want the commit status of a repository outside the allow-list skipped with a warning, got %v", fake.Statuses)
+	}
+	<-recorder.Events
+
+	// a forge that is down does not fail the reconcile
+	fake.Err = errors.New("unavailable")
+	r.reportCommitStatus(context.Background(), page, settings, build.Commit, state, description)
+
+	if len(recorder.Events) != 1 {
+		t.Errorf("want a warning event for the failed commit status, got %d events", len(recorder.Events))
+	}
+}
+
+func TestReportBuildPending(t *testing.T) {
+	fakeForge := forge.NewFake()
+	fakeForge.SetBranch(previewRepository, "main", "abc")
+
+	page := previewTestPage("pr-{{ .Number }}.preview.cedi.dev")
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "site-1", Namespace: "web"}}
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(job).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &HugoPageReconciler{client: c, forges: fakeForge.Factory(), recorder: recorder}
+
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: "default"}
+	settings.Spec.Routing.TLS.Enabled = true
+	settings.Spec.Forge = &hugohosterv1beta1.ForgeSpec{
+		Type:         hugohosterv1beta1.ForgeTypeGitHub,
+		CommitStatus: &hugohosterv1beta1.CommitStatusSpec{Repositories: []string{"github.com/cedi/site"}},
+	}
+
+	for range 2 {
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(job), job); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.reportBuildPending(context.Background(), page, settings, job, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []forge.SetStatus{{
+		Repository: previewRepository,
+		Commit:     "abc",
+		Status:     forge.CommitStatus{State: forge.CommitStatePending, Context: "hugo-hoster", Description: "Build #5 running", TargetURL: "https://cedi.dev/"},
+	}}
+
+	if diff := cmp.Diff(want, fakeForge.Statuses); diff != "" {
+		t.Errorf("want the commit of a running build marked pending once (-want +got):\n%s", diff)
+	}
+
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(job), job); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := job.Annotations[pendingCommitAnnotation]; got != "abc" {
+		t.Errorf("want the pending commit recorded on the job, got %q", got)
+	}
+
+	if len(recorder.Events) != 0 {
+		t.Errorf("want no events, got %d", len(recorder.Events))
+	}
+}
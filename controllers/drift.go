@@ -0,0 +1,181 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	"github.com/pkg/errors"
+)
+
+// desiredHashAnnotation holds the hash of the desired state a child resource was last applied with
+const desiredHashAnnotation = "hugo-hoster.cedi.dev/desired-hash"
+
+// apply writes obj with server-side apply as the hugo-hoster field manager.
+// Only the fields set in obj are owned by hugo-hoster, so fields set by other tools are kept.
+//
+// obj is only written if its desired state changed since it was last applied,
+// or if one of the fields owned by hugo-hoster was changed by someone else.
+// The latter is reported as drift, every write is recorded as an event of page.
+//
+// A field changed by someone else moves to their field manager, so a drift is only looked for with a server-side
+// dry-run if the fields owned by hugo-hoster changed since obj was last applied or found not to have drifted.
+func (r *HugoPageReconciler) apply(ctx context.Context, page *hugohosterv1beta1.HugoPage, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, r.scheme)
+	if err != nil {
+		return errors.Wrap(err, "Unable to determine the kind of the object")
+	}
+
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	if err := ctrl.SetControllerReference(page, obj, r.scheme); err != nil {
+		return errors.Wrap(err, "Unable to set the HugoPage as controller")
+	}
+
+	hash, err := desiredHash(obj)
+	if err != nil {
+		return err
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[desiredHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+
+	live := obj.DeepCopyObject().(client.Object)
+	err = r.client.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrapf(err, "Failed to get %s", gvk.Kind)
+	}
+
+	created := k8serrors.IsNotFound(err)
+	drifted := false
+
+	key := gvk.Kind + "/" + obj.GetNamespace() + "/" + obj.GetName()
+
+	if err == nil && live.GetAnnotations()[desiredHashAnnotation] == hash {
+		if owned, ok := r.ownedFields.Load(key); ok && owned != "" && owned == ownedFieldsOf(live) {
+			return nil
+		}
+
+		drifted, err = r.drifted(ctx, obj, live)
+		if err != nil {
+			return err
+		}
+
+		if !drifted {
+			r.ownedFields.Store(key, ownedFieldsOf(live))
+			return nil
+		}
+	}
+
+	if err := r.client.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		r.ownedFields.Delete(key)
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, gvk.Kind+"ApplyFailed", "Failed to apply %s %s: %s", gvk.Kind, obj.GetName(), err.Error())
+		return err
+	}
+
+	r.ownedFields.Store(key, ownedFieldsOf(obj))
+
+	switch {
+	case created:
+		r.recorder.Eventf(page, apiv1.EventTypeNormal, gvk.Kind+"Created", "Created %s %s", gvk.Kind, obj.GetName())
+
+	case drifted:
+		driftCorrections.WithLabelValues(gvk.Kind).Inc()
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "DriftCorrected", "Restored %s %s that was modified outside of hugo-hoster", gvk.Kind, obj.GetName())
+
+	default:
+		r.recorder.Eventf(page, apiv1.EventTypeNormal, gvk.Kind+"Updated", "Updated %s %s", gvk.Kind, obj.GetName())
+	}
+
+	return nil
+}
+
+// drifted reports whether applying desired would change live, using a server-side dry-run
+func (r *HugoPageReconciler) drifted(ctx context.Context, desired, live client.Object) (bool, error) {
+	dryRun := desired.DeepCopyObject().(client.Object)
+	if err := r.client.Patch(ctx, dryRun, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership, client.DryRunAll); err != nil {
+		return false, errors.Wrapf(err, "Failed to dry-run %s", desired.GetObjectKind().GroupVersionKind().Kind)
+	}
+
+	liveState, err := comparableState(live)
+	if err != nil {
+		return false, err
+	}
+
+	dryRunState, err := comparableState(dryRun)
+	if err != nil {
+		return false, err
+	}
+
+	return !equality.Semantic.DeepEqual(liveState, dryRunState), nil
+}
+
+// ownedFieldsOf returns the fields of obj owned by the hugo-hoster field manager, along with the uid of obj,
+// so that a recreated object is not mistaken for the one it replaced
+func ownedFieldsOf(obj client.Object) string {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == fieldManager && entry.Operation == metav1.ManagedFieldsOperationApply && entry.FieldsV1 != nil {
+			return string(obj.GetUID()) + "/" + entry.APIVersion + "/" + string(entry.FieldsV1.Raw)
+		}
+	}
+
+	return ""
+}
+
+// comparableState returns obj without the fields the API server changes on every write
+func comparableState(obj client.Object) (map[string]interface{}, error) {
+	state, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to convert object")
+	}
+
+	unstructured.RemoveNestedField(state, "metadata", "managedFields")
+	unstructured.RemoveNestedField(state, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(state, "metadata", "generation")
+	unstructured.RemoveNestedField(state, "status")
+
+	return state, nil
+}
+
+// desiredHash returns a hash of the desired state of obj
+func desiredHash(obj client.Object) (string, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to hash desired state")
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+var _ = Describe("Server-side apply of the nginx proxy", func() {
+	It("keeps the replicas an HPA scaled an autoscaled page to", func() {
+		ctx := context.Background()
+		recorder := record.NewFakeRecorder(10)
+		r := &HugoPageReconciler{client: k8sClient, scheme: scheme.Scheme, recorder: recorder}
+
+		page := &hugohosterv1beta1.HugoPage{
+			ObjectMeta: metav1.ObjectMeta{Name: "autoscaled", Namespace: "default", UID: types.UID("5b0f4fd4-8d3c-4a55-9a2a-7a7d2c6b7e10")},
+			Spec: hugohosterv1beta1.HugoPageSpec{
+				Serve: hugohosterv1beta1.ServeSpec{Replicas: ptr[int32](2), Autoscaled: true},
+			},
+		}
+		settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.ClusterSettingKind, Name: "settings"}
+
+		deployment, err := r.upsertPageNginxProxy(ctx, page, settings)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(recorder.Events).Should(Receive(ContainSubstring("DeploymentCreated")))
+
+		// the HPA scales the Deployment as its own field manager
+		live := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), live)).To(Succeed())
+
+		scaled := live.DeepCopy()
+		scaled.Spec.Replicas = ptr[int32](5)
+		Expect(k8sClient.Patch(ctx, scaled, client.MergeFrom(live), client.FieldOwner("horizontal-pod-autoscaler"))).To(Succeed())
+
+		_, err = r.upsertPageNginxProxy(ctx, page, settings)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), live)).To(Succeed())
+		Expect(*live.Spec.Replicas).To(Equal(int32(5)))
+		Expect(recorder.Events).NotTo(Receive(ContainSubstring("DriftCorrected")))
+	})
+
+	It("only dry-runs a re-apply once the fields hugo-hoster owns changed", func() {
+		ctx := context.Background()
+		recorder := record.NewFakeRecorder(10)
+
+		watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme.Scheme})
+		Expect(err).NotTo(HaveOccurred())
+
+		dryRuns := 0
+		c := interceptor.NewClient(watchClient, interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				options := &client.PatchOptions{}
+				options.ApplyOptions(opts)
+				if len(options.DryRun) > 0 {
+					dryRuns++
+				}
+
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		})
+		r := &HugoPageReconciler{client: c, scheme: scheme.Scheme, recorder: recorder}
+
+		page := &hugohosterv1beta1.HugoPage{
+			ObjectMeta: metav1.ObjectMeta{Name: "drifting", Namespace: "default", UID: types.UID("0f1c1b8e-3f5a-4c36-8d0e-6c1f1f1d2a44")},
+			Spec: hugohosterv1beta1.HugoPageSpec{
+				Serve: hugohosterv1beta1.ServeSpec{Replicas: ptr[int32](2)},
+			},
+		}
+		settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.ClusterSettingKind, Name: "settings"}
+
+		deployment, err := r.upsertPageNginxProxy(ctx, page, settings)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.upsertPageNginxProxy(ctx, page, settings)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dryRuns).To(Equal(0))
+
+		// someone else scales the Deployment hugo-hoster owns the replicas of
+		live := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), live)).To(Succeed())
+
+		scaled := live.DeepCopy()
+		scaled.Spec.Replicas = ptr[int32](5)
+		Expect(k8sClient.Patch(ctx, scaled, client.MergeFrom(live), client.FieldOwner("kubectl-edit"))).To(Succeed())
+
+		_, err = r.upsertPageNginxProxy(ctx, page, settings)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dryRuns).To(Equal(1))
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), live)).To(Succeed())
+		Expect(*live.Spec.Replicas).To(Equal(int32(2)))
+	})
+})
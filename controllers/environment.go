@@ -0,0 +1,119 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/pkg/errors"
+)
+
+func environmentName(page *hugohosterv1beta1.HugoPage, environment hugohosterv1beta1.EnvironmentSpec) string {
+	return childPageName(page.Name, "-"+environment.Name)
+}
+
+// reconcileEnvironments applies the Hugo Page of every environment of page, deletes the Hugo Pages of removed
+// environments and reports the last build of every environment in the status of page
+func (r *HugoPageReconciler) reconcileEnvironments(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) error {
+	if len(page.Spec.Environments) == 0 && len(page.Status.Environments) == 0 {
+		return nil
+	}
+
+	environments := []*hugohosterv1beta1.HugoPage{}
+	for _, environment := range page.Spec.Environments {
+		environments = append(environments, environmentPage(page, settings, environment))
+	}
+
+	deleted, err := r.syncChildPages(ctx, page, hugohosterv1beta1.EnvironmentOfLabel, environments)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range deleted {
+		r.recorder.Eventf(page, apiv1.EventTypeNormal, "EnvironmentDeleted", "Deleted Hugo Page %s of a removed environment", name)
+	}
+
+	statuses, err := r.environmentStatuses(ctx, page, environments)
+	if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(statuses, page.Status.Environments) || (len(statuses) == 0 && len(page.Status.Environments) == 0) {
+		return nil
+	}
+
+	page.Status.Environments = statuses
+	if err := r.client.Status().Update(ctx, page); err != nil {
+		return errors.Wrap(err, "Failed to update HugoPage status")
+	}
+
+	return nil
+}
+
+// environmentStatuses returns the status of every environment of page from the status of its Hugo Page in environments
+func (r *HugoPageReconciler) environmentStatuses(ctx context.Context, page *hugohosterv1beta1.HugoPage, environments []*hugohosterv1beta1.HugoPage) ([]hugohosterv1beta1.EnvironmentStatus, error) {
+	statuses := []hugohosterv1beta1.EnvironmentStatus{}
+	for i, environment := range page.Spec.Environments {
+		status := hugohosterv1beta1.EnvironmentStatus{
+			Name: environment.Name,
+			Page: environments[i].Name,
+			Host: environment.Host,
+		}
+
+		child := &hugohosterv1beta1.HugoPage{}
+		err := r.client.Get(ctx, types.NamespacedName{Name: status.Page, Namespace: page.Namespace}, child)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "Failed to get Hugo Page %s", status.Page)
+		}
+
+		if err == nil {
+			status.LastBuild = child.Status.LastBuild
+			status.LastSuccessTime = child.Status.LastSuccessTime
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// environmentPage returns the Hugo Page of environment, which is page built from the branch of the environment, served under its host
+func environmentPage(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, environment hugohosterv1beta1.EnvironmentSpec) *hugohosterv1beta1.HugoPage {
+	child := childPage(page, settings, environmentName(page, environment), hugohosterv1beta1.EnvironmentOfLabel)
+	child.Spec.Source.Branch = environment.Branch
+	child.Spec.Routing.Host = environment.Host
+
+	if environment.Flags != nil {
+		child.Spec.Build.Flags = *environment.Flags.DeepCopy()
+	} else {
+		// the baseURL of the page would point the links of the environment to the production site
+		child.Spec.Build.Flags.BaseURL = ""
+	}
+
+	if environment.Schedule != "" {
+		child.Spec.Build.Schedule = environment.Schedule
+	}
+
+	return child
+}
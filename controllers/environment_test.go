@@ -0,0 +1,116 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+func TestEnvironmentPage(t *testing.T) {
+	page := previewTestPage("pr-{{ .Number }}.preview.cedi.dev")
+	page.Spec.Build.Schedule = "0 * * * *"
+	page.Spec.Build.Flags.Minify = true
+	page.Spec.Environments = []hugohosterv1beta1.EnvironmentSpec{{Name: "staging", Branch: "staging", Host: "staging.cedi.dev"}}
+
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: "default", Namespace: "web"}
+
+	staging := environmentPage(page, settings, page.Spec.Environments[0])
+	if staging.Name != "site-staging" || staging.Labels[hugohosterv1beta1.EnvironmentOfLabel] != "site" {
+		t.Errorf("unexpected metadata of environment: %+v", staging.ObjectMeta)
+	}
+
+	if staging.Spec.Source.Branch != "staging" || staging.Spec.Routing.Host != "staging.cedi.dev" || staging.Spec.Build.Schedule != "0 * * * *" {
+		t.Errorf("environment does not build its branch: %+v", staging.Spec)
+	}
+
+	if !staging.Spec.Build.Flags.Minify || staging.Spec.Build.Flags.BaseURL != "" {
+		t.Errorf("want flags of the page without its baseURL, got %+v", staging.Spec.Build.Flags)
+	}
+
+	if staging.Spec.Environments != nil || staging.Spec.Previews != nil {
+		t.Error("environment inherited environments or previews")
+	}
+
+	drafts := hugohosterv1beta1.EnvironmentSpec{
+		Name:     "drafts",
+		Branch:   "main",
+		Host:     "drafts.cedi.dev",
+		Flags:    &hugohosterv1beta1.HugoFlagsSpec{BuildDrafts: true},
+		Schedule: "*/10 * * * *",
+	}
+
+	child := environmentPage(page, settings, drafts)
+	if !equality.Semantic.DeepEqual(child.Spec.Build.Flags, *drafts.Flags) || child.Spec.Build.Schedule != "*/10 * * * *" {
+		t.Errorf("want flags and schedule of the environment, got %+v", child.Spec.Build)
+	}
+}
+
+func TestEnvironmentStatuses(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	page := previewTestPage("pr-{{ .Number }}.preview.cedi.dev")
+	page.Spec.Environments = []hugohosterv1beta1.EnvironmentSpec{
+		{Name: "staging", Branch: "staging", Host: "staging.cedi.dev"},
+		{Name: "drafts", Branch: "main", Host: "drafts.cedi.dev"},
+	}
+
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: "default", Namespace: "web"}
+	environments := []*hugohosterv1beta1.HugoPage{}
+	for _, environment := range page.Spec.Environments {
+		environments = append(environments, environmentPage(page, settings, environment))
+	}
+
+	finished := metav1.NewTime(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC))
+	staging := environments[0].DeepCopy()
+	staging.Status.LastBuild = hugohosterv1beta1.BuildStatus{Number: 3, Commit: "abc", Result: hugohosterv1beta1.BuildResultSuccess, CompletionTime: &finished}
+	staging.Status.LastSuccessTime = &finished
+
+	// the Hugo Page of drafts is not created yet
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(staging).WithStatusSubresource(staging).Build()
+	r := &HugoPageReconciler{client: c}
+
+	statuses, err := r.environmentStatuses(context.Background(), page, environments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != 2 {
+		t.Fatalf("want the status of 2 environments, got %+v", statuses)
+	}
+
+	if status := statuses[0]; status.Name != "staging" || status.Page != "site-staging" || status.Host != "staging.cedi.dev" ||
+		status.LastBuild.Number != 3 || status.LastSuccessTime == nil || !status.LastSuccessTime.Equal(&finished) {
+		t.Errorf("want the last successful build of staging, got %+v", status)
+	}
+
+	if status := statuses[1]; status.Page != "site-drafts" || status.LastBuild.Number != 0 || status.LastSuccessTime != nil {
+		t.Errorf("want drafts without builds, got %+v", status)
+	}
+}
@@ -20,14 +20,14 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
-	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
@@ -37,16 +37,34 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-	hugohosterv1alpha1 "github.com/cedi/hugo-hoster/api/v1alpha1"
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
 	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/forge"
+	"github.com/cedi/hugo-hoster/pkg/notify"
 	"github.com/cedi/hugo-hoster/pkg/observability"
-	"github.com/google/go-cmp/cmp"
+	"github.com/cedi/hugo-hoster/pkg/storage"
 	"github.com/pkg/errors"
 )
 
+const (
+	defaultBranch     = "main"
+	defaultSchedule   = "*/5 * * * *"
+	defaultNginxImage = "nginx:alpine"
+
+	// fieldManager owns all fields hugo-hoster writes with server-side apply
+	fieldManager = "hugo-hoster"
+
+	// LeaderElectionID is the name of the Lease the replicas of hugo-hoster elect their leader with
+	LeaderElectionID = "9123ff57.cedi.dev"
+)
+
 // HugoPageReconciler reconciles a HugoPage object
 type HugoPageReconciler struct {
 	client        client.Client
@@ -55,34 +73,75 @@ type HugoPageReconciler struct {
 	scheme        *runtime.Scheme
 	tracer        trace.Tracer
 	settingName   string
+
+	// rolloutLimiter paces the pages reconciled after a Setting or ClusterSetting changed
+	rolloutLimiter *rate.Limiter
+
+	recorder record.EventRecorder
+
+	// apiReader reads objects that are not worth caching, like the pods of builder Jobs
+	apiReader client.Reader
+
+	// forges creates the forge clients discovering the pull requests of previews
+	forges forge.Factory
+
+	// buildQueue starts the builds of the pages
+	buildQueue *BuildQueue
+
+	// podLogs reads the logs of builder pods, which the controller-runtime client cannot
+	podLogs corev1client.PodsGetter
+
+	// notifier sends the notifications about builds
+	notifier *notify.Notifier
+
+	// syncer keeps the known-good copy of the pages and rolls back to it
+	syncer storage.Syncer
+
+	// ownedFields holds the fields hugo-hoster owned in the child resources when they were last known not to
+	// have drifted, by kind, namespace and name
+	ownedFields sync.Map
 }
 
-func NewHugoPageReconciler(client client.Client, pageClient *pageClient.HugoPageClient, settingClient *pageClient.SettingsClient, settingsName string, scheme *runtime.Scheme, tracer trace.Tracer) *HugoPageReconciler {
+func NewHugoPageReconciler(client client.Client, pageClient *pageClient.HugoPageClient, settingClient *pageClient.SettingsClient, settingsName string, rolloutLimiter *rate.Limiter, recorder record.EventRecorder, apiReader client.Reader, forges forge.Factory, buildQueue *BuildQueue, podLogs corev1client.PodsGetter, notifier *notify.Notifier, syncer storage.Syncer, scheme *runtime.Scheme, tracer trace.Tracer) *HugoPageReconciler {
 	return &HugoPageReconciler{
-		client:        client,
-		pageClient:    pageClient,
-		settingClient: settingClient,
-		settingName:   settingsName,
-		scheme:        scheme,
-		tracer:        tracer,
+		client:         client,
+		pageClient:     pageClient,
+		settingClient:  settingClient,
+		settingName:    settingsName,
+		rolloutLimiter: rolloutLimiter,
+		recorder:       recorder,
+		apiReader:      apiReader,
+		forges:         forges,
+		buildQueue:     buildQueue,
+		podLogs:        podLogs,
+		notifier:       notifier,
+		syncer:         syncer,
+		scheme:         scheme,
+		tracer:         tracer,
 	}
 }
 
-// +kubebuilder:rbac:groups="",resources=ConfigMap;Service,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=batch,resources=CronJob;Job,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps;services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=cronjobs;jobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=apps,resources=Deployment,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 
-//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=Setting,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=settings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=clustersettings,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 
-//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=HugoPages,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=HugoPages/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=HugoPages/finalizers,verbs=update
+//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=hugopages,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=hugopages/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=hugopages/finalizers,verbs=update
 
 func (r *HugoPageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	startTime := time.Now()
 	defer func() {
-		reconcilerDuration.WithLabelValues("page_name", req.Name, req.Namespace).Observe(float64(time.Since(startTime).Microseconds()))
+		reconcilerDuration.WithLabelValues("hugopage").Observe(time.Since(startTime).Seconds())
 	}()
 
 	span := trace.SpanFromContext(ctx)
@@ -102,17 +161,65 @@ func (r *HugoPageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	if err != nil || page == nil {
 		if k8serrors.IsNotFound(err) {
 			observability.RecordInfo(&log, span, "Hugo Page resource not found. Ignoring since object must be deleted")
-
-		} else {
-			observability.RecordError(&log, span, err, "Failed to fetch HugoPage resource")
+			r.buildQueue.Forget(req.NamespacedName)
+			activePages.forget(req.NamespacedName)
+			return ctrl.Result{}, nil
 		}
+
+		observability.RecordError(&log, span, err, "Failed to fetch HugoPage resource")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	activePages.track(page)
+
+	paused := page.Annotations[hugohosterv1beta1.PausedAnnotation] == "true"
+	r.buildQueue.Pause(req.NamespacedName, paused)
+
+	if paused {
+		observability.RecordInfo(&log, span, "Hugo Page reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+
+	settings, err := r.settingClient.Resolve(ctx, page, r.settingName)
+	if err != nil {
+		observability.RecordError(&log, span, err, "Failed to resolve Setting or ClusterSetting. You MUST configure hugo-hoster before deploying a site")
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "SettingNotResolved", "Failed to resolve the Setting or ClusterSetting of the page: %s", err.Error())
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
 	}
 
-	settings, err := r.settingClient.GetNameNamespace(ctx, r.settingName, req.Namespace)
-	if err != nil || settings == nil {
-		span.RecordError(err)
-		log.Panicw(fmt.Sprintf("Failed to fetch Setting resource. You MUST configure hugo-hoster before deploying a site with the setting object name=%s", r.settingName), zap.Error(err))
-		os.Exit(1) // just a failsafe... Panicw should already terminate the program
+	span.SetAttributes(attribute.String("setting_kind", settings.Kind), attribute.String("setting_name", settings.Name))
+
+	credentialsSecretName, err := r.upsertS3CredentialsSecret(ctx, page, settings)
+	if err != nil {
+		observability.RecordError(&log, span, err, "Failed to upsert S3 credentials Secret")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	_, err = r.upsertBuildCache(ctx, page)
+	if err != nil {
+		observability.RecordError(&log, span, err, "Failed to upsert build cache")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	// the site is copied to its prefix before nginx is configured to serve it from there
+	if err := r.migrateStoragePrefix(ctx, page, settings); err != nil {
+		observability.RecordError(&log, span, err, "Failed to migrate the storage prefix")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
 	}
 
 	_, err = r.upsertConfigMap(ctx, page, settings)
@@ -124,7 +231,7 @@ func (r *HugoPageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}, err
 	}
 
-	_, err = r.upsertPageBuilderCronJob(ctx, page, settings)
+	_, err = r.upsertPageBuilderCronJob(ctx, page, settings, credentialsSecretName)
 	if err != nil {
 		observability.RecordError(&log, span, err, "Failed to upsert page-builder CronJob")
 		return ctrl.Result{
@@ -133,6 +240,14 @@ func (r *HugoPageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}, err
 	}
 
+	if err := r.triggerBuild(ctx, page); err != nil {
+		observability.RecordError(&log, span, err, "Failed to trigger build")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
 	_, err = r.upsertPageNginxProxy(ctx, page, settings)
 	if err != nil {
 		observability.RecordError(&log, span, err, "Failed to upsert page-builder nginx proxy deployment")
@@ -160,166 +275,160 @@ func (r *HugoPageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}, err
 	}
 
-	return ctrl.Result{}, nil
+	if err := r.updateBuildStatus(ctx, page, settings); err != nil {
+		observability.RecordError(&log, span, err, "Failed to update build status")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	if err := r.reconcileProbe(ctx, page, settings); err != nil {
+		observability.RecordError(&log, span, err, "Failed to reconcile known-good build")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	if err := r.reconcileEnvironments(ctx, page, settings); err != nil {
+		observability.RecordError(&log, span, err, "Failed to reconcile environments")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	previewPollInterval, err := r.reconcilePreviews(ctx, page, settings)
+	if err != nil {
+		observability.RecordError(&log, span, err, "Failed to reconcile previews")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	return ctrl.Result{RequeueAfter: previewPollInterval}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *HugoPageReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&hugohosterv1alpha1.HugoPage{}).
-		Owns(&hugohosterv1alpha1.Setting{}).
+		For(&hugohosterv1beta1.HugoPage{}).
+		Watches(&hugohosterv1beta1.Setting{}, r.settingRolloutHandler(hugohosterv1beta1.SettingKind)).
+		Watches(&hugohosterv1beta1.ClusterSetting{}, r.settingRolloutHandler(hugohosterv1beta1.ClusterSettingKind)).
 		Owns(&appsv1.Deployment{}).
 		Owns(&batchv1.CronJob{}).
 		Owns(&apiv1.ConfigMap{}).
 		Owns(&apiv1.Service{}).
+		Owns(&apiv1.Secret{}).
+		Owns(&apiv1.PersistentVolumeClaim{}).
 		Owns(&networkingv1.Ingress{}).
+		// the status of environments and previews is reported on the page defining them
+		Owns(&hugohosterv1beta1.HugoPage{}).
+		// builder Jobs are owned by the CronJob, so they are mapped to their page by label
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(pageForBuilderJob)).
 		Complete(r)
 }
 
-func (r *HugoPageReconciler) upsertPageBuilderCronJob(ctx context.Context, page *hugohosterv1alpha1.HugoPage, settings *hugohosterv1alpha1.Setting) (*batchv1.CronJob, error) {
+// upsertPageBuilderCronJob applies the CronJob holding the template of the builder Jobs of page and schedules its builds.
+// The CronJob is suspended, as the builds are started by the BuildQueue.
+func (r *HugoPageReconciler) upsertPageBuilderCronJob(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, credentialsSecretName string) (*batchv1.CronJob, error) {
 	startingDeadlineSeconds := int64(100)
-	suspend := bool(false)
-	successfulJobsHistoryLimit := int32(3)
-	failedJobsHistoryLimit := int32(10)
+	suspend := bool(true)
+	successfulJobsHistoryLimit := int32(successfulBuildsHistoryLimit)
+	failedJobsHistoryLimit := int32(failedBuildsHistoryLimit)
 
-	builderCronJob := &batchv1.CronJob{}
-	err := r.client.Get(ctx, types.NamespacedName{Name: page.Name, Namespace: page.Namespace}, builderCronJob)
+	jobSpec, err := builderJobSpec(page, settings, credentialsSecretName)
+	if err != nil {
+		r.recorder.Event(page, apiv1.EventTypeWarning, "InvalidBuildSpec", err.Error())
+		return nil, err
+	}
 
+	builderCronJob := &batchv1.CronJob{}
 	builderCronJob.ObjectMeta = metav1.ObjectMeta{
 		Name:      page.Name,
 		Namespace: page.Namespace,
 		Labels:    makeLabels(page, "builder"),
 	}
 
-	defaultImage := "ghcr.io/SpechtLabs/page_builder"
-	defaultTag := "main"
-	imagePullPolicy := apiv1.PullIfNotPresent
-	builderContainerImage := fmt.Sprintf("%s:%s", defaultImage, defaultTag)
-
-	if page.Spec.Options != nil && page.Spec.Options.BuildImageOptions != nil {
-		if page.Spec.Options.BuildImageOptions.Image != nil {
-			builderContainerImage = strings.ReplaceAll(builderContainerImage, defaultImage, *page.Spec.Options.BuildImageOptions.Image)
-		}
-
-		if page.Spec.Options.BuildImageOptions.Tag != nil {
-			builderContainerImage = strings.ReplaceAll(builderContainerImage, defaultTag, *page.Spec.Options.BuildImageOptions.Tag)
-		}
-
-		if page.Spec.Options.BuildImageOptions.ImagePullPolicy != nil {
-			imagePullPolicy = *page.Spec.Options.BuildImageOptions.ImagePullPolicy
-		}
+	schedule := defaultSchedule
+	if page.Spec.Build.Schedule != "" {
+		schedule = page.Spec.Build.Schedule
 	}
 
 	builderCronJob.Spec = batchv1.CronJobSpec{
-		Schedule:                   page.Spec.CronInterval,
+		Schedule:                   schedule,
 		ConcurrencyPolicy:          "Forbid",
 		StartingDeadlineSeconds:    &startingDeadlineSeconds,
 		Suspend:                    &suspend,
 		SuccessfulJobsHistoryLimit: &successfulJobsHistoryLimit,
 		FailedJobsHistoryLimit:     &failedJobsHistoryLimit,
 		JobTemplate: batchv1.JobTemplateSpec{
-			Spec: batchv1.JobSpec{
-				Template: apiv1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels: builderCronJob.ObjectMeta.Labels,
-					},
-					Spec: apiv1.PodSpec{
-						RestartPolicy: apiv1.RestartPolicyOnFailure,
-						Containers: []apiv1.Container{
-							{
-								Name:            "page-builder",
-								Image:           builderContainerImage,
-								ImagePullPolicy: imagePullPolicy,
-								Env: []apiv1.EnvVar{
-									{
-										Name:  "REPO_URL",
-										Value: page.Spec.Repository,
-									},
-									{
-										Name:  "PAGE_NAME",
-										Value: page.Name,
-									},
-									{
-										Name:  "S3_BUCKET_NAME",
-										Value: settings.Spec.S3Config.BucketName,
-									},
-									{
-										Name: "AWS_ACCESS_KEY_ID",
-										ValueFrom: &apiv1.EnvVarSource{
-											SecretKeyRef: &apiv1.SecretKeySelector{
-												LocalObjectReference: apiv1.LocalObjectReference{
-													Name: settings.Spec.S3Config.SecretName,
-												},
-												Key: settings.Spec.S3Config.AccessKeyIDRef,
-											},
-										},
-									},
-									{
-										Name: "AWS_SECRET_ACCESS_KEY",
-										ValueFrom: &apiv1.EnvVarSource{
-											SecretKeyRef: &apiv1.SecretKeySelector{
-												LocalObjectReference: apiv1.LocalObjectReference{
-													Name: settings.Spec.S3Config.SecretName,
-												},
-												Key: settings.Spec.S3Config.AccessKeyRef,
-											},
-										},
-									},
-									{
-										Name:  "S3_ENDPOINT",
-										Value: settings.Spec.S3Config.Endpoint,
-									},
-								},
-								VolumeMounts: []apiv1.VolumeMount{
-									{
-										Name:      "hugo-buildcmd",
-										MountPath: "/home/builder/build-hugo.sh",
-										SubPath:   "build-hugo.sh",
-										ReadOnly:  true,
-									},
-								},
-							},
-						},
-						Volumes: []apiv1.Volume{
-							{
-								Name: "hugo-buildcmd",
-								VolumeSource: apiv1.VolumeSource{
-									ConfigMap: &apiv1.ConfigMapVolumeSource{
-										LocalObjectReference: apiv1.LocalObjectReference{
-											Name: fmt.Sprintf("nginx-proxy-conf-%s", page.Name),
-										},
-									},
-								},
-							},
-						},
-					},
-				},
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: makeLabels(page, "builder"),
 			},
+			Spec: jobSpec,
 		},
 	}
 
-	// Set Redirect instance as the owner and controller
-	ctrl.SetControllerReference(page, builderCronJob, r.scheme)
-
-	if err != nil && k8serrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, builderCronJob); err != nil {
-			return nil, errors.Wrap(err, "Failed to create new page-builder CronJob")
-		}
-	} else if err != nil {
-		return nil, errors.Wrap(err, "Failed to get page-builder CronJob")
+	if err := r.apply(ctx, page, builderCronJob); err != nil {
+		return nil, errors.Wrap(err, "Failed to apply page-builder CronJob")
 	}
 
-	if err := r.client.Update(ctx, builderCronJob); err != nil {
-		return nil, errors.Wrap(err, "Failed to update page-builder CronJob")
+	setting := settingKey(settings.Kind, settings.Namespace, settings.Name)
+	if err := r.buildQueue.Schedule(client.ObjectKeyFromObject(page), setting, int(settings.Spec.MaxConcurrentBuilds), schedule); err != nil {
+		err = reconcile.TerminalError(err)
+		r.recorder.Event(page, apiv1.EventTypeWarning, "InvalidBuildSpec", err.Error())
+		return nil, err
 	}
 
 	return builderCronJob, nil
 }
 
-func (r *HugoPageReconciler) upsertPageIngress(ctx context.Context, page *hugohosterv1alpha1.HugoPage, settings *hugohosterv1alpha1.Setting) (*networkingv1.Ingress, error) {
-	ingress := &networkingv1.Ingress{}
-	err := r.client.Get(ctx, types.NamespacedName{Name: page.Name, Namespace: page.Namespace}, ingress)
+// upsertS3CredentialsSecret returns the name of the Secret in the namespace of page that holds the S3 credentials.
+// A ClusterSetting references a Secret in another namespace, which is mirrored next to the page,
+// as the builder Job can only read Secrets from its own namespace.
+func (r *HugoPageReconciler) upsertS3CredentialsSecret(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (string, error) {
+	credentials, err := s3Credentials(page, settings)
+	if err != nil {
+		return "", reconcile.TerminalError(err)
+	}
+
+	sourceNamespace := settings.SecretNamespace(credentials.Namespace)
+
+	if sourceNamespace == "" || sourceNamespace == page.Namespace {
+		return credentials.Name, nil
+	}
+
+	source := &apiv1.Secret{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: credentials.Name, Namespace: sourceNamespace}, source); err != nil {
+		return "", errors.Wrapf(err, "Failed to get S3 credentials Secret %s/%s", sourceNamespace, credentials.Name)
+	}
+
+	secretName := fmt.Sprintf("%s-s3-credentials", page.Name)
+	secret := &apiv1.Secret{}
+	secret.ObjectMeta = metav1.ObjectMeta{
+		Name:      secretName,
+		Namespace: page.Namespace,
+		Labels:    makeLabels(page, "builder"),
+	}
+
+	secret.Type = apiv1.SecretTypeOpaque
+	secret.Data = map[string][]byte{
+		credentials.AccessKeyIDKey:     source.Data[credentials.AccessKeyIDKey],
+		credentials.SecretAccessKeyKey: source.Data[credentials.SecretAccessKeyKey],
+	}
+
+	if err := r.apply(ctx, page, secret); err != nil {
+		return "", errors.Wrap(err, "Failed to apply S3 credentials Secret")
+	}
+
+	return secretName, nil
+}
 
+func (r *HugoPageReconciler) upsertPageIngress(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (*networkingv1.Ingress, error) {
+	ingress := &networkingv1.Ingress{}
 	pathTypePrefix := networkingv1.PathTypePrefix
 
 	ingress.ObjectMeta = metav1.ObjectMeta{
@@ -329,11 +438,16 @@ func (r *HugoPageReconciler) upsertPageIngress(ctx context.Context, page *hugoho
 		Annotations: make(map[string]string),
 	}
 
+	ingressClassName := settings.Spec.Routing.IngressClassName
+	if page.Spec.Routing.IngressClassName != nil {
+		ingressClassName = *page.Spec.Routing.IngressClassName
+	}
+
 	ingress.Spec = networkingv1.IngressSpec{
-		IngressClassName: &settings.Spec.IngressClassName,
+		IngressClassName: &ingressClassName,
 		Rules: []networkingv1.IngressRule{
 			{
-				Host: page.Spec.URL,
+				Host: page.Spec.Routing.Host,
 				IngressRuleValue: networkingv1.IngressRuleValue{
 					HTTP: &networkingv1.HTTPIngressRuleValue{
 						Paths: []networkingv1.HTTPIngressPath{
@@ -342,7 +456,7 @@ func (r *HugoPageReconciler) upsertPageIngress(ctx context.Context, page *hugoho
 								PathType: &pathTypePrefix,
 								Backend: networkingv1.IngressBackend{
 									Service: &networkingv1.IngressServiceBackend{
-										Name: fmt.Sprintf("nginx-proxy-%s-svc", page.Name),
+										Name: nginxProxyServiceName(page),
 										Port: networkingv1.ServiceBackendPort{
 											Number: 80,
 										},
@@ -356,45 +470,36 @@ func (r *HugoPageReconciler) upsertPageIngress(ctx context.Context, page *hugoho
 		},
 	}
 
-	if settings.Spec.TLS.Enable {
+	if settings.Spec.Routing.TLS.Enabled {
 		// Enable TLS in the ingress Spec
 		ingress.Spec.TLS = []networkingv1.IngressTLS{
 			{
-				Hosts:      []string{page.Spec.URL},
+				Hosts:      []string{page.Spec.Routing.Host},
 				SecretName: fmt.Sprintf("%s-page-secret", strings.ReplaceAll(page.Name, ".", "-")),
 			},
 		}
 
 		// Add additional annotations based from our TLS spec
-		for annotationKey, annotationValue := range settings.Spec.TLS.Annotations {
+		for annotationKey, annotationValue := range settings.Spec.Routing.TLS.Annotations {
 			ingress.ObjectMeta.Annotations[annotationKey] = annotationValue
 		}
 	}
 
-	// Set Redirect instance as the owner and controller
-	ctrl.SetControllerReference(page, ingress, r.scheme)
-
-	if err != nil && k8serrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, ingress); err != nil {
-			return nil, errors.Wrap(err, "Failed to create new hugo-page Ingress")
-		}
-	} else if err != nil {
-		return nil, errors.Wrap(err, "Failed to get hugo-page Ingress")
-	}
-
-	if err := r.client.Update(ctx, ingress); err != nil {
-		return nil, errors.Wrap(err, "Failed to update hugo-page Ingress")
+	if err := r.apply(ctx, page, ingress); err != nil {
+		return nil, errors.Wrap(err, "Failed to apply hugo-page Ingress")
 	}
 
 	return ingress, nil
 }
 
-func (r *HugoPageReconciler) upsertNginxProxyService(ctx context.Context, page *hugohosterv1alpha1.HugoPage) (*apiv1.Service, error) {
-	serviceName := fmt.Sprintf("nginx-proxy-%s-svc", page.Name)
+func nginxProxyServiceName(page *hugohosterv1beta1.HugoPage) string {
+	return fmt.Sprintf("nginx-proxy-%s-svc", page.Name)
+}
 
-	service := &apiv1.Service{}
-	err := r.client.Get(ctx, types.NamespacedName{Name: serviceName, Namespace: page.Namespace}, service)
+func (r *HugoPageReconciler) upsertNginxProxyService(ctx context.Context, page *hugohosterv1beta1.HugoPage) (*apiv1.Service, error) {
+	serviceName := nginxProxyServiceName(page)
 
+	service := &apiv1.Service{}
 	service.ObjectMeta = metav1.ObjectMeta{
 		Name:      serviceName,
 		Namespace: page.Namespace,
@@ -413,45 +518,45 @@ func (r *HugoPageReconciler) upsertNginxProxyService(ctx context.Context, page *
 		},
 	}
 
-	// Set Redirect instance as the owner and controller
-	ctrl.SetControllerReference(page, service, r.scheme)
-
-	if err != nil && k8serrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, service); err != nil {
-			return nil, errors.Wrap(err, "Failed to create new hugo-page nginx service")
-		}
-	} else if err != nil {
-		return nil, errors.Wrap(err, "Failed to get hugo-page nginx service")
-	}
-
-	if err := r.client.Update(ctx, service); err != nil {
-		return nil, errors.Wrap(err, "Failed to update hugo-page nginx service")
+	if err := r.apply(ctx, page, service); err != nil {
+		return nil, errors.Wrap(err, "Failed to apply hugo-page nginx service")
 	}
 
 	return service, nil
 }
 
-func (r *HugoPageReconciler) upsertPageNginxProxy(ctx context.Context, page *hugohosterv1alpha1.HugoPage, settings *hugohosterv1alpha1.Setting) (*appsv1.Deployment, error) {
+func (r *HugoPageReconciler) upsertPageNginxProxy(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (*appsv1.Deployment, error) {
 
 	deploymentName := fmt.Sprintf("nginx-proxy-%s", page.Name)
-	oldDeployment := &appsv1.Deployment{}
-	newDeployment := &appsv1.Deployment{}
+	deployment := &appsv1.Deployment{}
 
 	labels := makeLabels(page, "nginx-proxy")
 
-	err := r.client.Get(ctx, types.NamespacedName{Name: deploymentName, Namespace: page.Namespace}, oldDeployment)
-
-	newDeployment.ObjectMeta = metav1.ObjectMeta{
+	deployment.ObjectMeta = metav1.ObjectMeta{
 		Name:      deploymentName,
 		Namespace: page.Namespace,
 		Labels:    labels,
 	}
 
-	newDeployment.Spec = appsv1.DeploymentSpec{
+	// An autoscaled Deployment is applied without replicas, so hugo-hoster never owns the field the HPA scales
+	var replicas *int32
+	if !page.Spec.Serve.Autoscaled {
+		replicas = &settings.Spec.Serve.Replicas
+		if page.Spec.Serve.Replicas != nil {
+			replicas = page.Spec.Serve.Replicas
+		}
+	}
+
+	nginxImage := defaultNginxImage
+	if page.Spec.Serve.Image != "" {
+		nginxImage = page.Spec.Serve.Image
+	}
+
+	deployment.Spec = appsv1.DeploymentSpec{
 		Selector: &metav1.LabelSelector{
 			MatchLabels: labels,
 		},
-		Replicas: &settings.Spec.NginxProxyReplica,
+		Replicas: replicas,
 
 		Template: apiv1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
@@ -461,7 +566,7 @@ func (r *HugoPageReconciler) upsertPageNginxProxy(ctx context.Context, page *hug
 				Containers: []apiv1.Container{
 					{
 						Name:  "nginx",
-						Image: "nginx:alpine",
+						Image: nginxImage,
 						Ports: []apiv1.ContainerPort{
 							{
 								ContainerPort: 80,
@@ -493,62 +598,33 @@ func (r *HugoPageReconciler) upsertPageNginxProxy(ctx context.Context, page *hug
 		},
 	}
 
-	// Set Redirect instance as the owner and controller
-	ctrl.SetControllerReference(page, newDeployment, r.scheme)
-
-	if err != nil && k8serrors.IsNotFound(err) {
-		if err := r.client.Create(ctx, newDeployment); err != nil {
-			return nil, errors.Wrap(err, "Failed to create new hugo-page nginx proxy deployment")
-		}
-	} else if err != nil {
-		return nil, errors.Wrap(err, "Failed to get hugo-page nginx proxy deployment")
-	}
-
-	// only update the deployment if something has changed compared to the previous version
-
-	if !equalNginxProxyDeployment(*newDeployment, *oldDeployment) {
-		if err := r.client.Update(ctx, newDeployment); err != nil {
-			return nil, errors.Wrap(err, "Failed to update hugo-page nginx proxy deployment")
-		}
+	if err := r.apply(ctx, page, deployment); err != nil {
+		return nil, errors.Wrap(err, "Failed to apply hugo-page nginx proxy deployment")
 	}
 
-	return newDeployment, nil
+	return deployment, nil
 }
 
-func (r *HugoPageReconciler) upsertConfigMap(ctx context.Context, page *hugohosterv1alpha1.HugoPage, settings *hugohosterv1alpha1.Setting) (*apiv1.ConfigMap, error) {
+func (r *HugoPageReconciler) upsertConfigMap(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (*apiv1.ConfigMap, error) {
 	configMapName := fmt.Sprintf("nginx-proxy-conf-%s", page.Name)
 	configMap := &apiv1.ConfigMap{}
 
-	clientErr := r.client.Get(ctx, types.NamespacedName{Name: configMapName, Namespace: page.Namespace}, configMap)
-
 	configMap.ObjectMeta = metav1.ObjectMeta{
 		Name:      configMapName,
 		Namespace: page.Namespace,
 		Labels:    makeLabels(page, "nginx-proxy"),
 	}
 
-	// Build the Hugo Build Script
-	// git clone --recurse-submodules -j8 --branch "$GIT_BRANCH" "$REPO_URL" "$PAGE_NAME"
-	// cd "$PAGE_NAME"
-	// hugo
-	// aws s3 cp public/ "s3://$S3_BUCKET_NAME/$PAGE_NAME" --recursive --endpoint-url "$S3_ENDPOINT" --cli-connect-timeout 6000
-
-	buildCmd := []string{}
-	buildCmd = append(buildCmd, "#!/usr/bin/env bash")
-	buildCmd = append(buildCmd, "set -ex")
-	buildCmd = append(buildCmd, "git clone --recurse-submodules -j8 --branch \"$GIT_BRANCH\" \"$REPO_URL\" \"$PAGE_NAME\"")
-	buildCmd = append(buildCmd, "cd \"$PAGE_NAME\"")
-	if page.Spec.Options != nil && len(page.Spec.Options.BuildCommand) > 0 {
-		buildCmd = append(buildCmd, page.Spec.Options.BuildCommand)
-	} else {
-		buildCmd = append(buildCmd, "hugo")
+	buildScript, err := buildScript(page, settings)
+	if err != nil {
+		r.recorder.Event(page, apiv1.EventTypeWarning, "InvalidBuildSpec", err.Error())
+		return nil, err
 	}
-	buildCmd = append(buildCmd, "aws s3 cp public/ \"s3://$S3_BUCKET_NAME/$PAGE_NAME\" --recursive --endpoint-url \"$S3_ENDPOINT\" --cli-connect-timeout 6000")
 
 	// Build the nginx settings
-	proxyUrl := settings.Spec.ProxyURL
+	proxyUrl := settings.Spec.Storage.ServingURL
 	if proxyUrl == "" {
-		proxyUrl = settings.Spec.S3Config.Endpoint
+		proxyUrl = settings.Spec.Storage.S3.Endpoint
 	}
 
 	template, err := template.New("nginx.conf").Parse(nginxConfTemplate)
@@ -558,8 +634,8 @@ func (r *HugoPageReconciler) upsertConfigMap(ctx context.Context, page *hugohost
 
 	nginxValue := map[string]string{
 		"S3_URL":      proxyUrl,
-		"BUCKET_NAME": settings.Spec.S3Config.BucketName,
-		"PAGE_NAME":   page.Name,
+		"BUCKET_NAME": settings.Spec.Storage.S3.Bucket,
+		"PAGE_PATH":   pagePrefix(page),
 	}
 
 	var nginxConf bytes.Buffer
@@ -567,120 +643,17 @@ func (r *HugoPageReconciler) upsertConfigMap(ctx context.Context, page *hugohost
 
 	configMap.Data = map[string]string{
 		"nginx.conf":    nginxConf.String(),
-		"build-hugo.sh": strings.Join(buildCmd, "\n"),
-	}
-
-	// Set Redirect instance as the owner and controller
-	ctrl.SetControllerReference(page, configMap, r.scheme)
-
-	if clientErr != nil && k8serrors.IsNotFound(clientErr) {
-		if err := r.client.Create(ctx, configMap); err != nil {
-			return nil, errors.Wrap(err, "Failed to create new hugo-page nginx proxy config")
-		}
-	} else if clientErr != nil {
-		return nil, errors.Wrap(err, "Failed to get hugo-page nginx proxy proxy config")
+		"build-hugo.sh": buildScript,
 	}
 
-	if err := r.client.Update(ctx, configMap); err != nil {
-		return nil, errors.Wrap(err, "Failed to update hugo-page nginx proxy proxy config")
+	if err := r.apply(ctx, page, configMap); err != nil {
+		return nil, errors.Wrap(err, "Failed to apply hugo-page nginx proxy config")
 	}
 
 	return configMap, nil
 }
 
-func equalNginxProxyDeployment(left, right appsv1.Deployment) bool {
-	if !cmp.Equal(left.ObjectMeta.Name, right.ObjectMeta.Name) {
-		return false
-	}
-
-	if !cmp.Equal(left.ObjectMeta.Namespace, right.ObjectMeta.Namespace) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Selector.MatchLabels, right.Spec.Selector.MatchLabels) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Replicas, right.Spec.Replicas) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.ObjectMeta.Labels, right.Spec.Template.ObjectMeta.Labels) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Containers), len(right.Spec.Template.Spec.Containers)) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Containers), 1) && !cmp.Equal(len(right.Spec.Template.Spec.Containers), 1) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Containers[0].Name, right.Spec.Template.Spec.Containers[0].Name) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Containers[0].Image, right.Spec.Template.Spec.Containers[0].Image) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Containers[0].Ports), len(right.Spec.Template.Spec.Containers[0].Ports)) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Containers[0].Ports), 1) && !cmp.Equal(len(right.Spec.Template.Spec.Containers[0].Ports), 1) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort, right.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Containers[0].VolumeMounts), len(right.Spec.Template.Spec.Containers[0].VolumeMounts)) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Containers[0].VolumeMounts), 1) && !cmp.Equal(len(right.Spec.Template.Spec.Containers[0].VolumeMounts), 1) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Containers[0].VolumeMounts[0].Name, right.Spec.Template.Spec.Containers[0].VolumeMounts[0].Name) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath, right.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Containers[0].VolumeMounts[0].SubPath, right.Spec.Template.Spec.Containers[0].VolumeMounts[0].SubPath) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Containers[0].VolumeMounts[0].ReadOnly, right.Spec.Template.Spec.Containers[0].VolumeMounts[0].ReadOnly) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Volumes), len(right.Spec.Template.Spec.Volumes)) {
-		return false
-	}
-
-	if !cmp.Equal(len(left.Spec.Template.Spec.Volumes), 1) && !cmp.Equal(len(right.Spec.Template.Spec.Volumes), 1) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Volumes[0].Name, right.Spec.Template.Spec.Volumes[0].Name) {
-		return false
-	}
-
-	if !cmp.Equal(left.Spec.Template.Spec.Volumes[0].VolumeSource.ConfigMap.LocalObjectReference.Name, right.Spec.Template.Spec.Volumes[0].VolumeSource.ConfigMap.LocalObjectReference.Name) {
-		return false
-	}
-
-	return true
-}
-
-func makeLabels(page *hugohosterv1alpha1.HugoPage, component string) map[string]string {
+func makeLabels(page *hugohosterv1beta1.HugoPage, component string) map[string]string {
 	return map[string]string{
 		"app":       "hugo-hoster",
 		"component": component,
@@ -715,7 +688,7 @@ http {
 
 	location / {
 	  rewrite ^(.*)\/(?!index\.html)$ $1/index.html last;
-	  proxy_pass {{.S3_URL}}/{{.BUCKET_NAME}}/{{.PAGE_NAME}}/;
+	  proxy_pass {{.S3_URL}}/{{.BUCKET_NAME}}/{{.PAGE_PATH}}/;
 	  proxy_redirect off;
 	  proxy_intercept_errors on;
 	  proxy_set_header Host $http_host;
@@ -0,0 +1,131 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/trace/noop"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// recordingRunnable reports on started when a replica starts it. It needs leader election if the runnable it
+// stands in for does
+type recordingRunnable struct {
+	name               string
+	needLeaderElection bool
+	started            chan<- string
+}
+
+func (r *recordingRunnable) Start(ctx context.Context) error {
+	r.started <- r.name
+	<-ctx.Done()
+	return nil
+}
+
+func (r *recordingRunnable) NeedLeaderElection() bool {
+	return r.needLeaderElection
+}
+
+// startReplica starts a manager configured like main, with stand-ins for the BuildQueue, the Prober and a runnable
+// of all replicas. The returned function stops the manager and waits for it to release its Lease
+func startReplica(replica string, started chan<- string) (manager.Manager, func()) {
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                        scheme.Scheme,
+		Metrics:                       metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress:        "0",
+		LeaderElection:                true,
+		LeaderElectionID:              LeaderElectionID,
+		LeaderElectionNamespace:       "default",
+		LeaderElectionReleaseOnCancel: true,
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	tracer := noop.NewTracerProvider().Tracer("leader_election_test")
+	runnables := map[string]manager.LeaderElectionRunnable{
+		"build-queue": NewBuildQueue(mgr.GetClient(), 1, nil, record.NewFakeRecorder(10), tracer),
+		"prober":      NewProber(mgr.GetClient(), nil, "settings", tracer),
+	}
+
+	for name, runnable := range runnables {
+		Expect(mgr.Add(&recordingRunnable{name: replica + "/" + name, needLeaderElection: runnable.NeedLeaderElection(), started: started})).To(Succeed())
+	}
+
+	Expect(mgr.Add(&recordingRunnable{name: replica + "/all", started: started})).To(Succeed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer GinkgoRecover()
+		defer close(done)
+
+		Expect(mgr.Start(ctx)).To(Succeed())
+	}()
+
+	return mgr, func() {
+		cancel()
+		<-done
+	}
+}
+
+// receiveStarted returns the names of the next count runnables started, or those started until timeout
+func receiveStarted(started <-chan string, count int, timeout time.Duration) []string {
+	names := []string{}
+	deadline := time.After(timeout)
+
+	for len(names) < count {
+		select {
+		case name := <-started:
+			names = append(names, name)
+
+		case <-deadline:
+			return names
+		}
+	}
+
+	return names
+}
+
+var _ = Describe("Leader election", func() {
+	It("runs the builds and probes on the leader only and hands over when it stops", func() {
+		started := make(chan string, 10)
+
+		leader, stopLeader := startReplica("a", started)
+		Eventually(leader.Elected(), 30*time.Second).Should(BeClosed())
+		Expect(receiveStarted(started, 3, 10*time.Second)).To(ConsistOf("a/build-queue", "a/prober", "a/all"))
+
+		follower, stopFollower := startReplica("b", started)
+		defer stopFollower()
+
+		Eventually(started, 10*time.Second).Should(Receive(Equal("b/all")))
+		Consistently(follower.Elected(), 3*time.Second).ShouldNot(BeClosed())
+		Expect(started).To(BeEmpty())
+
+		// the Lease lasts 15 seconds, the follower only takes over before it expired if the leader released it
+		stopLeader()
+		Eventually(follower.Elected(), 10*time.Second).Should(BeClosed())
+		Expect(receiveStarted(started, 2, 10*time.Second)).To(ConsistOf("b/build-queue", "b/prober"))
+	})
+})
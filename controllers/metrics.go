@@ -1,33 +1,313 @@
 package controllers
 
 import (
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
 )
 
 var reconcilerDuration = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
-		Name: "hugopage_reconciler_duration",
-		Help: "How long the reconcile loop ran for in microseconds",
+		Name:    "hugopage_reconcile_duration_seconds",
+		Help:    "How long the reconcile loop ran for",
+		Buckets: prometheus.DefBuckets,
 	},
 	[]string{
 		"reconciler",
-		"name",
-		"namespace",
 	},
 )
 
 var active = prometheus.NewGaugeVec(
 	prometheus.GaugeOpts{
 		Name: "hugopage_active",
-		Help: "Number of installed hugopage objects for this instance",
+		Help: "Number of hugopage objects reconciled by this instance",
 	},
 	[]string{
 		"type",
 	},
 )
 
+var buildDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "hugopage_build_duration_seconds",
+		Help:    "How long builds ran for",
+		Buckets: prometheus.ExponentialBuckets(10, 2, 10),
+	},
+	[]string{
+		"result",
+	},
+)
+
+var builds = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hugopage_builds_total",
+		Help: "Number of finished builds",
+	},
+	[]string{
+		"namespace",
+		"page",
+		"result",
+	},
+)
+
+var lastSuccessfulBuild = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hugopage_last_successful_build_timestamp_seconds",
+		Help: "Time the last successful build finished, time() minus it is the time since the last successful build",
+	},
+	[]string{
+		"namespace",
+		"page",
+	},
+)
+
+var commitToLive = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "hugopage_commit_to_live_seconds",
+		Help:    "Time from the commit time of a new commit until its build was published",
+		Buckets: prometheus.ExponentialBuckets(30, 2, 12),
+	},
+)
+
+var publishedBytes = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hugopage_published_bytes",
+		Help: "Size of the site published by the last successful build",
+	},
+	[]string{
+		"namespace",
+		"page",
+	},
+)
+
+var publishedFiles = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hugopage_published_files",
+		Help: "Number of files published by the last successful build",
+	},
+	[]string{
+		"namespace",
+		"page",
+	},
+)
+
+var driftCorrections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hugopage_drift_corrections_total",
+		Help: "Number of child resources restored after they were modified outside of hugo-hoster",
+	},
+	[]string{
+		"kind",
+	},
+)
+
+var buildQueueDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hugopage_build_queue_depth",
+		Help: "Number of builds waiting for a free slot",
+	},
+	[]string{
+		"priority",
+	},
+)
+
+var buildQueueWait = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "hugopage_build_queue_wait_seconds",
+		Help:    "Time builds waited in the queue before they were started",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	},
+	[]string{
+		"priority",
+	},
+)
+
+var probeSuccess = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hugopage_probe_success",
+		Help: "Whether the last probe of the page passed",
+	},
+	[]string{
+		"namespace",
+		"page",
+	},
+)
+
+var probeDuration = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hugopage_probe_duration_seconds",
+		Help: "How long the last probe of the page took",
+	},
+	[]string{
+		"namespace",
+		"page",
+	},
+)
+
+var probeStatusCode = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hugopage_probe_status_code",
+		Help: "HTTP status code of the last probe of the page, 0 if it was not answered",
+	},
+	[]string{
+		"namespace",
+		"page",
+	},
+)
+
+var probeFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hugopage_probe_failures_total",
+		Help: "Number of failed probes by reason",
+	},
+	[]string{
+		"namespace",
+		"page",
+		"reason",
+	},
+)
+
+var rollbacks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hugopage_rollbacks_total",
+		Help: "Number of rollbacks to the known-good build after a build failed the probe",
+	},
+	[]string{
+		"namespace",
+		"page",
+	},
+)
+
 func init() {
 	metrics.Registry.MustRegister(reconcilerDuration)
 	metrics.Registry.MustRegister(active)
+	metrics.Registry.MustRegister(buildDuration)
+	metrics.Registry.MustRegister(builds)
+	metrics.Registry.MustRegister(lastSuccessfulBuild)
+	metrics.Registry.MustRegister(commitToLive)
+	metrics.Registry.MustRegister(publishedBytes)
+	metrics.Registry.MustRegister(publishedFiles)
+	metrics.Registry.MustRegister(probeSuccess)
+	metrics.Registry.MustRegister(probeDuration)
+	metrics.Registry.MustRegister(probeStatusCode)
+	metrics.Registry.MustRegister(probeFailures)
+	metrics.Registry.MustRegister(rollbacks)
+	metrics.Registry.MustRegister(driftCorrections)
+	metrics.Registry.MustRegister(buildQueueDepth)
+	metrics.Registry.MustRegister(buildQueueWait)
+}
+
+// activePages tracks the pages reconciled by this instance by their type to maintain the active gauge
+var activePages = &pageTracker{pages: map[types.NamespacedName]string{}}
+
+type pageTracker struct {
+	mu    sync.Mutex
+	pages map[types.NamespacedName]string
+}
+
+// pageType tells apart pages, previews and environments
+func pageType(page *hugohosterv1beta1.HugoPage) string {
+	switch {
+	case page.Labels[hugohosterv1beta1.PreviewOfLabel] != "":
+		return "preview"
+
+	case page.Labels[hugohosterv1beta1.EnvironmentOfLabel] != "":
+		return "environment"
+
+	default:
+		return "page"
+	}
+}
+
+// track records page as active and exports the metrics kept in its status, which survive a restart of the controller
+func (t *pageTracker) track(page *hugohosterv1beta1.HugoPage) {
+	t.set(client.ObjectKeyFromObject(page), pageType(page))
+
+	if page.Status.LastSuccessTime != nil {
+		lastSuccessfulBuild.WithLabelValues(page.Namespace, page.Name).Set(float64(page.Status.LastSuccessTime.Unix()))
+	}
+
+	if build := page.Status.LastBuild; build.Result == hugohosterv1beta1.BuildResultSuccess && build.PublishedFiles > 0 {
+		publishedBytes.WithLabelValues(page.Namespace, page.Name).Set(float64(build.PublishedBytes))
+		publishedFiles.WithLabelValues(page.Namespace, page.Name).Set(float64(build.PublishedFiles))
+	}
+}
+
+// forget removes the page and its metrics, so deleted pages like closed previews leave no series behind
+func (t *pageTracker) forget(page types.NamespacedName) {
+	t.set(page, "")
+
+	labels := prometheus.Labels{"namespace": page.Namespace, "page": page.Name}
+	builds.DeletePartialMatch(labels)
+	lastSuccessfulBuild.Delete(labels)
+	publishedBytes.Delete(labels)
+	publishedFiles.Delete(labels)
+	probeSuccess.Delete(labels)
+	probeDuration.Delete(labels)
+	probeStatusCode.Delete(labels)
+	probeFailures.DeletePartialMatch(labels)
+	rollbacks.Delete(labels)
+}
+
+func (t *pageTracker) set(page types.NamespacedName, pageType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if pageType == "" {
+		delete(t.pages, page)
+	} else {
+		t.pages[page] = pageType
+	}
+
+	counts := map[string]int{"page": 0, "preview": 0, "environment": 0}
+	for _, pageType := range t.pages {
+		counts[pageType]++
+	}
+
+	for pageType, count := range counts {
+		active.WithLabelValues(pageType).Set(float64(count))
+	}
+}
+
+// observeBuild records a build of page that just finished after previous
+func observeBuild(page *hugohosterv1beta1.HugoPage, previous, build hugohosterv1beta1.BuildStatus) {
+	builds.WithLabelValues(page.Namespace, page.Name, string(build.Result)).Inc()
+
+	if build.StartTime != nil {
+		buildDuration.WithLabelValues(string(build.Result)).Observe(build.CompletionTime.Sub(build.StartTime.Time).Seconds())
+	}
+
+	if latency, ok := commitToLiveLatency(previous, build); ok {
+		commitToLive.Observe(latency.Seconds())
+	}
+}
+
+// commitToLiveLatency returns the time from the commit of build until it was published.
+// A rebuild of the same commit says nothing about how fast a change goes live, so it has none.
+func commitToLiveLatency(previous, build hugohosterv1beta1.BuildStatus) (time.Duration, bool) {
+	if build.Result != hugohosterv1beta1.BuildResultSuccess || build.CommitTime == nil || build.Commit == previous.Commit {
+		return 0, false
+	}
+
+	return build.CompletionTime.Sub(build.CommitTime.Time), true
+}
+
+// observeProbe records the result of probing page
+func observeProbe(page *hugohosterv1beta1.HugoPage, result probeResult) {
+	success := 0.0
+	if result.reason == "" {
+		success = 1
+	} else {
+		probeFailures.WithLabelValues(page.Namespace, page.Name, result.reason).Inc()
+	}
+
+	probeSuccess.WithLabelValues(page.Namespace, page.Name).Set(success)
+	probeDuration.WithLabelValues(page.Namespace, page.Name).Set(result.latency.Seconds())
+	probeStatusCode.WithLabelValues(page.Namespace, page.Name).Set(float64(result.statusCode))
 }
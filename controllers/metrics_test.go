@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestPageMetrics(t *testing.T) {
+	finished := metav1.NewTime(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC))
+	started := metav1.NewTime(finished.Add(-90 * time.Second))
+	committed := metav1.NewTime(finished.Add(-10 * time.Minute))
+
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "web"}}
+	preview := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{
+		Name:      "metrics-pr-1",
+		Namespace: "web",
+		Labels:    map[string]string{hugohosterv1beta1.PreviewOfLabel: "metrics"},
+	}}
+
+	activePages.track(page)
+	activePages.track(preview)
+	activePages.track(preview)
+
+	if got := testutil.ToFloat64(active.WithLabelValues("preview")); got != 1 {
+		t.Errorf("want 1 active preview, got %v", got)
+	}
+
+	build := hugohosterv1beta1.BuildStatus{
+		Result:         hugohosterv1beta1.BuildResultSuccess,
+		StartTime:      &started,
+		CompletionTime: &finished,
+		Commit:         "abc",
+		CommitTime:     &committed,
+		PublishedBytes: 4096,
+		PublishedFiles: 12,
+	}
+
+	observeBuild(page, hugohosterv1beta1.BuildStatus{}, build)
+	observeBuild(page, build, build)
+
+	page.Status.LastBuild = build
+	page.Status.LastSuccessTime = &finished
+	activePages.track(page)
+
+	if got := testutil.ToFloat64(builds.WithLabelValues("web", "metrics", "Success")); got != 2 {
+		t.Errorf("want 2 successful builds, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(publishedFiles.WithLabelValues("web", "metrics")); got != 12 {
+		t.Errorf("want 12 published files, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(lastSuccessfulBuild.WithLabelValues("web", "metrics")); got != float64(finished.Unix()) {
+		t.Errorf("want last successful build at %d, got %v", finished.Unix(), got)
+	}
+
+	// only the first build of the commit counts towards the commit to live latency
+	if latency, ok := commitToLiveLatency(hugohosterv1beta1.BuildStatus{}, build); !ok || latency != 10*time.Minute {
+		t.Errorf("want commit to live latency of 10m, got %v", latency)
+	}
+
+	if _, ok := commitToLiveLatency(build, build); ok {
+		t.Error("want no commit to live latency for a rebuild of the same commit")
+	}
+
+	activePages.forget(types.NamespacedName{Name: "metrics", Namespace: "web"})
+	activePages.forget(types.NamespacedName{Name: "metrics-pr-1", Namespace: "web"})
+
+	if got := testutil.ToFloat64(active.WithLabelValues("page")); got != 0 {
+		t.Errorf("want no active pages, got %v", got)
+	}
+
+	for name, count := range map[string]int{
+		"builds":                testutil.CollectAndCount(builds),
+		"last successful build": testutil.CollectAndCount(lastSuccessfulBuild),
+		"published bytes":       testutil.CollectAndCount(publishedBytes),
+	} {
+		if count != 0 {
+			t.Errorf("want the %s series of the deleted page removed, got %d series", name, count)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/notify"
+)
+
+// notificationTimeout bounds the delivery of a notification including its retries
+const notificationTimeout = 1 * time.Minute
+
+// defaultNotificationEvents are sent to sinks that do not filter events
+var defaultNotificationEvents = []hugohosterv1beta1.NotificationEvent{
+	hugohosterv1beta1.NotificationBuildFailed,
+	hugohosterv1beta1.NotificationBuildRecovered,
+}
+
+// buildEvents returns the events of build, the most specific first, given the result of the build before it
+func buildEvents(previous hugohosterv1beta1.BuildResult, build hugohosterv1beta1.BuildStatus) []hugohosterv1beta1.NotificationEvent {
+	if build.Result != hugohosterv1beta1.BuildResultSuccess {
+		return []hugohosterv1beta1.NotificationEvent{hugohosterv1beta1.NotificationBuildFailed}
+	}
+
+	if previous == hugohosterv1beta1.BuildResultFailed || previous == hugohosterv1beta1.BuildResultCancelled {
+		return []hugohosterv1beta1.NotificationEvent{hugohosterv1beta1.NotificationBuildRecovered, hugohosterv1beta1.NotificationDeploySucceeded}
+	}
+
+	return []hugohosterv1beta1.NotificationEvent{hugohosterv1beta1.NotificationDeploySucceeded}
+}
+
+// sinkEvent returns the first of events sink is subscribed to, so a sink gets a single notification per build
+func sinkEvent(sink hugohosterv1beta1.NotificationSinkSpec, events []hugohosterv1beta1.NotificationEvent) (hugohosterv1beta1.NotificationEvent, bool) {
+	subscribed := sink.Events
+	if len(subscribed) == 0 {
+		subscribed = defaultNotificationEvents
+	}
+
+	for _, event := range events {
+		for _, s := range subscribed {
+			if s == event {
+				return event, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// buildLogURL renders the buildLogURL template of settings for build, run by the builder Job job
+func buildLogURL(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, build hugohosterv1beta1.BuildStatus, job string) (string, error) {
+	tmpl, err := template.New("buildLogURL").Option("missingkey=error").Parse(settings.Spec.BuildLogURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse buildLogURL of %s %s", settings.Kind, settings.Name)
+	}
+
+	logURL := &strings.Builder{}
+	if err := tmpl.Execute(logURL, map[string]any{
+		"Namespace": page.Namespace,
+		"Page":      page.Name,
+		"Build":     build.Number,
+		"Job":       job,
+	}); err != nil {
+		return "", errors.Wrapf(err, "Failed to render buildLogURL of %s %s", settings.Kind, settings.Name)
+	}
+
+	return logURL.String(), nil
+}
+
+// notifyBuild sends the notifications of build, run by the builder Job job, to the sinks of page and its settings.
+// Notifications are delivered in the background and failures are reported as events of page.
+func (r *HugoPageReconciler) notifyBuild(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, previous hugohosterv1beta1.BuildResult, build hugohosterv1beta1.BuildStatus, job string) {
+	if len(page.Spec.Notifications) == 0 && len(settings.Spec.Notifications) == 0 {
+		return
+	}
+
+	notification := notify.Notification{
+		Page:      page.Name,
+		Namespace: page.Namespace,
+		URL:       pageBaseURL(page, settings),
+		Build:     build.Number,
+		Result:    string(build.Result),
+		Commit:    build.Commit,
+	}
+
+	if build.StartTime != nil && build.CompletionTime != nil {
+		notification.Duration = build.CompletionTime.Sub(build.StartTime.Time)
+	}
+
+	if build.Log != nil {
+		notification.Logs = fmt.Sprintf("kubectl hugo logs %s -n %s --build %d", page.Name, page.Namespace, build.Number)
+	}
+
+	if settings.Spec.BuildLogURL != "" {
+		logURL, err := buildLogURL(page, settings, build, job)
+		if err != nil {
+			r.recorder.Event(page, apiv1.EventTypeWarning, "NotificationFailed", err.Error())
+		}
+
+		notification.LogURL = logURL
+	}
+
+	events := buildEvents(previous, build)
+
+	sinks := []struct {
+		owner string
+		specs []hugohosterv1beta1.NotificationSinkSpec
+	}{
+		{"HugoPage", page.Spec.Notifications},
+		{settings.Kind, settings.Spec.Notifications},
+	}
+
+	// the page is updated by the reconcile while notifications are delivered
+	notified := page.DeepCopy()
+
+	for _, owner := range sinks {
+		for _, spec := range owner.specs {
+			event, ok := sinkEvent(spec, events)
+			if !ok {
+				continue
+			}
+
+			sink, err := r.notificationSink(ctx, page, settings, owner.owner, spec)
+			if err != nil {
+				r.recorder.Eventf(page, apiv1.EventTypeWarning, "NotificationFailed", "Failed to notify %s: %s", spec.Name, err.Error())
+				continue
+			}
+
+			sinkNotification := notification
+			sinkNotification.Event = string(event)
+
+			go r.sendNotification(ctx, notified, sink, sinkNotification)
+		}
+	}
+}
+
+// notificationSink resolves the Secrets of spec, a sink of owner. Secrets of the sinks of page are read from its namespace
+func (r *HugoPageReconciler) notificationSink(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, owner string, spec hugohosterv1beta1.NotificationSinkSpec) (notify.Sink, error) {
+	sink := notify.Sink{
+		// the owner keeps sinks of a page and of its Setting apart that share a name
+		Name:     owner + "/" + spec.Name,
+		Type:     string(spec.Type),
+		URL:      spec.URL,
+		RoomID:   spec.RoomID,
+		Template: spec.Template,
+
+		// only cluster administrators may notify services inside the cluster
+		Internal: owner == hugohosterv1beta1.ClusterSettingKind,
+	}
+
+	secretNamespace := func(ref *hugohosterv1beta1.SecretKeyRef) string {
+		if owner == "HugoPage" {
+			return page.Namespace
+		}
+
+		return settings.SecretNamespace(ref.Namespace)
+	}
+
+	if ref := spec.URLSecret; ref != nil {
+		url, err := r.secretValue(ctx, secretNamespace(ref), ref, "notification URL")
+		if err != nil {
+			return notify.Sink{}, err
+		}
+
+		sink.URL = url
+	}
+
+	if ref := spec.TokenSecret; ref != nil {
+		token, err := r.secretValue(ctx, secretNamespace(ref), ref, "notification token")
+		if err != nil {
+			return notify.Sink{}, err
+		}
+
+		sink.Token = token
+	}
+
+	return sink, nil
+}
+
+// sendNotification delivers notification to sink, outliving the reconcile that detected the build
+func (r *HugoPageReconciler) sendNotification(ct context.Context, page *hugohosterv1beta1.HugoPage, sink notify.Sink, notification notify.Notification) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ct), notificationTimeout)
+	defer cancel()
+
+	if err := r.notifier.Send(ctx, sink, notification); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to send notification", "sink", sink.Name)
+		r.recorder.Eventf(page, apiv1.EventTypeWarning, "NotificationFailed", "Failed to notify %s about %s of build %d: %s", sink.Name, notification.Event, notification.Build, err.Error())
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+func TestSinkEvent(t *testing.T) {
+	all := []hugohosterv1beta1.NotificationEvent{
+		hugohosterv1beta1.NotificationBuildFailed,
+		hugohosterv1beta1.NotificationBuildRecovered,
+		hugohosterv1beta1.NotificationDeploySucceeded,
+	}
+	deploys := []hugohosterv1beta1.NotificationEvent{hugohosterv1beta1.NotificationDeploySucceeded}
+
+	tests := []struct {
+		name     string
+		previous hugohosterv1beta1.BuildResult
+		result   hugohosterv1beta1.BuildResult
+		events   []hugohosterv1beta1.NotificationEvent
+		want     hugohosterv1beta1.NotificationEvent
+	}{
+		{name: "failure", previous: hugohosterv1beta1.BuildResultSuccess, result: hugohosterv1beta1.BuildResultFailed, want: hugohosterv1beta1.NotificationBuildFailed},
+		{name: "timeout", result: hugohosterv1beta1.BuildResultCancelled, want: hugohosterv1beta1.NotificationBuildFailed},
+		{name: "success is not notified by default", previous: hugohosterv1beta1.BuildResultSuccess, result: hugohosterv1beta1.BuildResultSuccess},
+		{name: "first build", result: hugohosterv1beta1.BuildResultSuccess, events: all, want: hugohosterv1beta1.NotificationDeploySucceeded},
+		{name: "recovery", previous: hugohosterv1beta1.BuildResultFailed, result: hugohosterv1beta1.BuildResultSuccess, want: hugohosterv1beta1.NotificationBuildRecovered},
+		{name: "recovery is notified once", previous: hugohosterv1beta1.BuildResultCancelled, result: hugohosterv1beta1.BuildResultSuccess, events: all, want: hugohosterv1beta1.NotificationBuildRecovered},
+		{name: "recovery is a deploy", previous: hugohosterv1beta1.BuildResultFailed, result: hugohosterv1beta1.BuildResultSuccess, events: deploys, want: hugohosterv1beta1.NotificationDeploySucceeded},
+		{name: "filtered failure", result: hugohosterv1beta1.BuildResultFailed, events: deploys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := hugohosterv1beta1.NotificationSinkSpec{Name: "team", Events: tt.events}
+			build := hugohosterv1beta1.BuildStatus{Result: tt.result}
+
+			got, ok := sinkEvent(sink, buildEvents(tt.previous, build))
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("want event %q, got %q (%v)", tt.want, got, ok)
+			}
+		})
+	}
+}
+
+func TestBuildLogURL(t *testing.T) {
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.ClusterSettingKind, Name: "default"}
+	build := hugohosterv1beta1.BuildStatus{Number: 7}
+
+	settings.Spec.BuildLogURL = "https://logs.example.com/{{ .Namespace }}/{{ .Page }}/{{ .Build }}?job={{ .Job }}"
+	logURL, err := buildLogURL(page, settings, build, "blog-28034")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "https://logs.example.com/web/blog/7?job=blog-28034"; logURL != want {
+		t.Errorf("want %s, got %s", want, logURL)
+	}
+
+	settings.Spec.BuildLogURL = "https://logs.example.com/{{ .Pod }}"
+	if _, err := buildLogURL(page, settings, build, "blog-28034"); err == nil {
+		t.Error("want an error for an unknown field")
+	}
+}
+
+func TestNotificationSinkInternal(t *testing.T) {
+	r := &HugoPageReconciler{}
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+	spec := hugohosterv1beta1.NotificationSinkSpec{Name: "hook", Type: hugohosterv1beta1.NotificationSinkWebhook, URL: "http://hooks.monitoring.svc/"}
+
+	for owner, want := range map[string]bool{
+		"HugoPage":                           false,
+		hugohosterv1beta1.SettingKind:        false,
+		hugohosterv1beta1.ClusterSettingKind: true,
+	} {
+		settings := &pageClient.ResolvedSetting{Kind: owner, Name: "default"}
+
+		sink, err := r.notificationSink(context.Background(), page, settings, owner, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sink.Internal != want {
+			t.Errorf("want the sink of a %s internal %v, got %v", owner, want, sink.Internal)
+		}
+	}
+}
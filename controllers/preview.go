@@ -0,0 +1,277 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/forge"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPreviewPollInterval = 5 * time.Minute
+
+	// defaultSecretKey is the key read from a Secret if a SecretKeyRef has none
+	defaultSecretKey = "token"
+)
+
+func previewName(page *hugohosterv1beta1.HugoPage, number int) string {
+	return childPageName(page.Name, fmt.Sprintf("-pr-%d", number))
+}
+
+// reconcilePreviews creates a preview Hugo Page for every open pull request of page and deletes the previews of closed ones.
+// It returns the interval after which the pull requests have to be listed again.
+func (r *HugoPageReconciler) reconcilePreviews(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) (time.Duration, error) {
+	if page.Spec.Previews == nil && len(page.Status.Previews) == 0 {
+		return 0, nil
+	}
+
+	previews := []*hugohosterv1beta1.HugoPage{}
+	statuses := []hugohosterv1beta1.PreviewStatus{}
+	pollInterval := time.Duration(0)
+
+	if page.Spec.Previews != nil {
+		pollInterval = defaultPreviewPollInterval
+		if page.Spec.Previews.PollInterval != nil {
+			pollInterval = page.Spec.Previews.PollInterval.Duration
+		}
+
+		forgeClient, err := r.forgeFor(ctx, settings)
+		if err != nil {
+			r.recorder.Event(page, apiv1.EventTypeWarning, "InvalidPreviewSpec", err.Error())
+			return 0, err
+		}
+
+		pullRequests, err := forgeClient.OpenPullRequests(ctx, page.Spec.Source.Repository)
+		if err != nil {
+			return 0, errors.Wrap(err, "Failed to list open pull requests")
+		}
+
+		previews, statuses, err = desiredPreviews(page, settings, pullRequests)
+		if err != nil {
+			r.recorder.Event(page, apiv1.EventTypeWarning, "InvalidPreviewSpec", err.Error())
+			return 0, err
+		}
+
+		if page.Spec.Previews.AllowForks && settings.Spec.Storage.S3.ForkPreviewCredentialsSecret == nil && hasFork(pullRequests) {
+			r.recorder.Eventf(page, apiv1.EventTypeWarning, "ForkPreviewsRefused", "Pull requests from forks are not previewed, as %s %s has no storage.s3.forkPreviewCredentialsSecret", settings.Kind, settings.Name)
+		}
+	}
+
+	deleted, err := r.syncChildPages(ctx, page, hugohosterv1beta1.PreviewOfLabel, previews)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, name := range deleted {
+		r.recorder.Eventf(page, apiv1.EventTypeNormal, "PreviewDeleted", "Deleted preview Hugo Page %s of a closed pull request", name)
+	}
+
+	// the commits pushed to a pull request are pending until their preview is built
+	for i, status := range statuses {
+		if !hasPreviewCommit(page.Status.Previews, status) {
+			r.reportCommitStatus(ctx, previews[i], settings, status.Commit, forge.CommitStatePending, "Building preview")
+		}
+	}
+
+	if equality.Semantic.DeepEqual(statuses, page.Status.Previews) || (len(statuses) == 0 && len(page.Status.Previews) == 0) {
+		return pollInterval, nil
+	}
+
+	for _, status := range statuses {
+		if !hasPreview(page.Status.Previews, status.Number) {
+			r.recorder.Eventf(page, apiv1.EventTypeNormal, "PreviewCreated", "Created preview Hugo Page %s for pull request #%d at %s", status.Page, status.Number, status.Host)
+		}
+	}
+
+	page.Status.Previews = statuses
+	if err := r.client.Status().Update(ctx, page); err != nil {
+		return 0, errors.Wrap(err, "Failed to update HugoPage status")
+	}
+
+	return pollInterval, nil
+}
+
+func hasFork(pullRequests []forge.PullRequest) bool {
+	for _, pullRequest := range pullRequests {
+		if pullRequest.Fork {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasPreview(previews []hugohosterv1beta1.PreviewStatus, number int32) bool {
+	for _, preview := range previews {
+		if preview.Number == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasPreviewCommit reports whether previews already contain the commit of status
+func hasPreviewCommit(previews []hugohosterv1beta1.PreviewStatus, status hugohosterv1beta1.PreviewStatus) bool {
+	for _, preview := range previews {
+		if preview.Number == status.Number && preview.Commit == status.Commit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forgeFor returns the client of the forge configured in settings
+func (r *HugoPageReconciler) forgeFor(ctx context.Context, settings *pageClient.ResolvedSetting) (forge.Forge, error) {
+	forgeSpec := settings.Spec.Forge
+	if forgeSpec == nil {
+		return nil, reconcile.TerminalError(errors.Errorf("previews require a forge to be configured in %s %s", settings.Kind, settings.Name))
+	}
+
+	config := forge.Config{
+		Type: string(forgeSpec.Type),
+		URL:  forgeSpec.URL,
+	}
+
+	if ref := forgeSpec.TokenSecret; ref != nil {
+		token, err := r.secretValue(ctx, settings.SecretNamespace(ref.Namespace), ref, "forge token")
+		if err != nil {
+			return nil, err
+		}
+
+		config.Token = token
+	}
+
+	forgeClient, err := r.forges(config)
+	if err != nil {
+		return nil, reconcile.TerminalError(err)
+	}
+
+	return forgeClient, nil
+}
+
+// secretValue returns the value of the key referenced by ref in a Secret in namespace, which holds what
+func (r *HugoPageReconciler) secretValue(ctx context.Context, namespace string, ref *hugohosterv1beta1.SecretKeyRef, what string) (string, error) {
+	secret := &apiv1.Secret{}
+	secretName := types.NamespacedName{Name: ref.Name, Namespace: namespace}
+	if err := r.client.Get(ctx, secretName, secret); err != nil {
+		return "", errors.Wrapf(err, "Failed to get %s Secret %s", what, secretName)
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = defaultSecretKey
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", errors.Errorf("The %s Secret %s has no key %s", what, secretName, key)
+	}
+
+	return strings.TrimSpace(string(value)), nil
+}
+
+// desiredPreviews returns the preview Hugo Pages of pullRequests and their status, sorted by pull request number
+func desiredPreviews(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, pullRequests []forge.PullRequest) ([]*hugohosterv1beta1.HugoPage, []hugohosterv1beta1.PreviewStatus, error) {
+	hostTemplate, err := template.New("host").Option("missingkey=error").Parse(page.Spec.Previews.HostTemplate)
+	if err != nil {
+		return nil, nil, reconcile.TerminalError(errors.Wrap(err, "Failed to parse previews.hostTemplate"))
+	}
+
+	sort.Slice(pullRequests, func(i, j int) bool { return pullRequests[i].Number < pullRequests[j].Number })
+
+	previews := []*hugohosterv1beta1.HugoPage{}
+	statuses := []hugohosterv1beta1.PreviewStatus{}
+
+	for _, pullRequest := range pullRequests {
+		if pullRequest.Fork && (!page.Spec.Previews.AllowForks || settings.Spec.Storage.S3.ForkPreviewCredentialsSecret == nil) {
+			continue
+		}
+
+		host := &bytes.Buffer{}
+		if err := hostTemplate.Execute(host, map[string]any{
+			"Number": pullRequest.Number,
+			"Branch": pullRequest.Branch,
+			"Page":   page.Name,
+		}); err != nil {
+			return nil, nil, reconcile.TerminalError(errors.Wrap(err, "Failed to render previews.hostTemplate"))
+		}
+
+		if errs := validation.IsDNS1123Subdomain(host.String()); len(errs) > 0 {
+			return nil, nil, reconcile.TerminalError(errors.Errorf("previews.hostTemplate rendered the invalid host %q for pull request #%d: %s", host.String(), pullRequest.Number, strings.Join(errs, ", ")))
+		}
+
+		preview := previewPage(page, settings, pullRequest, host.String())
+		previews = append(previews, preview)
+		statuses = append(statuses, hugohosterv1beta1.PreviewStatus{
+			Number: int32(pullRequest.Number),
+			Page:   preview.Name,
+			Host:   preview.Spec.Routing.Host,
+			Commit: pullRequest.Commit,
+		})
+	}
+
+	return previews, statuses, nil
+}
+
+// previewPage returns the Hugo Page building pullRequest, which is page built from the source branch
+// of the pull request, served under host
+func previewPage(page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting, pullRequest forge.PullRequest, host string) *hugohosterv1beta1.HugoPage {
+	preview := childPage(page, settings, previewName(page, pullRequest.Number), hugohosterv1beta1.PreviewOfLabel)
+	preview.Spec.Source.Repository = pullRequest.CloneURL
+	preview.Spec.Source.Branch = pullRequest.Branch
+	preview.Spec.Routing.Host = host
+
+	// the statuses of commits of a fork are reported to the repository the pull request targets
+	preview.Annotations = map[string]string{
+		hugohosterv1beta1.CommitStatusRepositoryAnnotation: page.Spec.Source.Repository,
+	}
+
+	// the author of a fork controls the build, so it gets neither the secrets nor the command of
+	// the page and publishes with credentials only allowed to write previews
+	if pullRequest.Fork {
+		preview.Annotations[hugohosterv1beta1.ForkPreviewAnnotation] = "true"
+		preview.Spec.Build.Env = nil
+		preview.Spec.Build.EnvFrom = nil
+		preview.Spec.Build.Command = ""
+	}
+
+	// previews are short-lived, so they are not worth a persistent cache
+	preview.Spec.Build.Cache = nil
+
+	// the baseURL of the page would point the links of the preview to the production site
+	preview.Spec.Build.Flags.BaseURL = ""
+
+	return preview
+}
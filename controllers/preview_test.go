@@ -0,0 +1,211 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/forge"
+)
+
+const previewRepository = "https://github.com/cedi/site.git"
+
+func previewTestPage(hostTemplate string) *hugohosterv1beta1.HugoPage {
+	return &hugohosterv1beta1.HugoPage{
+		ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "web"},
+		Spec: hugohosterv1beta1.HugoPageSpec{
+			Source: hugohosterv1beta1.SourceSpec{Repository: previewRepository, Branch: "main"},
+			Build: hugohosterv1beta1.BuildSpec{
+				Flags: hugohosterv1beta1.HugoFlagsSpec{BaseURL: "https://cedi.dev/"},
+				Cache: &hugohosterv1beta1.BuildCacheSpec{},
+			},
+			Routing:  hugohosterv1beta1.RoutingSpec{Host: "cedi.dev"},
+			Previews: &hugohosterv1beta1.PreviewSpec{HostTemplate: hostTemplate},
+		},
+	}
+}
+
+func TestDesiredPreviews(t *testing.T) {
+	fake := forge.NewFake()
+	fake.SetPullRequests(previewRepository,
+		forge.PullRequest{Number: 12, Branch: "typo", Commit: "def", CloneURL: previewRepository},
+		forge.PullRequest{Number: 3, Branch: "feature", Commit: "abc", CloneURL: previewRepository},
+		forge.PullRequest{Number: 7, Branch: "evil", Commit: "123", CloneURL: "https://github.com/someone/site.git", Fork: true},
+	)
+
+	pullRequests, err := fake.OpenPullRequests(context.Background(), previewRepository)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := previewTestPage("pr-{{ .Number }}.preview.cedi.dev")
+	page.Labels = map[string]string{"shard": "a"}
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.ClusterSettingKind, Name: "default"}
+
+	previews, statuses, err := desiredPreviews(page, settings, pullRequests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(previews) != 2 || len(statuses) != 2 {
+		t.Fatalf("want 2 previews without the fork, got %d", len(previews))
+	}
+
+	if statuses[0].Number != 3 || statuses[0].Page != "site-pr-3" || statuses[0].Host != "pr-3.preview.cedi.dev" || statuses[0].Commit != "abc" {
+		t.Errorf("unexpected status of first preview: %+v", statuses[0])
+	}
+
+	preview := previews[0]
+	if preview.Labels[hugohosterv1beta1.PreviewOfLabel] != "site" || preview.Labels["shard"] != "a" || preview.Namespace != "web" {
+		t.Errorf("unexpected metadata of preview: %+v", preview.ObjectMeta)
+	}
+
+	if preview.Spec.Source.Branch != "feature" || preview.Spec.Routing.Host != "pr-3.preview.cedi.dev" {
+		t.Errorf("preview does not build the pull request: %+v", preview.Spec)
+	}
+
+	if preview.Spec.Previews != nil || preview.Spec.Build.Cache != nil || preview.Spec.Build.Flags.BaseURL != "" {
+		t.Errorf("preview inherited previews, cache or baseURL: %+v", preview.Spec)
+	}
+
+	if ref := preview.Spec.SettingRef; ref == nil || ref.Kind != hugohosterv1beta1.ClusterSettingKind || ref.Name != "default" {
+		t.Errorf("preview does not reference the setting of its page: %+v", ref)
+	}
+
+	if page.Spec.Build.Cache == nil || page.Spec.Previews == nil {
+		t.Error("desiredPreviews modified the page")
+	}
+
+	// forks are only previewed with credentials restricted to previews
+	page.Spec.Previews.AllowForks = true
+	previews, _, err = desiredPreviews(page, settings, pullRequests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(previews) != 2 {
+		t.Errorf("want no preview of the fork without fork preview credentials, got %d previews", len(previews))
+	}
+
+	settings.Spec.Storage.S3.ForkPreviewCredentialsSecret = &hugohosterv1beta1.S3CredentialsSecretRef{Name: "previews", Namespace: "hugo-hoster"}
+	previews, _, err = desiredPreviews(page, settings, pullRequests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(previews) != 3 || previews[1].Spec.Source.Repository != "https://github.com/someone/site.git" {
+		t.Errorf("want the fork to be previewed from its repository, got %d previews", len(previews))
+	}
+
+	if repository := commitStatusRepository(previews[1]); repository != previewRepository {
+		t.Errorf("want the commit statuses of the fork reported to %s, got %s", previewRepository, repository)
+	}
+}
+
+func TestForkPreviewWithoutSecrets(t *testing.T) {
+	page := previewTestPage("pr-{{ .Number }}.preview.cedi.dev")
+	page.Spec.Previews.AllowForks = true
+	page.Spec.Build.Command = "make site"
+	page.Spec.Build.Env = []apiv1.EnvVar{{Name: "HUGO_PARAMS_TOKEN", ValueFrom: &apiv1.EnvVarSource{SecretKeyRef: &apiv1.SecretKeySelector{Key: "token"}}}}
+	page.Spec.Build.EnvFrom = []apiv1.EnvFromSource{{Prefix: "HUGO_PARAMS_", SecretRef: &apiv1.SecretEnvSource{}}}
+
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.ClusterSettingKind, Name: "default"}
+	settings.Spec.Storage.S3.CredentialsSecret = hugohosterv1beta1.S3CredentialsSecretRef{Name: "s3", Namespace: "hugo-hoster", AccessKeyIDKey: "id", SecretAccessKeyKey: "key"}
+	settings.Spec.Storage.S3.ForkPreviewCredentialsSecret = &hugohosterv1beta1.S3CredentialsSecretRef{Name: "s3-previews", Namespace: "hugo-hoster", AccessKeyIDKey: "preview-id", SecretAccessKeyKey: "preview-key"}
+
+	fork := previewPage(page, settings, forge.PullRequest{Number: 7, Branch: "evil", CloneURL: "https://github.com/someone/site.git", Fork: true}, "pr-7.preview.cedi.dev")
+	if fork.Spec.Build.Env != nil || fork.Spec.Build.EnvFrom != nil || fork.Spec.Build.Command != "" {
+		t.Errorf("want a fork preview without env, envFrom and command, got %+v", fork.Spec.Build)
+	}
+
+	credentials, err := s3Credentials(fork, settings)
+	if err != nil || credentials.Name != "s3-previews" {
+		t.Errorf("want the fork preview built with the fork preview credentials, got %+v, %v", credentials, err)
+	}
+
+	settings.Spec.Storage.S3.ForkPreviewCredentialsSecret = nil
+	if _, err := s3Credentials(fork, settings); err == nil {
+		t.Error("want a fork preview refused without fork preview credentials")
+	}
+
+	// pull requests from the repository itself keep the build of the page
+	preview := previewPage(page, settings, forge.PullRequest{Number: 3, Branch: "feature", CloneURL: previewRepository}, "pr-3.preview.cedi.dev")
+	if len(preview.Spec.Build.Env) != 1 || len(preview.Spec.Build.EnvFrom) != 1 || preview.Spec.Build.Command != "make site" {
+		t.Errorf("want a preview of the repository to keep the build of its page, got %+v", preview.Spec.Build)
+	}
+
+	if credentials, err := s3Credentials(preview, settings); err != nil || credentials.Name != "s3" {
+		t.Errorf("want the preview built with the credentials of the setting, got %+v, %v", credentials, err)
+	}
+}
+
+func TestDesiredPreviewsInvalidHost(t *testing.T) {
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: "default", Namespace: "web"}
+	pullRequests := []forge.PullRequest{{Number: 1, Branch: "Feature/Upper_Case"}}
+
+	for _, hostTemplate := range []string{"{{ .Branch }}.preview.cedi.dev", "{{ .Unknown }}.cedi.dev", "{{ .Number"} {
+		if _, _, err := desiredPreviews(previewTestPage(hostTemplate), settings, pullRequests); err == nil {
+			t.Errorf("want error for host template %q", hostTemplate)
+		}
+	}
+}
+
+func TestPreviewName(t *testing.T) {
+	short := previewTestPage("")
+	if got := previewName(short, 12); got != "site-pr-12" {
+		t.Errorf("want the name of a short page kept, got %s", got)
+	}
+
+	long := previewTestPage("")
+	long.Name = strings.Repeat("documentation-", 5) + "site"
+
+	names := map[string]bool{}
+	for _, number := range []int{1, 12345} {
+		name := previewName(long, number)
+		if len(name) > maxChildPageNameLength || len(nginxProxyServiceName(&hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: name}})) > validation.DNS1035LabelMaxLength {
+			t.Errorf("preview name %s is too long", name)
+		}
+
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			t.Errorf("preview name %s is invalid: %v", name, errs)
+		}
+
+		if !strings.HasSuffix(name, fmt.Sprintf("-pr-%d", number)) {
+			t.Errorf("want preview name %s to end with its pull request", name)
+		}
+
+		names[name] = true
+	}
+
+	// pages sharing a long prefix still get distinct previews
+	other := long.DeepCopy()
+	other.Name = long.Name + "-v2"
+	names[previewName(other, 1)] = true
+
+	if len(names) != 3 {
+		t.Errorf("want distinct preview names, got %v", names)
+	}
+}
@@ -0,0 +1,366 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	// proberInterval is the interval in which the Prober starts the probes that are due
+	proberInterval = 5 * time.Second
+
+	// maxConcurrentProbes limits the probes running at once
+	maxConcurrentProbes = 10
+
+	// maxProbeBody is the part of a response that is searched for the expected content
+	maxProbeBody = 1 << 20
+
+	defaultProbeInterval         = 1 * time.Minute
+	defaultProbeTimeout          = 10 * time.Second
+	defaultProbeFailureThreshold = 3
+)
+
+// probeSpec returns the probe of page with the defaults applied
+func probeSpec(page *hugohosterv1beta1.HugoPage) hugohosterv1beta1.ProbeSpec {
+	spec := hugohosterv1beta1.ProbeSpec{}
+	if page.Spec.Probe != nil {
+		spec = *page.Spec.Probe
+	}
+
+	if spec.Target == "" {
+		spec.Target = hugohosterv1beta1.ProbeTargetService
+	}
+
+	if spec.Path == "" {
+		spec.Path = "/"
+	}
+
+	if spec.Interval == nil {
+		spec.Interval = &metav1.Duration{Duration: defaultProbeInterval}
+	}
+
+	if spec.Timeout == nil {
+		spec.Timeout = &metav1.Duration{Duration: defaultProbeTimeout}
+	}
+
+	if spec.ExpectedStatus == 0 {
+		spec.ExpectedStatus = http.StatusOK
+	}
+
+	if spec.FailureThreshold == 0 {
+		spec.FailureThreshold = defaultProbeFailureThreshold
+	}
+
+	return spec
+}
+
+// probeResult is the outcome of a probe. An empty reason means the probe passed
+type probeResult struct {
+	statusCode int
+	latency    time.Duration
+	reason     string
+	message    string
+}
+
+// probe requests url with the Host header set to host and checks the response against spec
+func probe(ctx context.Context, httpClient *http.Client, url, host string, spec hugohosterv1beta1.ProbeSpec) probeResult {
+	ctx, cancel := context.WithTimeout(ctx, spec.Timeout.Duration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return probeResult{reason: "InvalidTarget", message: err.Error()}
+	}
+
+	req.Host = host
+	req.Header.Set("User-Agent", "hugo-hoster-probe")
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return probeResult{latency: time.Since(start), reason: "Unreachable", message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	result := probeResult{statusCode: resp.StatusCode, latency: time.Since(start)}
+
+	switch {
+	case err != nil:
+		result.reason = "Unreachable"
+		result.message = fmt.Sprintf("Failed to read response: %s", err.Error())
+
+	case resp.StatusCode != int(spec.ExpectedStatus):
+		result.reason = "UnexpectedStatus"
+		result.message = fmt.Sprintf("HTTP %d instead of %d", resp.StatusCode, spec.ExpectedStatus)
+
+	case spec.ExpectedContent != "" && !bytes.Contains(body, []byte(spec.ExpectedContent)):
+		result.reason = "ContentMissing"
+		result.message = fmt.Sprintf("The response does not contain %q", spec.ExpectedContent)
+
+	default:
+		result.message = fmt.Sprintf("HTTP %d in %s", resp.StatusCode, result.latency.Round(time.Millisecond))
+	}
+
+	return result
+}
+
+// probeState tracks the probing of a page between probes
+type probeState struct {
+	next     time.Time
+	failures int32
+	running  bool
+}
+
+// Prober periodically requests every Hugo Page and reports whether it is serving in its Serving condition
+type Prober struct {
+	client        client.Client
+	settingClient *pageClient.SettingsClient
+	settingName   string
+	httpClient    *http.Client
+	tracer        trace.Tracer
+
+	// inCluster is false if the controller runs outside the cluster, where the names of Services do not resolve
+	inCluster bool
+
+	mu     sync.Mutex
+	pages  map[types.NamespacedName]*probeState
+	now    func() time.Time
+	probes chan struct{}
+}
+
+// NewProber creates a new Prober. Redirects are not followed, so they can be expected like any other status
+func NewProber(client client.Client, settingClient *pageClient.SettingsClient, settingName string, tracer trace.Tracer) *Prober {
+	return &Prober{
+		client:        client,
+		settingClient: settingClient,
+		settingName:   settingName,
+		httpClient: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		tracer:    tracer,
+		inCluster: os.Getenv("KUBERNETES_SERVICE_HOST") != "",
+		pages:     map[types.NamespacedName]*probeState{},
+		now:       time.Now,
+		probes:    make(chan struct{}, maxConcurrentProbes),
+	}
+}
+
+// Start runs the Prober until ctx is done
+func (p *Prober) Start(ctx context.Context) error {
+	ticker := time.NewTicker(proberInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			if err := p.tick(ctx); err != nil {
+				log.FromContext(ctx).Error(err, "Failed to probe Hugo Pages")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection makes sure only the leader probes, as it writes the status of the pages
+func (p *Prober) NeedLeaderElection() bool {
+	return true
+}
+
+// tick starts the probes that are due in the background
+func (p *Prober) tick(ctx context.Context) error {
+	pages := &hugohosterv1beta1.HugoPageList{}
+	if err := p.client.List(ctx, pages); err != nil {
+		return errors.Wrap(err, "Failed to list Hugo Pages")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	listed := map[types.NamespacedName]bool{}
+
+	for i := range pages.Items {
+		page := &pages.Items[i]
+		key := client.ObjectKeyFromObject(page)
+		spec := probeSpec(page)
+
+		if spec.Disabled || page.Annotations[hugohosterv1beta1.PausedAnnotation] == "true" {
+			continue
+		}
+
+		listed[key] = true
+
+		state, ok := p.pages[key]
+		if !ok {
+			state = &probeState{}
+			p.pages[key] = state
+		}
+
+		if state.running || state.next.After(now) {
+			continue
+		}
+
+		state.running = true
+		state.next = now.Add(spec.Interval.Duration)
+
+		go p.run(ctx, page.DeepCopy(), spec)
+	}
+
+	for key, state := range p.pages {
+		if !listed[key] && !state.running {
+			delete(p.pages, key)
+		}
+	}
+
+	return nil
+}
+
+// run probes page and records the result
+func (p *Prober) run(ct context.Context, page *hugohosterv1beta1.HugoPage, spec hugohosterv1beta1.ProbeSpec) {
+	key := client.ObjectKeyFromObject(page)
+
+	select {
+	case p.probes <- struct{}{}:
+		defer func() { <-p.probes }()
+
+	case <-ct.Done():
+		return
+	}
+
+	ctx, span := p.tracer.Start(ct, "Prober.run", trace.WithAttributes(
+		attribute.String("page", page.Name),
+		attribute.String("namespace", page.Namespace),
+	))
+	defer span.End()
+
+	result := probeResult{reason: "InvalidTarget"}
+	url, err := p.targetURL(ctx, page, spec)
+	if err == nil {
+		result = probe(ctx, p.httpClient, url, page.Spec.Routing.Host, spec)
+	} else {
+		result.message = err.Error()
+	}
+
+	observeProbe(page, result)
+
+	p.mu.Lock()
+	state, ok := p.pages[key]
+	if !ok {
+		state = &probeState{}
+	}
+
+	state.running = false
+	if result.reason == "" {
+		state.failures = 0
+	} else {
+		state.failures++
+	}
+
+	failures := state.failures
+	p.mu.Unlock()
+
+	if result.reason != "" {
+		span.SetAttributes(attribute.String("reason", result.reason))
+	}
+
+	if err := p.record(ctx, key, result, failures >= spec.FailureThreshold, page.Status.LastBuild.Number); err != nil {
+		span.RecordError(err)
+		log.FromContext(ctx).Error(err, "Failed to record probe result", "page", key)
+	}
+}
+
+// targetURL returns the URL page is probed under. The Service is only probed from inside the cluster, outside of it
+// page is probed under its public URL instead
+func (p *Prober) targetURL(ctx context.Context, page *hugohosterv1beta1.HugoPage, spec hugohosterv1beta1.ProbeSpec) (string, error) {
+	if spec.Target == hugohosterv1beta1.ProbeTargetService && p.inCluster {
+		return fmt.Sprintf("http://%s.%s.svc%s", nginxProxyServiceName(page), page.Namespace, spec.Path), nil
+	}
+
+	settings, err := p.settingClient.Resolve(ctx, page, p.settingName)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to resolve Setting")
+	}
+
+	return strings.TrimSuffix(pageBaseURL(page, settings), "/") + spec.Path, nil
+}
+
+// record sets the Serving condition of page from result of probing probedBuild. A failed probe only marks the page
+// as not serving once failed is true, after the failure threshold was reached.
+func (p *Prober) record(ctx context.Context, key types.NamespacedName, result probeResult, failed bool, probedBuild int32) error {
+	if result.reason != "" && !failed {
+		return nil
+	}
+
+	page := &hugohosterv1beta1.HugoPage{}
+	if err := p.client.Get(ctx, key, page); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	condition := metav1.Condition{
+		Type:               hugohosterv1beta1.HugoPageConditionServing,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: page.Generation,
+		Reason:             "ProbeSucceeded",
+		Message:            result.message,
+	}
+
+	if result.reason != "" {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = result.reason
+	}
+
+	// the message of a passing probe carries its latency, which is not worth a status update
+	current := meta.FindStatusCondition(page.Status.Conditions, condition.Type)
+	if current != nil && current.Status == condition.Status && current.Reason == condition.Reason &&
+		(condition.Status == metav1.ConditionTrue || current.Message == condition.Message) &&
+		page.Status.ProbedBuild == probedBuild {
+		return nil
+	}
+
+	meta.SetStatusCondition(&page.Status.Conditions, condition)
+	page.Status.ProbedBuild = probedBuild
+
+	if err := p.client.Status().Update(ctx, page); err != nil {
+		return errors.Wrap(err, "Failed to update HugoPage status")
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "blog.example.com" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+
+		_, _ = w.Write([]byte(`<html><meta name="generator" content="Hugo"></html>`))
+	}))
+	defer server.Close()
+
+	httpClient := NewProber(nil, nil, "", noop.NewTracerProvider().Tracer("probe_test")).httpClient
+
+	tests := []struct {
+		name   string
+		path   string
+		host   string
+		probe  hugohosterv1beta1.ProbeSpec
+		reason string
+		status int
+	}{
+		{name: "serving", path: "/", host: "blog.example.com", status: http.StatusOK},
+		{name: "content", path: "/", host: "blog.example.com", probe: hugohosterv1beta1.ProbeSpec{ExpectedContent: `content="Hugo"`}, status: http.StatusOK},
+		{name: "missing content", path: "/", host: "blog.example.com", probe: hugohosterv1beta1.ProbeSpec{ExpectedContent: "Jekyll"}, reason: "ContentMissing", status: http.StatusOK},
+		{name: "wrong host", path: "/", host: "other.example.com", reason: "UnexpectedStatus", status: http.StatusNotFound},
+		{name: "redirects are not followed", path: "/moved", host: "blog.example.com", reason: "UnexpectedStatus", status: http.StatusMovedPermanently},
+		{name: "expected redirect", path: "/moved", host: "blog.example.com", probe: hugohosterv1beta1.ProbeSpec{ExpectedStatus: http.StatusMovedPermanently}, status: http.StatusMovedPermanently},
+		{name: "timeout", path: "/slow", host: "blog.example.com", probe: hugohosterv1beta1.ProbeSpec{Timeout: &metav1.Duration{Duration: 50 * time.Millisecond}}, reason: "Unreachable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &hugohosterv1beta1.HugoPage{Spec: hugohosterv1beta1.HugoPageSpec{Probe: &tt.probe}}
+
+			result := probe(context.Background(), httpClient, server.URL+tt.path, tt.host, probeSpec(page))
+			if result.reason != tt.reason || result.statusCode != tt.status {
+				t.Errorf("want reason %q and status %d, got %q and %d: %s", tt.reason, tt.status, result.reason, result.statusCode, result.message)
+			}
+		})
+	}
+}
+
+func TestProberRecord(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := hugohosterv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web", Generation: 2}}
+	page.Status.LastBuild.Number = 7
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(page).WithStatusSubresource(page).Build()
+	prober := NewProber(c, nil, "", noop.NewTracerProvider().Tracer("probe_test"))
+	key := client.ObjectKeyFromObject(page)
+
+	serving := func() *metav1.Condition {
+		t.Helper()
+
+		got := &hugohosterv1beta1.HugoPage{}
+		if err := c.Get(context.Background(), key, got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Status.ProbedBuild != 7 {
+			t.Errorf("want build 7 probed, got %d", got.Status.ProbedBuild)
+		}
+
+		return meta.FindStatusCondition(got.Status.Conditions, hugohosterv1beta1.HugoPageConditionServing)
+	}
+
+	if err := prober.record(context.Background(), key, probeResult{statusCode: 200, message: "HTTP 200 in 5ms"}, false, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if condition := serving(); condition == nil || condition.Status != metav1.ConditionTrue || condition.ObservedGeneration != 2 {
+		t.Fatalf("want page serving, got %v", condition)
+	}
+
+	// a failure below the threshold keeps the page serving
+	failure := probeResult{statusCode: 502, reason: "UnexpectedStatus", message: "HTTP 502 instead of 200"}
+	if err := prober.record(context.Background(), key, failure, false, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if condition := serving(); condition.Status != metav1.ConditionTrue {
+		t.Fatalf("want page serving below the failure threshold, got %v", condition)
+	}
+
+	if err := prober.record(context.Background(), key, failure, true, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if condition := serving(); condition.Status != metav1.ConditionFalse || condition.Reason != "UnexpectedStatus" {
+		t.Fatalf("want page not serving, got %v", condition)
+	}
+}
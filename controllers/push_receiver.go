@@ -0,0 +1,163 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	"github.com/cedi/hugo-hoster/pkg/forge"
+	"github.com/pkg/errors"
+)
+
+// PushWebhookPath is the path the PushReceiver serves the webhooks of the forges on
+const PushWebhookPath = "/hooks/push"
+
+// PushReceiver triggers the builds of the Hugo Pages built from a branch when a forge reports a push to it.
+// It only sets the trigger annotation of the pages, so it runs on every replica while the leader queues the builds
+type PushReceiver struct {
+	client  client.Client
+	address string
+	secret  string
+	tracer  trace.Tracer
+}
+
+// NewPushReceiver creates a new PushReceiver listening on address for webhooks sent with secret
+func NewPushReceiver(client client.Client, address, secret string, tracer trace.Tracer) *PushReceiver {
+	return &PushReceiver{
+		client:  client,
+		address: address,
+		secret:  secret,
+		tracer:  tracer,
+	}
+}
+
+// Start serves the webhooks until ctx is done
+func (p *PushReceiver) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(PushWebhookPath, p)
+
+	server := &http.Server{Addr: p.address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "Failed to serve push webhooks")
+	}
+
+	return nil
+}
+
+// NeedLeaderElection lets every replica receive pushes, as the leader queues the builds
+func (p *PushReceiver) NeedLeaderElection() bool {
+	return false
+}
+
+// ServeHTTP triggers the builds of the push reported by a webhook request
+func (p *PushReceiver) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	ctx, span := p.tracer.Start(request.Context(), "PushReceiver.ServeHTTP")
+	defer span.End()
+
+	if request.Method != http.MethodPost {
+		http.Error(w, "Only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	push, err := forge.ParsePush(request, p.secret)
+	switch {
+	case err == forge.ErrUnauthorized:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+
+	case err != nil:
+		span.RecordError(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+
+	case push == nil:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	span.SetAttributes(attribute.String("repository", push.Repository), attribute.String("branch", push.Branch), attribute.String("commit", push.Commit))
+
+	triggered, err := p.trigger(ctx, push)
+	if err != nil {
+		span.RecordError(err)
+		log.FromContext(ctx).Error(err, "Failed to trigger builds of push", "repository", push.Repository, "branch", push.Branch)
+		http.Error(w, "Failed to trigger builds", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = fmt.Fprintf(w, "Triggered %d builds\n", len(triggered))
+}
+
+// trigger sets the trigger annotation of the pages built from the branch of push and returns their names.
+// A page is triggered once per commit
+func (p *PushReceiver) trigger(ctx context.Context, push *forge.Push) ([]string, error) {
+	pages := &hugohosterv1beta1.HugoPageList{}
+	if err := p.client.List(ctx, pages); err != nil {
+		return nil, errors.Wrap(err, "Failed to list HugoPages")
+	}
+
+	trigger := "push of " + push.Commit
+	triggered := []string{}
+
+	for i := range pages.Items {
+		page := &pages.Items[i]
+
+		branch := page.Spec.Source.Branch
+		if branch == "" {
+			branch = defaultBranch
+		}
+
+		if branch != push.Branch || !forge.SameRepository(page.Spec.Source.Repository, push.Repository) ||
+			page.Annotations[hugohosterv1beta1.TriggerBuildAnnotation] == trigger {
+			continue
+		}
+
+		patch := client.MergeFrom(page.DeepCopy())
+		if page.Annotations == nil {
+			page.Annotations = map[string]string{}
+		}
+		page.Annotations[hugohosterv1beta1.TriggerBuildAnnotation] = trigger
+
+		if err := p.client.Patch(ctx, page, patch); err != nil {
+			return triggered, errors.Wrapf(err, "Failed to trigger build of HugoPage %s/%s", page.Namespace, page.Name)
+		}
+
+		triggered = append(triggered, page.Namespace+"/"+page.Name)
+	}
+
+	return triggered, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestPushReceiver(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	page := func(name, repository, branch string) *hugohosterv1beta1.HugoPage {
+		return &hugohosterv1beta1.HugoPage{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web"},
+			Spec:       hugohosterv1beta1.HugoPageSpec{Source: hugohosterv1beta1.SourceSpec{Repository: repository, Branch: branch}},
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		page("site", "https://github.com/cedi/site.git", ""),
+		page("mirror", "git@github.com:cedi/site.git", "main"),
+		page("staging", "https://github.com/cedi/site.git", "staging"),
+		page("other", "https://github.com/cedi/other.git", "main"),
+	).Build()
+
+	receiver := NewPushReceiver(c, ":0", "s3cr3t", noop.NewTracerProvider().Tracer("push_receiver_test"))
+
+	body := `{"ref":"refs/heads/main","after":"abc123","repository":{"clone_url":"https://github.com/cedi/site.git"}}`
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte(body))
+
+	push := func(signature string) int {
+		request := httptest.NewRequest(http.MethodPost, PushWebhookPath, strings.NewReader(body))
+		request.Header.Set("X-GitHub-Event", "push")
+		request.Header.Set("X-Hub-Signature-256", "sha256="+signature)
+
+		response := httptest.NewRecorder()
+		receiver.ServeHTTP(response, request)
+
+		return response.Code
+	}
+
+	if code := push(strings.Repeat("0", 64)); code != http.StatusUnauthorized {
+		t.Fatalf("want an unsigned push rejected, got %d", code)
+	}
+
+	if code := push(hex.EncodeToString(mac.Sum(nil))); code != http.StatusAccepted {
+		t.Fatalf("want the push accepted, got %d", code)
+	}
+
+	for name, want := range map[string]string{"site": "push of abc123", "mirror": "push of abc123", "staging": "", "other": ""} {
+		got := &hugohosterv1beta1.HugoPage{}
+		if err := c.Get(context.Background(), client.ObjectKey{Name: name, Namespace: "web"}, got); err != nil {
+			t.Fatal(err)
+		}
+
+		if trigger := got.Annotations[hugohosterv1beta1.TriggerBuildAnnotation]; trigger != want {
+			t.Errorf("want trigger %q on %s, got %q", want, name, trigger)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+// fallbackAction is what is done with the known-good copy of a Hugo Page after it was probed
+type fallbackAction int
+
+const (
+	fallbackNone fallbackAction = iota
+
+	// fallbackSnapshot replaces the known-good copy with the last build, which passed the probe
+	fallbackSnapshot
+
+	// fallbackRollback restores the known-good copy, as the last build failed the probe
+	fallbackRollback
+)
+
+// knownGoodPath is the prefix in the bucket the known-good copy of page is kept under
+func knownGoodPath(page *hugohosterv1beta1.HugoPage) string {
+	return "_known-good/" + page.Namespace + "/" + page.Name
+}
+
+// fallbackActionFor decides what to do with the known-good copy from the result of probing the last build in status
+func fallbackActionFor(spec hugohosterv1beta1.ProbeSpec, status *hugohosterv1beta1.HugoPageStatus) fallbackAction {
+	build := status.LastBuild
+	if spec.Disabled || !spec.Rollback || build.Number == 0 || status.ProbedBuild != build.Number || status.Rollback != nil {
+		return fallbackNone
+	}
+
+	serving := meta.FindStatusCondition(status.Conditions, hugohosterv1beta1.HugoPageConditionServing)
+	if serving == nil || status.KnownGoodBuild == build.Number {
+		return fallbackNone
+	}
+
+	switch {
+	case serving.Status == metav1.ConditionTrue && build.Result == hugohosterv1beta1.BuildResultSuccess:
+		return fallbackSnapshot
+
+	case serving.Status == metav1.ConditionFalse && status.KnownGoodBuild > 0:
+		return fallbackRollback
+
+	default:
+		return fallbackNone
+	}
+}
+
+// reconcileProbe keeps the known-good copy of page up to date and rolls back to it when the last build fails the probe.
+// Scheduled builds of a rolled back page are held until its generation changes.
+func (r *HugoPageReconciler) reconcileProbe(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) error {
+	spec := probeSpec(page)
+	status := page.Status.DeepCopy()
+
+	if spec.Disabled {
+		meta.RemoveStatusCondition(&status.Conditions, hugohosterv1beta1.HugoPageConditionServing)
+	}
+
+	// the rollback is over once a new build finished
+	if status.Rollback != nil && status.Rollback.FromBuild != status.LastBuild.Number {
+		status.Rollback = nil
+	}
+
+	action := fallbackActionFor(spec, status)
+	if action != fallbackNone {
+		config, err := readS3Config(ctx, r.client, settings)
+		if err != nil {
+			return err
+		}
+
+		build := status.LastBuild.Number
+
+		switch action {
+		case fallbackSnapshot:
+			if err := r.syncer.Sync(ctx, *config, pagePrefix(page), knownGoodPath(page)); err != nil {
+				return errors.Wrapf(err, "Failed to keep build #%d as known-good", build)
+			}
+
+			status.KnownGoodBuild = build
+			r.recorder.Eventf(page, apiv1.EventTypeNormal, "KnownGoodBuildSaved", "Build #%d passed the probe and is kept to roll back to", build)
+
+		case fallbackRollback:
+			if err := r.syncer.Sync(ctx, *config, knownGoodPath(page), pagePrefix(page)); err != nil {
+				return errors.Wrapf(err, "Failed to roll back to build #%d", status.KnownGoodBuild)
+			}
+
+			status.Rollback = &hugohosterv1beta1.RollbackStatus{
+				FromBuild:  build,
+				ToBuild:    status.KnownGoodBuild,
+				Time:       metav1.Now(),
+				Generation: page.Generation,
+			}
+
+			rollbacks.WithLabelValues(page.Namespace, page.Name).Inc()
+			r.recorder.Eventf(page, apiv1.EventTypeWarning, "RolledBack", "Build #%d failed the probe, rolled back to build #%d", build, status.KnownGoodBuild)
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(*status, page.Status) {
+		page.Status = *status
+		if err := r.client.Status().Update(ctx, page); err != nil {
+			return errors.Wrap(err, "Failed to update HugoPage status")
+		}
+	}
+
+	r.buildQueue.Hold(client.ObjectKeyFromObject(page), status.Rollback != nil && status.Rollback.Generation == page.Generation)
+
+	return nil
+}
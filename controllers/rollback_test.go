@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestFallbackActionFor(t *testing.T) {
+	rollback := hugohosterv1beta1.ProbeSpec{Rollback: true}
+
+	tests := []struct {
+		name      string
+		probe     hugohosterv1beta1.ProbeSpec
+		serving   metav1.ConditionStatus
+		result    hugohosterv1beta1.BuildResult
+		probed    int32
+		knownGood int32
+		rollback  *hugohosterv1beta1.RollbackStatus
+		want      fallbackAction
+	}{
+		{name: "first good build", probe: rollback, serving: metav1.ConditionTrue, result: hugohosterv1beta1.BuildResultSuccess, probed: 5, want: fallbackSnapshot},
+		{name: "newer good build", probe: rollback, serving: metav1.ConditionTrue, result: hugohosterv1beta1.BuildResultSuccess, probed: 5, knownGood: 4, want: fallbackSnapshot},
+		{name: "already kept", probe: rollback, serving: metav1.ConditionTrue, result: hugohosterv1beta1.BuildResultSuccess, probed: 5, knownGood: 5, want: fallbackNone},
+		{name: "rollback disabled", serving: metav1.ConditionTrue, result: hugohosterv1beta1.BuildResultSuccess, probed: 5, want: fallbackNone},
+		{name: "failed build is not kept", probe: rollback, serving: metav1.ConditionTrue, result: hugohosterv1beta1.BuildResultFailed, probed: 5, knownGood: 4, want: fallbackNone},
+		{name: "build not probed yet", probe: rollback, serving: metav1.ConditionFalse, result: hugohosterv1beta1.BuildResultSuccess, probed: 4, knownGood: 4, want: fallbackNone},
+		{name: "bad build", probe: rollback, serving: metav1.ConditionFalse, result: hugohosterv1beta1.BuildResultSuccess, probed: 5, knownGood: 4, want: fallbackRollback},
+		{name: "nothing to roll back to", probe: rollback, serving: metav1.ConditionFalse, result: hugohosterv1beta1.BuildResultSuccess, probed: 5, want: fallbackNone},
+		{name: "known-good build not serving", probe: rollback, serving: metav1.ConditionFalse, result: hugohosterv1beta1.BuildResultSuccess, probed: 5, knownGood: 5, want: fallbackNone},
+		{
+			name:      "rolled back build serving the known-good copy",
+			probe:     rollback,
+			serving:   metav1.ConditionTrue,
+			result:    hugohosterv1beta1.BuildResultSuccess,
+			probed:    5,
+			knownGood: 4,
+			rollback:  &hugohosterv1beta1.RollbackStatus{FromBuild: 5, ToBuild: 4},
+			want:      fallbackNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &hugohosterv1beta1.HugoPage{Spec: hugohosterv1beta1.HugoPageSpec{Probe: &tt.probe}}
+			page.Status = hugohosterv1beta1.HugoPageStatus{
+				LastBuild:      hugohosterv1beta1.BuildStatus{Number: 5, Result: tt.result},
+				ProbedBuild:    tt.probed,
+				KnownGoodBuild: tt.knownGood,
+				Rollback:       tt.rollback,
+				Conditions: []metav1.Condition{{
+					Type:   hugohosterv1beta1.HugoPageConditionServing,
+					Status: tt.serving,
+				}},
+			}
+
+			if got := fallbackActionFor(probeSpec(page), &page.Status); got != tt.want {
+				t.Errorf("want action %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/observability"
+	"github.com/cedi/hugo-hoster/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// settingStatusChecker computes the status shared by Setting and ClusterSetting
+type settingStatusChecker struct {
+	client        client.Client
+	settingClient *pageClient.SettingsClient
+	checker       storage.Checker
+	settingName   string
+	checkInterval time.Duration
+	tracer        trace.Tracer
+}
+
+// SettingReconciler reconciles a Setting object
+type SettingReconciler struct {
+	settingStatusChecker
+}
+
+// ClusterSettingReconciler reconciles a ClusterSetting object
+type ClusterSettingReconciler struct {
+	settingStatusChecker
+}
+
+func NewSettingReconciler(client client.Client, settingClient *pageClient.SettingsClient, checker storage.Checker, settingsName string, checkInterval time.Duration, tracer trace.Tracer) *SettingReconciler {
+	return &SettingReconciler{
+		settingStatusChecker: settingStatusChecker{
+			client:        client,
+			settingClient: settingClient,
+			checker:       checker,
+			settingName:   settingsName,
+			checkInterval: checkInterval,
+			tracer:        tracer,
+		},
+	}
+}
+
+func NewClusterSettingReconciler(client client.Client, settingClient *pageClient.SettingsClient, checker storage.Checker, settingsName string, checkInterval time.Duration, tracer trace.Tracer) *ClusterSettingReconciler {
+	return &ClusterSettingReconciler{
+		settingStatusChecker: settingStatusChecker{
+			client:        client,
+			settingClient: settingClient,
+			checker:       checker,
+			settingName:   settingsName,
+			checkInterval: checkInterval,
+			tracer:        tracer,
+		},
+	}
+}
+
+//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=settings/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=hugo-hoster.cedi.dev,resources=clustersettings/status,verbs=get;update;patch
+
+func (r *SettingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	startTime := time.Now()
+	defer func() {
+		reconcilerDuration.WithLabelValues("setting").Observe(time.Since(startTime).Seconds())
+	}()
+
+	ctx, span := r.tracer.Start(ctx, "SettingReconciler.Reconcile", trace.WithAttributes(attribute.String("name", req.Name), attribute.String("namespace", req.Namespace)))
+	defer span.End()
+
+	log := observability.NewZapLoggerWithCtxSpanPageName("Reconcile", ctx, span, req.NamespacedName.String())
+
+	setting, err := r.settingClient.GetNamespaced(ctx, req.NamespacedName)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			observability.RecordInfo(&log, span, "Setting resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+
+		observability.RecordError(&log, span, err, "Failed to fetch Setting resource")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	resolved := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: setting.Name, Namespace: setting.Namespace, Spec: setting.Spec}
+	if err := r.updateStatus(ctx, resolved, setting.Generation, &setting.Status); err != nil {
+		observability.RecordError(&log, span, err, "Failed to check Setting")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	if err := r.client.Status().Update(ctx, setting); err != nil {
+		observability.RecordError(&log, span, err, "Failed to update Setting status")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	return ctrl.Result{RequeueAfter: r.checkInterval}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SettingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates must not trigger a new check, checks are repeated every checkInterval
+		For(&hugohosterv1beta1.Setting{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+func (r *ClusterSettingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	startTime := time.Now()
+	defer func() {
+		reconcilerDuration.WithLabelValues("cluster_setting").Observe(time.Since(startTime).Seconds())
+	}()
+
+	ctx, span := r.tracer.Start(ctx, "ClusterSettingReconciler.Reconcile", trace.WithAttributes(attribute.String("name", req.Name)))
+	defer span.End()
+
+	log := observability.NewZapLoggerWithCtxSpanPageName("Reconcile", ctx, span, req.Name)
+
+	clusterSetting, err := r.settingClient.GetClusterSetting(ctx, req.Name)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			observability.RecordInfo(&log, span, "ClusterSetting resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+
+		observability.RecordError(&log, span, err, "Failed to fetch ClusterSetting resource")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	resolved := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.ClusterSettingKind, Name: clusterSetting.Name, Spec: clusterSetting.Spec.SettingSpec}
+	if err := r.updateStatus(ctx, resolved, clusterSetting.Generation, &clusterSetting.Status); err != nil {
+		observability.RecordError(&log, span, err, "Failed to check ClusterSetting")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	if err := r.client.Status().Update(ctx, clusterSetting); err != nil {
+		observability.RecordError(&log, span, err, "Failed to update ClusterSetting status")
+		return ctrl.Result{
+			Requeue:      true,
+			RequeueAfter: 1 * time.Minute,
+		}, err
+	}
+
+	return ctrl.Result{RequeueAfter: r.checkInterval}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterSettingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates must not trigger a new check, checks are repeated every checkInterval
+		For(&hugohosterv1beta1.ClusterSetting{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// updateStatus checks the S3 storage of settings and counts the pages using it
+func (r *settingStatusChecker) updateStatus(ctx context.Context, settings *pageClient.ResolvedSetting, generation int64, status *hugohosterv1beta1.SettingStatus) error {
+	pages, err := r.settingClient.ListDependentPages(ctx, settings.Kind, settings.Name, settings.Namespace, r.settingName)
+	if err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	status.ObservedGeneration = generation
+	status.LastCheckTime = &now
+	status.Pages = int32(len(pages))
+
+	config, err := readS3Config(ctx, r.client, settings)
+	if err != nil {
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionCredentialsValid, metav1.ConditionFalse, "SecretInvalid", err.Error())
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketReachable, metav1.ConditionUnknown, "CredentialsInvalid", "The bucket can not be checked without valid credentials")
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketWritable, metav1.ConditionUnknown, "CredentialsInvalid", "The bucket can not be checked without valid credentials")
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionReady, metav1.ConditionFalse, "CredentialsInvalid", err.Error())
+		return nil
+	}
+
+	setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionCredentialsValid, metav1.ConditionTrue, "SecretFound", "The S3 credentials Secret contains all keys")
+
+	result := r.checker.Check(ctx, *config)
+
+	switch {
+	case result.Reachable != nil:
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketReachable, metav1.ConditionFalse, "BucketUnreachable", result.Reachable.Error())
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketWritable, metav1.ConditionUnknown, "BucketUnreachable", "The bucket can not be written to as it is unreachable")
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionReady, metav1.ConditionFalse, "BucketUnreachable", result.Reachable.Error())
+
+	case result.Writable != nil:
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketReachable, metav1.ConditionTrue, "BucketFound", "The bucket exists")
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketWritable, metav1.ConditionFalse, "WriteFailed", result.Writable.Error())
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionReady, metav1.ConditionFalse, "BucketNotWritable", result.Writable.Error())
+
+	default:
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketReachable, metav1.ConditionTrue, "BucketFound", "The bucket exists")
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionBucketWritable, metav1.ConditionTrue, "WriteSucceeded", "A test object was written to the bucket")
+		setSettingCondition(status, generation, hugohosterv1beta1.SettingConditionReady, metav1.ConditionTrue, "StorageReady", "The S3 storage is ready to host pages")
+	}
+
+	return nil
+}
+
+// readS3Config reads the S3 credentials referenced by settings
+func readS3Config(ctx context.Context, c client.Client, settings *pageClient.ResolvedSetting) (*storage.S3Config, error) {
+	credentials := settings.Spec.Storage.S3.CredentialsSecret
+	namespace := settings.CredentialsSecretNamespace()
+
+	if namespace == "" {
+		return nil, fmt.Errorf("spec.storage.s3.credentialsSecret.namespace must be set for a ClusterSetting")
+	}
+
+	secret := &apiv1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: credentials.Name, Namespace: namespace}, secret); err != nil {
+		return nil, errors.Wrapf(err, "Failed to get S3 credentials Secret %s/%s", namespace, credentials.Name)
+	}
+
+	for _, key := range []string{credentials.AccessKeyIDKey, credentials.SecretAccessKeyKey} {
+		if len(secret.Data[key]) == 0 {
+			return nil, fmt.Errorf("S3 credentials Secret %s/%s has no key %s", namespace, credentials.Name, key)
+		}
+	}
+
+	return &storage.S3Config{
+		Endpoint:        settings.Spec.Storage.S3.Endpoint,
+		Bucket:          settings.Spec.Storage.S3.Bucket,
+		AccessKeyID:     string(secret.Data[credentials.AccessKeyIDKey]),
+		SecretAccessKey: string(secret.Data[credentials.SecretAccessKeyKey]),
+	}, nil
+}
+
+func setSettingCondition(status *hugohosterv1beta1.SettingStatus, generation int64, conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
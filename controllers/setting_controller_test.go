@@ -0,0 +1,183 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// fakeChecker returns result for every bucket and records the config it checked
+type fakeChecker struct {
+	result  storage.CheckResult
+	checked *storage.S3Config
+}
+
+func (c *fakeChecker) Check(_ context.Context, config storage.S3Config) storage.CheckResult {
+	c.checked = &config
+	return c.result
+}
+
+func TestSettingStatusConditions(t *testing.T) {
+	credentials := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3", Namespace: "web"},
+		Data:       map[string][]byte{"AccessKeyId": []byte("id"), "AccessKey": []byte("key")},
+	}
+
+	incomplete := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-incomplete", Namespace: "web"},
+		Data:       map[string][]byte{"AccessKeyId": []byte("id")},
+	}
+
+	tests := []struct {
+		name       string
+		secret     string
+		result     storage.CheckResult
+		conditions map[string]string
+		reason     string
+	}{
+		{
+			name:   "ready",
+			secret: "s3",
+			conditions: map[string]string{
+				hugohosterv1beta1.SettingConditionCredentialsValid: "True/SecretFound",
+				hugohosterv1beta1.SettingConditionBucketReachable:  "True/BucketFound",
+				hugohosterv1beta1.SettingConditionBucketWritable:   "True/WriteSucceeded",
+				hugohosterv1beta1.SettingConditionReady:            "True/StorageReady",
+			},
+		},
+		{
+			name:   "missing secret",
+			secret: "unknown",
+			conditions: map[string]string{
+				hugohosterv1beta1.SettingConditionCredentialsValid: "False/SecretInvalid",
+				hugohosterv1beta1.SettingConditionBucketReachable:  "Unknown/CredentialsInvalid",
+				hugohosterv1beta1.SettingConditionBucketWritable:   "Unknown/CredentialsInvalid",
+				hugohosterv1beta1.SettingConditionReady:            "False/CredentialsInvalid",
+			},
+		},
+		{
+			name:   "missing key",
+			secret: "s3-incomplete",
+			conditions: map[string]string{
+				hugohosterv1beta1.SettingConditionCredentialsValid: "False/SecretInvalid",
+				hugohosterv1beta1.SettingConditionReady:            "False/CredentialsInvalid",
+			},
+		},
+		{
+			name:   "unreachable bucket",
+			secret: "s3",
+			result: storage.CheckResult{Reachable: errors.New("no such host"), Writable: errors.New("no such host")},
+			conditions: map[string]string{
+				hugohosterv1beta1.SettingConditionCredentialsValid: "True/SecretFound",
+				hugohosterv1beta1.SettingConditionBucketReachable:  "False/BucketUnreachable",
+				hugohosterv1beta1.SettingConditionBucketWritable:   "Unknown/BucketUnreachable",
+				hugohosterv1beta1.SettingConditionReady:            "False/BucketUnreachable",
+			},
+		},
+		{
+			name:   "read-only bucket",
+			secret: "s3",
+			result: storage.CheckResult{Writable: errors.New("access denied")},
+			conditions: map[string]string{
+				hugohosterv1beta1.SettingConditionBucketReachable: "True/BucketFound",
+				hugohosterv1beta1.SettingConditionBucketWritable:  "False/WriteFailed",
+				hugohosterv1beta1.SettingConditionReady:           "False/BucketNotWritable",
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := []client.Object{
+				&hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "web"}},
+				&hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "web"}},
+				&hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other"}},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(credentials, incomplete).WithObjects(pages...).Build()
+			tracer := noop.NewTracerProvider().Tracer("setting_controller_test")
+			checker := &fakeChecker{result: tt.result}
+
+			r := &settingStatusChecker{
+				client:        c,
+				settingClient: pageClient.NewSettingsClient(c, "", tracer),
+				checker:       checker,
+				settingName:   "default",
+				tracer:        tracer,
+			}
+
+			settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: "default", Namespace: "web"}
+			settings.Spec.Storage.S3 = hugohosterv1beta1.S3Spec{
+				Endpoint: "https://s3.example.com",
+				Bucket:   "pages",
+				CredentialsSecret: hugohosterv1beta1.S3CredentialsSecretRef{
+					Name:               tt.secret,
+					AccessKeyIDKey:     "AccessKeyId",
+					SecretAccessKeyKey: "AccessKey",
+				},
+			}
+
+			status := &hugohosterv1beta1.SettingStatus{}
+			if err := r.updateStatus(context.Background(), settings, 3, status); err != nil {
+				t.Fatal(err)
+			}
+
+			if status.Pages != 2 || status.ObservedGeneration != 3 || status.LastCheckTime == nil {
+				t.Errorf("want 2 pages of generation 3 checked, got %+v", status)
+			}
+
+			for conditionType, want := range tt.conditions {
+				condition := meta.FindStatusCondition(status.Conditions, conditionType)
+				if condition == nil {
+					t.Errorf("want condition %s, got none", conditionType)
+					continue
+				}
+
+				if got := string(condition.Status) + "/" + condition.Reason; got != want || condition.ObservedGeneration != 3 {
+					t.Errorf("want condition %s %s, got %s of generation %d", conditionType, want, got, condition.ObservedGeneration)
+				}
+			}
+
+			if tt.secret == "s3" && (checker.checked == nil || checker.checked.AccessKeyID != "id" || checker.checked.SecretAccessKey != "key" || checker.checked.Bucket != "pages") {
+				t.Errorf("want the bucket checked with the credentials of the Secret, got %+v", checker.checked)
+			}
+
+			if tt.secret != "s3" && checker.checked != nil {
+				t.Error("want no check without valid credentials")
+			}
+		})
+	}
+}
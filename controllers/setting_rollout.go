@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cedi/hugo-hoster/pkg/observability"
+)
+
+// settingRolloutHandler enqueues every HugoPage that resolves to a changed Setting or ClusterSetting.
+// The pages are spread out according to limiter, so a change to a Setting used by hundreds of pages
+// does not update all of them at once.
+type settingRolloutHandler struct {
+	reconciler *HugoPageReconciler
+	kind       string
+	limiter    *rate.Limiter
+
+	// started is when the handler was created, in the precision of creation timestamps. Settings created
+	// before are listed by the initial sync of the cache, which reconciles every page anyway
+	started time.Time
+	now     func() time.Time
+
+	mu sync.Mutex
+
+	// pending holds the pages added to the queue with a delay and when they are due
+	pending map[types.NamespacedName]time.Time
+}
+
+func (r *HugoPageReconciler) settingRolloutHandler(kind string) handler.EventHandler {
+	h := newSettingRolloutHandler(r, kind)
+
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if e.Object.GetCreationTimestamp().Time.Before(h.started) {
+				return
+			}
+
+			h.enqueue(ctx, e.Object, q)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			// Status updates by the Setting controller do not change the pages
+			if e.ObjectOld.GetGeneration() == e.ObjectNew.GetGeneration() {
+				return
+			}
+
+			h.enqueue(ctx, e.ObjectNew, q)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			h.enqueue(ctx, e.Object, q)
+		},
+	}
+}
+
+func newSettingRolloutHandler(r *HugoPageReconciler, kind string) *settingRolloutHandler {
+	return &settingRolloutHandler{
+		reconciler: r,
+		kind:       kind,
+		limiter:    r.rolloutLimiter,
+		started:    time.Now().Truncate(time.Second),
+		now:        time.Now,
+		pending:    map[types.NamespacedName]time.Time{},
+	}
+}
+
+func (h *settingRolloutHandler) enqueue(ct context.Context, obj client.Object, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	ctx, span := h.reconciler.tracer.Start(ct, "HugoPageReconciler.rolloutSetting", trace.WithAttributes(attribute.String("kind", h.kind), attribute.String("name", obj.GetName()), attribute.String("namespace", obj.GetNamespace())))
+	defer span.End()
+
+	log := observability.NewZapLoggerWithCtxSpanPageName("rolloutSetting", ctx, span, client.ObjectKeyFromObject(obj).String())
+
+	pages, err := h.reconciler.settingClient.ListDependentPages(ctx, h.kind, obj.GetName(), obj.GetNamespace(), h.reconciler.settingName)
+	if err != nil {
+		observability.RecordError(&log, span, err, "Failed to list pages depending on changed setting")
+		return
+	}
+
+	span.SetAttributes(attribute.Int("pages", len(pages)))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	for page, due := range h.pending {
+		if due.Before(now) {
+			delete(h.pending, page)
+		}
+	}
+
+	for _, page := range pages {
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: page.Name, Namespace: page.Namespace}}
+
+		// a page still waiting for an earlier rollout picks up this change as well, so it takes no second slot
+		if _, ok := h.pending[req.NamespacedName]; ok {
+			continue
+		}
+
+		delay := h.limiter.ReserveN(now, 1).DelayFrom(now)
+		h.pending[req.NamespacedName] = now.Add(delay)
+		q.AddAfter(req, delay)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+// recordingQueue records the requests added to it with their delay
+type recordingQueue struct {
+	workqueue.TypedRateLimitingInterface[reconcile.Request]
+	added map[string]time.Duration
+}
+
+func (q *recordingQueue) AddAfter(req reconcile.Request, delay time.Duration) {
+	q.added[req.String()] = delay
+}
+
+func rolloutTestReconciler(t *testing.T, limiter *rate.Limiter) *HugoPageReconciler {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	page := func(namespace, name string, ref *hugohosterv1beta1.SettingRef) client.Object {
+		return &hugohosterv1beta1.HugoPage{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       hugohosterv1beta1.HugoPageSpec{SettingRef: ref},
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		page("web", "default", nil),
+		page("web", "named", &hugohosterv1beta1.SettingRef{Name: "default"}),
+		page("web", "other", &hugohosterv1beta1.SettingRef{Name: "other"}),
+		page("web", "cluster", &hugohosterv1beta1.SettingRef{Kind: hugohosterv1beta1.ClusterSettingKind, Name: "default"}),
+		page("blog", "default", nil),
+		&hugohosterv1beta1.Setting{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "web"}},
+	).Build()
+
+	tracer := noop.NewTracerProvider().Tracer("setting_rollout_test")
+
+	return &HugoPageReconciler{
+		settingClient:  pageClient.NewSettingsClient(c, "", tracer),
+		settingName:    "default",
+		rolloutLimiter: limiter,
+		tracer:         tracer,
+	}
+}
+
+func TestSettingRolloutPages(t *testing.T) {
+	tests := []struct {
+		kind      string
+		namespace string
+		name      string
+		want      []string
+	}{
+		{kind: hugohosterv1beta1.SettingKind, namespace: "web", name: "default", want: []string{"web/default", "web/named"}},
+		{kind: hugohosterv1beta1.SettingKind, namespace: "web", name: "other", want: []string{"web/other"}},
+		{kind: hugohosterv1beta1.SettingKind, namespace: "blog", name: "other", want: []string{}},
+
+		// the page without a settingRef in web uses the Setting of its namespace
+		{kind: hugohosterv1beta1.ClusterSettingKind, name: "default", want: []string{"blog/default", "web/cluster"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind+"/"+tt.name, func(t *testing.T) {
+			r := rolloutTestReconciler(t, rate.NewLimiter(rate.Inf, 0))
+			h := newSettingRolloutHandler(r, tt.kind)
+			q := &recordingQueue{added: map[string]time.Duration{}}
+
+			setting := &hugohosterv1beta1.Setting{ObjectMeta: metav1.ObjectMeta{Name: tt.name, Namespace: tt.namespace}}
+			h.enqueue(context.Background(), setting, q)
+
+			got := []string{}
+			for req := range q.added {
+				got = append(got, req)
+			}
+			sort.Strings(got)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("want pages %v reconciled, got %v", tt.want, got)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("want pages %v reconciled, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSettingRolloutRateLimit(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	limiter := rate.NewLimiter(rate.Limit(1), 1)
+
+	h := newSettingRolloutHandler(rolloutTestReconciler(t, limiter), hugohosterv1beta1.ClusterSettingKind)
+	h.now = func() time.Time { return now }
+
+	setting := &hugohosterv1beta1.ClusterSetting{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	q := &recordingQueue{added: map[string]time.Duration{}}
+	h.enqueue(context.Background(), setting, q)
+
+	delays := []time.Duration{}
+	for _, delay := range q.added {
+		delays = append(delays, delay)
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	if len(delays) != 2 || delays[0] != 0 || delays[1] != time.Second {
+		t.Fatalf("want the pages spread one second apart, got %v", delays)
+	}
+
+	// pages still waiting for the first rollout take no second slot
+	q.added = map[string]time.Duration{}
+	h.enqueue(context.Background(), setting, q)
+
+	if len(q.added) != 0 {
+		t.Errorf("want pending pages not queued again, got %v", q.added)
+	}
+
+	if delay := limiter.ReserveN(now, 1).DelayFrom(now); delay != 2*time.Second {
+		t.Errorf("want no slots reserved for pending pages, got the next slot in %s", delay)
+	}
+
+	// once due, a page is rolled out again
+	now = now.Add(5 * time.Second)
+	h.enqueue(context.Background(), setting, q)
+
+	if len(q.added) != 2 {
+		t.Errorf("want both pages queued again, got %v", q.added)
+	}
+
+	// Settings listed by the initial sync of the cache are not rolled out
+	handler := rolloutTestReconciler(t, limiter).settingRolloutHandler(hugohosterv1beta1.ClusterSettingKind)
+	q.added = map[string]time.Duration{}
+
+	existing := setting.DeepCopy()
+	existing.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	handler.Create(context.Background(), event.CreateEvent{Object: existing}, q)
+
+	if len(q.added) != 0 {
+		t.Errorf("want no rollout of a Setting listed by the initial sync, got %v", q.added)
+	}
+
+	created := setting.DeepCopy()
+	created.CreationTimestamp = metav1.NewTime(time.Now().Add(time.Minute))
+	handler.Create(context.Background(), event.CreateEvent{Object: created}, q)
+
+	if len(q.added) != 2 {
+		t.Errorf("want the pages of a new Setting rolled out, got %v", q.added)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+)
+
+// pagePrefix is the prefix in the bucket page is published under. It contains the namespace, as pages of different
+// namespaces may share a bucket, and starts with an underscore, so that it is never below the prefix of a page
+// published before pages were qualified by their namespace
+func pagePrefix(page *hugohosterv1beta1.HugoPage) string {
+	return "_sites/" + page.Namespace + "/" + page.Name
+}
+
+// migrateStoragePrefix copies the site of page published under its name alone to its prefix, before it is served
+// from there. The known-good copy is not migrated, the next build passing the probe is kept again
+func (r *HugoPageReconciler) migrateStoragePrefix(ctx context.Context, page *hugohosterv1beta1.HugoPage, settings *pageClient.ResolvedSetting) error {
+	prefix := pagePrefix(page)
+	if page.Status.StoragePrefix == prefix {
+		return nil
+	}
+
+	if page.Status.LastSuccessTime != nil {
+		config, err := readS3Config(ctx, r.client, settings)
+		if err != nil {
+			return err
+		}
+
+		if err := r.syncer.Sync(ctx, *config, page.Name, prefix); err != nil {
+			// a new build publishes the site under its prefix in any case
+			r.buildQueue.Enqueue(ctx, client.ObjectKeyFromObject(page), BuildPriorityTriggered)
+			r.recorder.Eventf(page, apiv1.EventTypeWarning, "StorageMigrationFailed", "Failed to copy the site to %s, queued a build to publish it there: %s", prefix, err.Error())
+		} else {
+			r.recorder.Eventf(page, apiv1.EventTypeNormal, "StorageMigrated", "Copied the site from %s to %s", page.Name, prefix)
+		}
+
+		page.Status.KnownGoodBuild = 0
+	}
+
+	page.Status.StoragePrefix = prefix
+	if err := r.client.Status().Update(ctx, page); err != nil {
+		return errors.Wrap(err, "Failed to update HugoPage status")
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/trace/noop"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+	pageClient "github.com/cedi/hugo-hoster/pkg/client"
+	"github.com/cedi/hugo-hoster/pkg/storage"
+)
+
+// recordingSyncer records the prefixes it was asked to sync
+type recordingSyncer struct {
+	synced [][2]string
+}
+
+func (s *recordingSyncer) Sync(_ context.Context, _ storage.S3Config, source, destination string) error {
+	s.synced = append(s.synced, [2]string{source, destination})
+	return nil
+}
+
+func TestPagePrefix(t *testing.T) {
+	a := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "team-a"}}
+	b := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "team-b"}}
+
+	if pagePrefix(a) == pagePrefix(b) || knownGoodPath(a) == knownGoodPath(b) {
+		t.Errorf("want pages of the same name in different namespaces kept apart, got %s and %s", pagePrefix(a), knownGoodPath(a))
+	}
+}
+
+func TestMigrateStoragePrefix(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+	page.Status.LastSuccessTime = &metav1.Time{Time: time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)}
+	page.Status.KnownGoodBuild = 4
+
+	credentials := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3", Namespace: "web"},
+		Data:       map[string][]byte{"AccessKeyId": []byte("id"), "AccessKey": []byte("key")},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(page, credentials).WithStatusSubresource(page).Build()
+	syncer := &recordingSyncer{}
+	queue := NewBuildQueue(c, 0, nil, record.NewFakeRecorder(10), noop.NewTracerProvider().Tracer("storage_prefix_test"))
+	r := &HugoPageReconciler{client: c, syncer: syncer, buildQueue: queue, recorder: record.NewFakeRecorder(10)}
+
+	settings := &pageClient.ResolvedSetting{Kind: hugohosterv1beta1.SettingKind, Name: "default", Namespace: "web"}
+	settings.Spec.Storage.S3.CredentialsSecret = hugohosterv1beta1.S3CredentialsSecretRef{Name: "s3", AccessKeyIDKey: "AccessKeyId", SecretAccessKeyKey: "AccessKey"}
+
+	for range 2 {
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(page), page); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.migrateStoragePrefix(context.Background(), page, settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if diff := cmp.Diff([][2]string{{"blog", "_sites/web/blog"}}, syncer.synced); diff != "" {
+		t.Errorf("want the site copied to its prefix once (-want +got):\n%s", diff)
+	}
+
+	if page.Status.StoragePrefix != "_sites/web/blog" || page.Status.KnownGoodBuild != 0 {
+		t.Errorf("want the prefix recorded and the known-good build forgotten, got %q and %d", page.Status.StoragePrefix, page.Status.KnownGoodBuild)
+	}
+}
+
+func TestProberTargetURL(t *testing.T) {
+	page := &hugohosterv1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "web"}}
+	page.Spec.Routing.Host = "blog.cedi.dev"
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = hugohosterv1beta1.AddToScheme(scheme)
+
+	setting := &hugohosterv1beta1.Setting{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "web"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(setting).Build()
+
+	tracer := noop.NewTracerProvider().Tracer("storage_prefix_test")
+	prober := NewProber(c, pageClient.NewSettingsClient(c, "", tracer), "default", tracer)
+	spec := hugohosterv1beta1.ProbeSpec{Target: hugohosterv1beta1.ProbeTargetService, Path: "/healthz"}
+
+	tests := map[bool]string{
+		true:  "http://" + nginxProxyServiceName(page) + ".web.svc/healthz",
+		false: "http://blog.cedi.dev/healthz",
+	}
+
+	for inCluster, want := range tests {
+		prober.inCluster = inCluster
+
+		got, err := prober.targetURL(context.Background(), page, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("want the probe of the Service %s with inCluster %v, got %s", want, inCluster, got)
+		}
+	}
+}
@@ -19,23 +19,37 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	hugohosterv1alpha1 "github.com/cedi/hugo-hoster/api/v1alpha1"
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
 	"github.com/cedi/hugo-hoster/controllers"
+	"github.com/cedi/hugo-hoster/pkg/forge"
+	"github.com/cedi/hugo-hoster/pkg/notify"
 	"github.com/cedi/hugo-hoster/pkg/observability"
+	"github.com/cedi/hugo-hoster/pkg/storage"
 	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	//+kubebuilder:scaffold:imports
@@ -54,21 +68,44 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(hugohosterv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(hugohosterv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaderElectionNamespace string
 	var probeAddr string
 	var debug bool
 	var settingsName string
-
-	flag.StringVar(&settingsName, "settingName", "settings", "The name of the hugo-hoster/Setting resource used to configure this instance of hugo-hoster")
+	var settingCheckInterval time.Duration
+	var settingRolloutRate float64
+	var settingRolloutBurst int
+	var maxConcurrentBuilds int
+	var otelExporter string
+	var otelSampleRatio float64
+	var namespace string
+	var watchNamespaces string
+	var watchLabelSelector string
+	var pushWebhookAddr string
+
+	flag.StringVar(&settingsName, "settingName", "settings", "The name of the hugo-hoster/Setting resource used for pages without a settingRef. If a namespace has no Setting of this name, the ClusterSetting of this name is used")
+	flag.DurationVar(&settingCheckInterval, "settingCheckInterval", 5*time.Minute, "The interval in which the S3 storage of every Setting and ClusterSetting is checked")
+	flag.Float64Var(&settingRolloutRate, "settingRolloutRate", 2, "The number of pages per second that are updated after a Setting or ClusterSetting changed")
+	flag.IntVar(&settingRolloutBurst, "settingRolloutBurst", 10, "The number of pages that are updated at once after a Setting or ClusterSetting changed")
+	flag.IntVar(&maxConcurrentBuilds, "maxConcurrentBuilds", 10, "The number of builds running at once in the cluster. Further builds are queued. 0 means no limit")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionNamespace, "leader-elect-namespace", "", "The namespace of the Lease used for leader election. Defaults to --namespace")
 	flag.BoolVar(&debug, "debug", false, "Turn on debug logging")
+	flag.StringVar(&otelExporter, "otel-exporter", "", "Where traces and metrics are exported to: otlp-http, otlp-grpc, stdout or none. Defaults to the OTEL_TRACES_EXPORTER and OTEL_EXPORTER_OTLP_* environment, or none if no collector is configured")
+	flag.Float64Var(&otelSampleRatio, "otel-sample-ratio", -1, "The ratio of new traces that are sampled, traces continued from a sampled parent are always sampled. Defaults to the OTEL_TRACES_SAMPLER environment, which samples every trace")
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the controller, used for HugoPages and Settings without a namespace. Defaults to POD_NAMESPACE or the namespace of the service account in the cluster, and the namespace of the current kubeconfig context out of it")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "Comma separated list of namespaces the controller watches. Defaults to all namespaces")
+	flag.StringVar(&watchLabelSelector, "watch-label-selector", "", "Label selector of the HugoPages the controller reconciles, e.g. shard=a. Defaults to all HugoPages")
+	flag.StringVar(&pushWebhookAddr, "push-webhook-bind-address", "", "The address the push webhooks of GitHub, GitLab and Gitea are received on, e.g. :8082. The webhooks must be sent with the secret in PUSH_WEBHOOK_SECRET, without it no webhooks are received. Disabled by default")
 
 	flag.Parse()
 
@@ -81,35 +118,75 @@ func main() {
 
 	initLog := otelzap.L().Sugar()
 
-	// Initialize Tracing (OpenTelemetry)
-	traceProvider, tracer, err := observability.InitTracer(serviceName, serviceVersion)
+	// Initialize Tracing and Metrics (OpenTelemetry)
+	exporter, err := observability.ParseExporter(otelExporter)
 	if err != nil {
-		initLog.Errorw("failed initializing tracing",
+		initLog.Errorw("invalid --otel-exporter",
 			zap.Error(err),
 		)
 		os.Exit(1)
 	}
 
-	ctx, span := tracer.Start(context.Background(), "main.startManager")
-	log := initLog.Ctx(ctx)
+	telemetry, err := observability.InitTelemetry(context.Background(), observability.TelemetryConfig{
+		ServiceName:    serviceName,
+		ServiceVersion: serviceVersion,
+		Exporter:       exporter,
+		SampleRatio:    otelSampleRatio,
+		Gatherer:       metrics.Registry,
+	})
+	if err != nil {
+		initLog.Errorw("failed initializing telemetry",
+			zap.Error(err),
+		)
+		os.Exit(1)
+	}
+
+	tracer := telemetry.Tracer
 
 	defer func() {
-		if err := traceProvider.Shutdown(ctx); err != nil {
-			observability.RecordError(&log, span, err, "Error shutting down tracer provider")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := telemetry.Shutdown(ctx); err != nil {
+			initLog.Errorw("Error shutting down telemetry",
+				zap.Error(err),
+			)
 		}
 	}()
 
-	_, span = tracer.Start(context.Background(), "main.startManager")
+	ctx, span := tracer.Start(context.Background(), "main.startManager")
+	log := initLog.Ctx(ctx)
+
+	namespace, err = pageClient.CurrentNamespace(namespace)
+	if err != nil {
+		observability.RecordError(&log, span, err, "Unable to determine the namespace of hugo-hoster")
+		os.Exit(1)
+	}
+
+	if leaderElectionNamespace == "" {
+		leaderElectionNamespace = namespace
+	}
+
+	cacheOpts, err := cacheOptions(watchNamespaces, watchLabelSelector)
+	if err != nil {
+		observability.RecordError(&log, span, err, "Invalid --watch-namespaces or --watch-label-selector")
+		os.Exit(1)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache:  cacheOpts,
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
-		HealthProbeBindAddress:        probeAddr,
-		LeaderElection:                false,
-		LeaderElectionID:              "9123ff57.cedi.dev",
-		LeaderElectionReleaseOnCancel: false,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        controllers.LeaderElectionID,
+		LeaderElectionNamespace: leaderElectionNamespace,
+
+		// The leader steps down as soon as it stops, so the next replica takes over without waiting for the
+		// Lease to expire. This is safe as the program ends right after the manager stopped.
+		LeaderElectionReleaseOnCancel: true,
 	})
 
 	if err != nil {
@@ -119,19 +196,50 @@ func main() {
 
 	hugoPageClient := pageClient.NewHugoPageClient(
 		mgr.GetClient(),
+		namespace,
 		tracer,
 	)
 
 	settingClient := pageClient.NewSettingsClient(
 		mgr.GetClient(),
+		namespace,
+		tracer,
+	)
+
+	buildQueue := controllers.NewBuildQueue(
+		mgr.GetClient(),
+		maxConcurrentBuilds,
+		telemetry.BuilderEnv(),
+		mgr.GetEventRecorderFor(serviceName),
 		tracer,
 	)
 
+	// The reconcilers, the BuildQueue and the Prober only run on the elected leader, as they create Jobs and write
+	// the status of the pages. The conversion webhooks, push webhooks, health probes and metrics are served by all replicas
+	if err = mgr.Add(buildQueue); err != nil {
+		observability.RecordError(&log, span, err, "Unable to create build queue")
+		os.Exit(1)
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		observability.RecordError(&log, span, err, "Unable to create Kubernetes clientset")
+		os.Exit(1)
+	}
+
 	hugoPageController := controllers.NewHugoPageReconciler(
 		mgr.GetClient(),
 		hugoPageClient,
 		settingClient,
 		settingsName,
+		rate.NewLimiter(rate.Limit(settingRolloutRate), settingRolloutBurst),
+		mgr.GetEventRecorderFor(serviceName),
+		mgr.GetAPIReader(),
+		forge.NewFactory(tracer),
+		buildQueue,
+		clientset.CoreV1(),
+		notify.NewNotifier(&http.Client{Timeout: 30 * time.Second}, tracer),
+		storage.NewS3Syncer(tracer),
 		mgr.GetScheme(),
 		tracer,
 	)
@@ -140,6 +248,66 @@ func main() {
 		observability.RecordError(&log, span, err, "Unable to create controller")
 		os.Exit(1)
 	}
+
+	if err = mgr.Add(controllers.NewProber(mgr.GetClient(), settingClient, settingsName, tracer)); err != nil {
+		observability.RecordError(&log, span, err, "Unable to create prober")
+		os.Exit(1)
+	}
+
+	// the deployment always passes the address, the receiver is only started once a secret is configured
+	pushWebhookSecret := os.Getenv("PUSH_WEBHOOK_SECRET")
+	if pushWebhookAddr != "" && pushWebhookSecret == "" {
+		observability.RecordInfo(&log, span, "PUSH_WEBHOOK_SECRET is not set, push webhooks are not received")
+	}
+
+	if pushWebhookAddr != "" && pushWebhookSecret != "" {
+		if err = mgr.Add(controllers.NewPushReceiver(mgr.GetClient(), pushWebhookAddr, pushWebhookSecret, tracer)); err != nil {
+			observability.RecordError(&log, span, err, "Unable to create push receiver")
+			os.Exit(1)
+		}
+	}
+
+	s3Checker := storage.NewS3Checker(tracer)
+
+	settingController := controllers.NewSettingReconciler(
+		mgr.GetClient(),
+		settingClient,
+		s3Checker,
+		settingsName,
+		settingCheckInterval,
+		tracer,
+	)
+
+	if err = settingController.SetupWithManager(mgr); err != nil {
+		observability.RecordError(&log, span, err, "Unable to create Setting controller")
+		os.Exit(1)
+	}
+
+	clusterSettingController := controllers.NewClusterSettingReconciler(
+		mgr.GetClient(),
+		settingClient,
+		s3Checker,
+		settingsName,
+		settingCheckInterval,
+		tracer,
+	)
+
+	if err = clusterSettingController.SetupWithManager(mgr); err != nil {
+		observability.RecordError(&log, span, err, "Unable to create ClusterSetting controller")
+		os.Exit(1)
+	}
+	// The conversion webhooks need serving certificates, so allow turning them off when running locally
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&hugohosterv1beta1.HugoPage{}).SetupWebhookWithManager(mgr); err != nil {
+			observability.RecordError(&log, span, err, "Unable to create HugoPage conversion webhook")
+			os.Exit(1)
+		}
+
+		if err = (&hugohosterv1beta1.Setting{}).SetupWebhookWithManager(mgr); err != nil {
+			observability.RecordError(&log, span, err, "Unable to create Setting conversion webhook")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	span.End()
@@ -159,3 +327,36 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// cacheOptions configures the cache of the manager to watch only the comma separated watchNamespaces, and only the
+// HugoPages matching labelSelector. Empty values watch all namespaces and all HugoPages
+func cacheOptions(watchNamespaces, labelSelector string) (cache.Options, error) {
+	opts := cache.Options{}
+
+	for _, namespace := range strings.Split(watchNamespaces, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+
+		if opts.DefaultNamespaces == nil {
+			opts.DefaultNamespaces = map[string]cache.Config{}
+		}
+
+		opts.DefaultNamespaces[namespace] = cache.Config{}
+	}
+
+	if labelSelector != "" {
+		selector, err := labels.Parse(labelSelector)
+		if err != nil {
+			return cache.Options{}, errors.Wrapf(err, "Failed to parse label selector %q", labelSelector)
+		}
+
+		// the children of the pages are labelled by the controller, so only the pages are filtered
+		opts.ByObject = map[client.Object]cache.ByObject{
+			&hugohosterv1beta1.HugoPage{}: {Label: selector},
+		}
+	}
+
+	return opts, nil
+}
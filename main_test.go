@@ -0,0 +1,65 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	hugohosterv1beta1 "github.com/cedi/hugo-hoster/api/v1beta1"
+)
+
+func TestCacheOptions(t *testing.T) {
+	opts, err := cacheOptions("", "")
+	if err != nil || opts.DefaultNamespaces != nil || opts.ByObject != nil {
+		t.Fatalf("want all namespaces and pages watched by default, got %v, %v", opts, err)
+	}
+
+	opts, err = cacheOptions("web, docs,,", "shard=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts.DefaultNamespaces) != 2 {
+		t.Errorf("want the namespaces web and docs watched, got %v", opts.DefaultNamespaces)
+	}
+
+	for _, namespace := range []string{"web", "docs"} {
+		if _, ok := opts.DefaultNamespaces[namespace]; !ok {
+			t.Errorf("want namespace %s watched, got %v", namespace, opts.DefaultNamespaces)
+		}
+	}
+
+	for obj, byObject := range opts.ByObject {
+		if _, ok := obj.(*hugohosterv1beta1.HugoPage); !ok {
+			t.Errorf("want only HugoPages filtered, got %T", obj)
+		}
+
+		if !byObject.Label.Matches(labels.Set{"shard": "a"}) || byObject.Label.Matches(labels.Set{"shard": "b"}) {
+			t.Errorf("want pages of shard a watched, got selector %s", byObject.Label)
+		}
+	}
+
+	if len(opts.ByObject) != 1 {
+		t.Errorf("want the HugoPages filtered by label, got %v", opts.ByObject)
+	}
+
+	if _, err := cacheOptions("", "shard in (a"); err == nil {
+		t.Error("want an error for an invalid label selector")
+	}
+}
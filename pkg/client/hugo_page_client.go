@@ -2,10 +2,8 @@ package client
 
 import (
 	"context"
-	"os"
 
-	"github.com/cedi/hugo-hoster/api/v1alpha1"
-	"github.com/pkg/errors"
+	"github.com/cedi/hugo-hoster/api/v1beta1"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/types"
@@ -15,34 +13,37 @@ import (
 // HugoPageClient is a Kubernetes client for easy CRUD operations
 type HugoPageClient struct {
 	client client.Client
+
+	// namespace is used by the calls that do not name a namespace
+	namespace string
+
 	tracer trace.Tracer
 }
 
 // NewHugoPageClient creates a new HugoPage Client
-func NewHugoPageClient(client client.Client, tracer trace.Tracer) *HugoPageClient {
+func NewHugoPageClient(client client.Client, namespace string, tracer trace.Tracer) *HugoPageClient {
 	return &HugoPageClient{
-		client: client,
-		tracer: tracer,
+		client:    client,
+		namespace: namespace,
+		tracer:    tracer,
 	}
 }
 
 // Get returns a HugoPage in the current namespace
-func (c *HugoPageClient) Get(ct context.Context, name string) (*v1alpha1.HugoPage, error) {
+func (c *HugoPageClient) Get(ct context.Context, name string) (*v1beta1.HugoPage, error) {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.Get", trace.WithAttributes(attribute.String("name", name)))
 	defer span.End()
 
-	// try to read the namespace from /var/run
-	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		span.RecordError(err)
-		return nil, errors.Wrap(err, "Unable to read current namespace")
+	if c.namespace == "" {
+		span.RecordError(ErrNoNamespace)
+		return nil, ErrNoNamespace
 	}
 
-	return c.GetNamespaced(ctx, types.NamespacedName{Name: name, Namespace: string(namespace)})
+	return c.GetNamespaced(ctx, types.NamespacedName{Name: name, Namespace: c.namespace})
 }
 
 // GetNameNamespace returns a HugoPage for a given name in a given namespace
-func (c *HugoPageClient) GetNameNamespace(ct context.Context, name, namespace string) (*v1alpha1.HugoPage, error) {
+func (c *HugoPageClient) GetNameNamespace(ct context.Context, name, namespace string) (*v1beta1.HugoPage, error) {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.GetNameNamespace", trace.WithAttributes(attribute.String("name", name), attribute.String("namespace", namespace)))
 	defer span.End()
 
@@ -50,7 +51,7 @@ func (c *HugoPageClient) GetNameNamespace(ct context.Context, name, namespace st
 }
 
 // Get returns a HugoPage
-func (c *HugoPageClient) GetNamespaced(ct context.Context, nameNamespaced types.NamespacedName) (*v1alpha1.HugoPage, error) {
+func (c *HugoPageClient) GetNamespaced(ct context.Context, nameNamespaced types.NamespacedName) (*v1beta1.HugoPage, error) {
 	ctx, span := c.tracer.Start(
 		ct, "HugoPageClient.GetNamespaced",
 		trace.WithAttributes(
@@ -60,7 +61,7 @@ func (c *HugoPageClient) GetNamespaced(ct context.Context, nameNamespaced types.
 	)
 	defer span.End()
 
-	HugoPage := &v1alpha1.HugoPage{}
+	HugoPage := &v1beta1.HugoPage{}
 
 	if err := c.client.Get(ctx, nameNamespaced, HugoPage); err != nil {
 		span.RecordError(err)
@@ -71,26 +72,24 @@ func (c *HugoPageClient) GetNamespaced(ct context.Context, nameNamespaced types.
 }
 
 // List returns a list of all HugoPages in the current namespace
-func (c *HugoPageClient) List(ct context.Context) (*v1alpha1.HugoPageList, error) {
+func (c *HugoPageClient) List(ct context.Context) (*v1beta1.HugoPageList, error) {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.List")
 	defer span.End()
 
-	// try to read the namespace from /var/run
-	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		span.RecordError(err)
-		return nil, errors.Wrap(err, "Unable to read current namespace")
+	if c.namespace == "" {
+		span.RecordError(ErrNoNamespace)
+		return nil, ErrNoNamespace
 	}
 
-	return c.ListNamespaced(ctx, string(namespace))
+	return c.ListNamespaced(ctx, c.namespace)
 }
 
 // ListNamespaced returns a list of all HugoPages in a namespace
-func (c *HugoPageClient) ListNamespaced(ct context.Context, namespace string) (*v1alpha1.HugoPageList, error) {
+func (c *HugoPageClient) ListNamespaced(ct context.Context, namespace string) (*v1beta1.HugoPageList, error) {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.ListNamespaced", trace.WithAttributes(attribute.String("namespace", namespace)))
 	defer span.End()
 
-	HugoPages := &v1alpha1.HugoPageList{}
+	HugoPages := &v1beta1.HugoPageList{}
 
 	if err := c.client.List(ctx, HugoPages, &client.ListOptions{Namespace: namespace}); err != nil {
 		span.RecordError(err)
@@ -100,7 +99,7 @@ func (c *HugoPageClient) ListNamespaced(ct context.Context, namespace string) (*
 	return HugoPages, nil
 }
 
-func (c *HugoPageClient) Update(ct context.Context, HugoPage *v1alpha1.HugoPage) error {
+func (c *HugoPageClient) Update(ct context.Context, HugoPage *v1beta1.HugoPage) error {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.Update", trace.WithAttributes(attribute.String("HugoPage", HugoPage.ObjectMeta.Name), attribute.String("namespace", HugoPage.ObjectMeta.Namespace)))
 	defer span.End()
 
@@ -112,7 +111,7 @@ func (c *HugoPageClient) Update(ct context.Context, HugoPage *v1alpha1.HugoPage)
 	return nil
 }
 
-func (c *HugoPageClient) UpdateStatus(ct context.Context, HugoPage *v1alpha1.HugoPage) error {
+func (c *HugoPageClient) UpdateStatus(ct context.Context, HugoPage *v1beta1.HugoPage) error {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.UpdateStatus", trace.WithAttributes(attribute.String("HugoPage", HugoPage.ObjectMeta.Name), attribute.String("namespace", HugoPage.ObjectMeta.Namespace)))
 	defer span.End()
 
@@ -124,7 +123,7 @@ func (c *HugoPageClient) UpdateStatus(ct context.Context, HugoPage *v1alpha1.Hug
 	return err
 }
 
-func (c *HugoPageClient) Delete(ct context.Context, HugoPage *v1alpha1.HugoPage) error {
+func (c *HugoPageClient) Delete(ct context.Context, HugoPage *v1beta1.HugoPage) error {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.Delete", trace.WithAttributes(attribute.String("name", HugoPage.Name), attribute.String("namespace", HugoPage.Namespace)))
 	defer span.End()
 
@@ -136,19 +135,17 @@ func (c *HugoPageClient) Delete(ct context.Context, HugoPage *v1alpha1.HugoPage)
 	return nil
 }
 
-func (c *HugoPageClient) Create(ct context.Context, HugoPage *v1alpha1.HugoPage) error {
+func (c *HugoPageClient) Create(ct context.Context, HugoPage *v1beta1.HugoPage) error {
 	ctx, span := c.tracer.Start(ct, "HugoPageClient.Create", trace.WithAttributes(attribute.String("HugoPage", HugoPage.ObjectMeta.Name), attribute.String("namespace", HugoPage.ObjectMeta.Namespace)))
 	defer span.End()
 
 	if HugoPage.Namespace == "" {
-		// try to read the namespace from /var/run
-		namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-		if err != nil {
-			span.RecordError(err)
-			return errors.Wrap(err, "Unable to read current namespace")
+		if c.namespace == "" {
+			span.RecordError(ErrNoNamespace)
+			return ErrNoNamespace
 		}
 
-		HugoPage.Namespace = string(namespace)
+		HugoPage.Namespace = c.namespace
 	}
 
 	// if not exists, create a new one
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ErrNoNamespace is returned by the calls that do not name a namespace, if the client has no namespace
+var ErrNoNamespace = errors.New("No namespace configured for the client")
+
+// CurrentNamespace returns namespace if it is set. Otherwise it returns the namespace the controller runs in:
+// POD_NAMESPACE or the namespace of the service account in the cluster, the namespace of the current context out of it
+func CurrentNamespace(namespace string) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to determine the current namespace")
+	}
+
+	return namespace, nil
+}
@@ -2,12 +2,12 @@ package client
 
 import (
 	"context"
-	"os"
 
-	"github.com/cedi/hugo-hoster/api/v1alpha1"
+	"github.com/cedi/hugo-hoster/api/v1beta1"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -15,34 +15,37 @@ import (
 // SettingsClient is a Kubernetes client for easy CRUD operations
 type SettingsClient struct {
 	client client.Client
+
+	// namespace is used by the calls that do not name a namespace
+	namespace string
+
 	tracer trace.Tracer
 }
 
 // NewSettingsClient creates a new Setting Client
-func NewSettingsClient(client client.Client, tracer trace.Tracer) *SettingsClient {
+func NewSettingsClient(client client.Client, namespace string, tracer trace.Tracer) *SettingsClient {
 	return &SettingsClient{
-		client: client,
-		tracer: tracer,
+		client:    client,
+		namespace: namespace,
+		tracer:    tracer,
 	}
 }
 
 // Get returns a Setting in the current namespace
-func (c *SettingsClient) Get(ct context.Context, name string) (*v1alpha1.Setting, error) {
+func (c *SettingsClient) Get(ct context.Context, name string) (*v1beta1.Setting, error) {
 	ctx, span := c.tracer.Start(ct, "SettingsClient.Get", trace.WithAttributes(attribute.String("name", name)))
 	defer span.End()
 
-	// try to read the namespace from /var/run
-	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		span.RecordError(err)
-		return nil, errors.Wrap(err, "Unable to read current namespace")
+	if c.namespace == "" {
+		span.RecordError(ErrNoNamespace)
+		return nil, ErrNoNamespace
 	}
 
-	return c.GetNamespaced(ctx, types.NamespacedName{Name: name, Namespace: string(namespace)})
+	return c.GetNamespaced(ctx, types.NamespacedName{Name: name, Namespace: c.namespace})
 }
 
 // GetNameNamespace returns a Setting for a given name in a given namespace
-func (c *SettingsClient) GetNameNamespace(ct context.Context, name, namespace string) (*v1alpha1.Setting, error) {
+func (c *SettingsClient) GetNameNamespace(ct context.Context, name, namespace string) (*v1beta1.Setting, error) {
 	ctx, span := c.tracer.Start(ct, "SettingsClient.GetNameNamespace", trace.WithAttributes(attribute.String("name", name), attribute.String("namespace", namespace)))
 	defer span.End()
 
@@ -50,7 +53,7 @@ func (c *SettingsClient) GetNameNamespace(ct context.Context, name, namespace st
 }
 
 // Get returns a Setting
-func (c *SettingsClient) GetNamespaced(ct context.Context, nameNamespaced types.NamespacedName) (*v1alpha1.Setting, error) {
+func (c *SettingsClient) GetNamespaced(ct context.Context, nameNamespaced types.NamespacedName) (*v1beta1.Setting, error) {
 	ctx, span := c.tracer.Start(
 		ct, "SettingsClient.GetNamespaced",
 		trace.WithAttributes(
@@ -60,7 +63,7 @@ func (c *SettingsClient) GetNamespaced(ct context.Context, nameNamespaced types.
 	)
 	defer span.End()
 
-	Setting := &v1alpha1.Setting{}
+	Setting := &v1beta1.Setting{}
 
 	if err := c.client.Get(ctx, nameNamespaced, Setting); err != nil {
 		span.RecordError(err)
@@ -71,26 +74,24 @@ func (c *SettingsClient) GetNamespaced(ct context.Context, nameNamespaced types.
 }
 
 // List returns a list of all Settings in the current namespace
-func (c *SettingsClient) List(ct context.Context) (*v1alpha1.SettingList, error) {
+func (c *SettingsClient) List(ct context.Context) (*v1beta1.SettingList, error) {
 	ctx, span := c.tracer.Start(ct, "SettingsClient.List")
 	defer span.End()
 
-	// try to read the namespace from /var/run
-	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		span.RecordError(err)
-		return nil, errors.Wrap(err, "Unable to read current namespace")
+	if c.namespace == "" {
+		span.RecordError(ErrNoNamespace)
+		return nil, ErrNoNamespace
 	}
 
-	return c.ListNamespaced(ctx, string(namespace))
+	return c.ListNamespaced(ctx, c.namespace)
 }
 
 // ListNamespaced returns a list of all Settings in a namespace
-func (c *SettingsClient) ListNamespaced(ct context.Context, namespace string) (*v1alpha1.SettingList, error) {
+func (c *SettingsClient) ListNamespaced(ct context.Context, namespace string) (*v1beta1.SettingList, error) {
 	ctx, span := c.tracer.Start(ct, "SettingsClient.ListNamespaced", trace.WithAttributes(attribute.String("namespace", namespace)))
 	defer span.End()
 
-	Settings := &v1alpha1.SettingList{}
+	Settings := &v1beta1.SettingList{}
 
 	if err := c.client.List(ctx, Settings, &client.ListOptions{Namespace: namespace}); err != nil {
 		span.RecordError(err)
@@ -100,7 +101,7 @@ func (c *SettingsClient) ListNamespaced(ct context.Context, namespace string) (*
 	return Settings, nil
 }
 
-func (c *SettingsClient) Update(ct context.Context, Setting *v1alpha1.Setting) error {
+func (c *SettingsClient) Update(ct context.Context, Setting *v1beta1.Setting) error {
 	ctx, span := c.tracer.Start(ct, "SettingsClient.Update", trace.WithAttributes(attribute.String("Setting", Setting.ObjectMeta.Name), attribute.String("namespace", Setting.ObjectMeta.Namespace)))
 	defer span.End()
 
@@ -112,7 +113,7 @@ func (c *SettingsClient) Update(ct context.Context, Setting *v1alpha1.Setting) e
 	return nil
 }
 
-func (c *SettingsClient) Delete(ct context.Context, Setting *v1alpha1.Setting) error {
+func (c *SettingsClient) Delete(ct context.Context, Setting *v1beta1.Setting) error {
 	ctx, span := c.tracer.Start(ct, "SettingsClient.Delete", trace.WithAttributes(attribute.String("name", Setting.Name), attribute.String("namespace", Setting.Namespace)))
 	defer span.End()
 
@@ -124,19 +125,17 @@ func (c *SettingsClient) Delete(ct context.Context, Setting *v1alpha1.Setting) e
 	return nil
 }
 
-func (c *SettingsClient) Create(ct context.Context, Setting *v1alpha1.Setting) error {
+func (c *SettingsClient) Create(ct context.Context, Setting *v1beta1.Setting) error {
 	ctx, span := c.tracer.Start(ct, "SettingsClient.Create", trace.WithAttributes(attribute.String("Setting", Setting.ObjectMeta.Name), attribute.String("namespace", Setting.ObjectMeta.Namespace)))
 	defer span.End()
 
 	if Setting.Namespace == "" {
-		// try to read the namespace from /var/run
-		namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-		if err != nil {
-			span.RecordError(err)
-			return errors.Wrap(err, "Unable to read current namespace")
+		if c.namespace == "" {
+			span.RecordError(ErrNoNamespace)
+			return ErrNoNamespace
 		}
 
-		Setting.Namespace = string(namespace)
+		Setting.Namespace = c.namespace
 	}
 
 	// if not exists, create a new one
@@ -147,3 +146,214 @@ func (c *SettingsClient) Create(ct context.Context, Setting *v1alpha1.Setting) e
 
 	return nil
 }
+
+// GetClusterSetting returns a ClusterSetting
+func (c *SettingsClient) GetClusterSetting(ct context.Context, name string) (*v1beta1.ClusterSetting, error) {
+	ctx, span := c.tracer.Start(ct, "SettingsClient.GetClusterSetting", trace.WithAttributes(attribute.String("name", name)))
+	defer span.End()
+
+	clusterSetting := &v1beta1.ClusterSetting{}
+
+	if err := c.client.Get(ctx, types.NamespacedName{Name: name}, clusterSetting); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return clusterSetting, nil
+}
+
+// ListClusterSettings returns a list of all ClusterSettings
+func (c *SettingsClient) ListClusterSettings(ct context.Context) (*v1beta1.ClusterSettingList, error) {
+	ctx, span := c.tracer.Start(ct, "SettingsClient.ListClusterSettings")
+	defer span.End()
+
+	clusterSettings := &v1beta1.ClusterSettingList{}
+
+	if err := c.client.List(ctx, clusterSettings); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return clusterSettings, nil
+}
+
+func (c *SettingsClient) UpdateClusterSetting(ct context.Context, clusterSetting *v1beta1.ClusterSetting) error {
+	ctx, span := c.tracer.Start(ct, "SettingsClient.UpdateClusterSetting", trace.WithAttributes(attribute.String("name", clusterSetting.Name)))
+	defer span.End()
+
+	if err := c.client.Update(ctx, clusterSetting); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *SettingsClient) DeleteClusterSetting(ct context.Context, clusterSetting *v1beta1.ClusterSetting) error {
+	ctx, span := c.tracer.Start(ct, "SettingsClient.DeleteClusterSetting", trace.WithAttributes(attribute.String("name", clusterSetting.Name)))
+	defer span.End()
+
+	if err := c.client.Delete(ctx, clusterSetting); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *SettingsClient) CreateClusterSetting(ct context.Context, clusterSetting *v1beta1.ClusterSetting) error {
+	ctx, span := c.tracer.Start(ct, "SettingsClient.CreateClusterSetting", trace.WithAttributes(attribute.String("name", clusterSetting.Name)))
+	defer span.End()
+
+	if err := c.client.Create(ctx, clusterSetting); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// ResolvedSetting is the Setting or ClusterSetting a HugoPage is configured by
+type ResolvedSetting struct {
+	// Kind is either v1beta1.SettingKind or v1beta1.ClusterSettingKind
+	Kind string
+
+	// Name of the Setting or ClusterSetting
+	Name string
+
+	// Namespace of the Setting. Empty for a ClusterSetting
+	Namespace string
+
+	Spec v1beta1.SettingSpec
+}
+
+// CredentialsSecretNamespace returns the namespace the S3 credentials Secret is read from
+func (s *ResolvedSetting) CredentialsSecretNamespace() string {
+	return s.SecretNamespace(s.Spec.Storage.S3.CredentialsSecret.Namespace)
+}
+
+// SecretNamespace returns the namespace a Secret referenced with namespace is read from.
+// A Setting always reads Secrets from its own namespace.
+func (s *ResolvedSetting) SecretNamespace(namespace string) string {
+	if s.Kind == v1beta1.SettingKind {
+		return s.Namespace
+	}
+
+	return namespace
+}
+
+// Resolve returns the Setting or ClusterSetting that configures page.
+// Without a settingRef on the page, the Setting defaultName in the namespace of the page
+// is used, falling back to the ClusterSetting defaultName.
+func (c *SettingsClient) Resolve(ct context.Context, page *v1beta1.HugoPage, defaultName string) (*ResolvedSetting, error) {
+	ctx, span := c.tracer.Start(ct, "SettingsClient.Resolve", trace.WithAttributes(attribute.String("page", page.Name), attribute.String("namespace", page.Namespace)))
+	defer span.End()
+
+	kind := ""
+	name := defaultName
+
+	if page.Spec.SettingRef != nil {
+		kind = page.Spec.SettingRef.Kind
+		name = page.Spec.SettingRef.Name
+
+		if kind == "" {
+			kind = v1beta1.SettingKind
+		}
+	}
+
+	span.SetAttributes(attribute.String("setting_kind", kind), attribute.String("setting_name", name))
+
+	if kind == "" || kind == v1beta1.SettingKind {
+		setting, err := c.GetNameNamespace(ctx, name, page.Namespace)
+		if err == nil {
+			return &ResolvedSetting{Kind: v1beta1.SettingKind, Name: setting.Name, Namespace: setting.Namespace, Spec: setting.Spec}, nil
+		}
+
+		// only an implicit reference falls back to the ClusterSetting
+		if kind != "" || !k8serrors.IsNotFound(err) {
+			span.RecordError(err)
+			return nil, errors.Wrapf(err, "Failed to fetch Setting %s/%s", page.Namespace, name)
+		}
+	}
+
+	clusterSetting, err := c.GetClusterSetting(ctx, name)
+	if err != nil {
+		span.RecordError(err)
+		return nil, errors.Wrapf(err, "Failed to fetch ClusterSetting %s", name)
+	}
+
+	if !clusterSetting.Spec.AllowsNamespace(page.Namespace) {
+		err := errors.Errorf("ClusterSetting %s does not allow namespace %s in spec.allowedNamespaces", name, page.Namespace)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return &ResolvedSetting{Kind: v1beta1.ClusterSettingKind, Name: clusterSetting.Name, Spec: clusterSetting.Spec.SettingSpec}, nil
+}
+
+// ListDependentPages returns all HugoPages that resolve to the Setting or ClusterSetting kind/name.
+// namespace is only used for a Setting. defaultName is the Setting used by pages without a settingRef.
+func (c *SettingsClient) ListDependentPages(ct context.Context, kind, name, namespace, defaultName string) ([]v1beta1.HugoPage, error) {
+	ctx, span := c.tracer.Start(ct, "SettingsClient.ListDependentPages", trace.WithAttributes(attribute.String("kind", kind), attribute.String("name", name), attribute.String("namespace", namespace)))
+	defer span.End()
+
+	listOptions := &client.ListOptions{}
+	if kind == v1beta1.SettingKind {
+		listOptions.Namespace = namespace
+	}
+
+	pages := &v1beta1.HugoPageList{}
+	if err := c.client.List(ctx, pages, listOptions); err != nil {
+		span.RecordError(err)
+		return nil, errors.Wrap(err, "Failed to list HugoPages")
+	}
+
+	// Pages without a settingRef only fall back to the ClusterSetting
+	// if their namespace has no Setting of the default name
+	shadowed := make(map[string]bool)
+	if kind == v1beta1.ClusterSettingKind && name == defaultName {
+		settings := &v1beta1.SettingList{}
+		if err := c.client.List(ctx, settings); err != nil {
+			span.RecordError(err)
+			return nil, errors.Wrap(err, "Failed to list Settings")
+		}
+
+		for _, setting := range settings.Items {
+			if setting.Name == defaultName {
+				shadowed[setting.Namespace] = true
+			}
+		}
+	}
+
+	dependent := make([]v1beta1.HugoPage, 0)
+	for _, page := range pages.Items {
+		ref := page.Spec.SettingRef
+
+		switch {
+		case ref == nil && kind == v1beta1.SettingKind:
+			if name != defaultName {
+				continue
+			}
+
+		case ref == nil && kind == v1beta1.ClusterSettingKind:
+			if name != defaultName || shadowed[page.Namespace] {
+				continue
+			}
+
+		case ref.Name != name:
+			continue
+
+		case ref.Kind == "" || ref.Kind == v1beta1.SettingKind:
+			if kind != v1beta1.SettingKind {
+				continue
+			}
+
+		case ref.Kind != kind:
+			continue
+		}
+
+		dependent = append(dependent, page)
+	}
+
+	return dependent, nil
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cedi/hugo-hoster/api/v1beta1"
+	"go.opentelemetry.io/otel/trace/noop"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveAllowedNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	clusterSetting := &v1beta1.ClusterSetting{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings"},
+		Spec:       v1beta1.ClusterSettingSpec{AllowedNamespaces: []string{"web", "team-*"}},
+	}
+
+	c := NewSettingsClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(clusterSetting).Build(), "", noop.NewTracerProvider().Tracer("settings_client_test"))
+
+	tests := []struct {
+		namespace  string
+		settingRef *v1beta1.SettingRef
+		wantErr    bool
+	}{
+		{namespace: "web"},
+		{namespace: "team-docs"},
+		{namespace: "tenant", wantErr: true},
+		{namespace: "tenant", settingRef: &v1beta1.SettingRef{Kind: v1beta1.ClusterSettingKind, Name: "settings"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			page := &v1beta1.HugoPage{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: tt.namespace}}
+			page.Spec.SettingRef = tt.settingRef
+
+			resolved, err := c.Resolve(context.Background(), page, "settings")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+
+			if err == nil && resolved.Kind != v1beta1.ClusterSettingKind {
+				t.Errorf("want the ClusterSetting resolved, got %s", resolved.Kind)
+			}
+		})
+	}
+}
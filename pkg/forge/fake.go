@@ -0,0 +1,109 @@
+package forge
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Fake is an in-memory Forge for tests
+type Fake struct {
+	mu sync.Mutex
+
+	// PullRequests are the open pull requests by repository
+	PullRequests map[string][]PullRequest
+
+	// Branches are the commits branches point to by repository and branch
+	Branches map[string]map[string]string
+
+	// Statuses are the commit statuses set, in order
+	Statuses []SetStatus
+
+	// Err is returned by every call if set
+	Err error
+}
+
+// SetStatus is a call of SetCommitStatus recorded by the Fake
+type SetStatus struct {
+	Repository string
+	Commit     string
+	Status     CommitStatus
+}
+
+// NewFake creates a new Fake without any pull requests
+func NewFake() *Fake {
+	return &Fake{
+		PullRequests: map[string][]PullRequest{},
+		Branches:     map[string]map[string]string{},
+	}
+}
+
+// Factory returns a Factory that always returns f
+func (f *Fake) Factory() Factory {
+	return func(Config) (Forge, error) {
+		return f, nil
+	}
+}
+
+// SetPullRequests replaces the open pull requests of repository
+func (f *Fake) SetPullRequests(repository string, pullRequests ...PullRequest) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.PullRequests[repository] = pullRequests
+}
+
+// SetBranch points branch of repository to commit
+func (f *Fake) SetBranch(repository, branch, commit string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Branches[repository] == nil {
+		f.Branches[repository] = map[string]string{}
+	}
+
+	f.Branches[repository][branch] = commit
+}
+
+// OpenPullRequests returns the pull requests set for repository
+func (f *Fake) OpenPullRequests(_ context.Context, repository string) ([]PullRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	return append([]PullRequest{}, f.PullRequests[repository]...), nil
+}
+
+// SetCommitStatus records status of commit in repository
+func (f *Fake) SetCommitStatus(_ context.Context, repository, commit string, status CommitStatus) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+
+	f.Statuses = append(f.Statuses, SetStatus{Repository: repository, Commit: commit, Status: status})
+	return nil
+}
+
+// BranchCommit returns the commit set for branch of repository
+func (f *Fake) BranchCommit(_ context.Context, repository, branch string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return "", f.Err
+	}
+
+	commit, ok := f.Branches[repository][branch]
+	if !ok {
+		return "", errors.Errorf("Branch %s of %s not found", branch, repository)
+	}
+
+	return commit, nil
+}
@@ -0,0 +1,211 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TypeGitHub = "github"
+	TypeGitLab = "gitlab"
+	TypeGitea  = "gitea"
+
+	// pageSize is the number of items requested per page of a list call
+	pageSize = 100
+)
+
+// Config holds everything needed to connect to the API of a forge
+type Config struct {
+	Type  string
+	URL   string
+	Token string
+}
+
+// PullRequest is an open pull request, or merge request in GitLab terms
+type PullRequest struct {
+	Number int
+
+	// Branch is the source branch of the pull request in the repository CloneURL
+	Branch   string
+	Commit   string
+	CloneURL string
+
+	// Fork is true if the pull request comes from another repository than it targets
+	Fork bool
+}
+
+// CommitState is the state of a commit status
+type CommitState string
+
+const (
+	CommitStatePending CommitState = "pending"
+	CommitStateSuccess CommitState = "success"
+	CommitStateFailure CommitState = "failure"
+
+	// maxDescriptionLength is the longest description of a commit status GitHub accepts
+	maxDescriptionLength = 140
+)
+
+// CommitStatus is the state of building and deploying a commit
+type CommitStatus struct {
+	State CommitState
+
+	// Context tells apart the statuses of different systems on the same commit
+	Context     string
+	Description string
+
+	// TargetURL is linked from the status, like the deployed site
+	TargetURL string
+}
+
+// Forge is the API of a git forge
+type Forge interface {
+	// OpenPullRequests lists the open pull requests targeting repository, which is a git URL
+	OpenPullRequests(ctx context.Context, repository string) ([]PullRequest, error)
+
+	// SetCommitStatus sets the status of commit in repository, which is a git URL
+	SetCommitStatus(ctx context.Context, repository, commit string, status CommitStatus) error
+
+	// BranchCommit returns the commit branch of repository, which is a git URL, points to
+	BranchCommit(ctx context.Context, repository, branch string) (string, error)
+}
+
+// Factory creates the Forge for config
+type Factory func(config Config) (Forge, error)
+
+// NewFactory returns a Factory creating API clients of the supported forges
+func NewFactory(tracer trace.Tracer) Factory {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+
+	return func(config Config) (Forge, error) {
+		switch config.Type {
+		case TypeGitHub:
+			return NewGitHub(httpClient, config.URL, config.Token, tracer), nil
+
+		case TypeGitLab:
+			return NewGitLab(httpClient, config.URL, config.Token, tracer), nil
+
+		case TypeGitea:
+			if config.URL == "" {
+				return nil, errors.New("Gitea requires the URL of its API")
+			}
+
+			return NewGitea(httpClient, config.URL, config.Token, tracer), nil
+
+		default:
+			return nil, errors.Errorf("Unsupported forge type %q", config.Type)
+		}
+	}
+}
+
+// repositoryPath returns the path of a repository on its forge, like owner/repo, from its git URL
+func repositoryPath(repository string) (string, error) {
+	path := ""
+
+	if u, err := url.Parse(repository); err == nil && u.Host != "" {
+		path = u.Path
+	} else if _, scpPath, ok := strings.Cut(repository, ":"); ok {
+		// scp-like syntax, as in git@github.com:owner/repo.git
+		path = scpPath
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if !strings.Contains(path, "/") {
+		return "", errors.Errorf("Failed to parse repository path from %q", repository)
+	}
+
+	return path, nil
+}
+
+// MatchRepository reports whether repository, which is a git URL, matches one of patterns.
+// Patterns are matched against the host and path of the repository, like github.com/cedi/*
+func MatchRepository(patterns []string, repository string) bool {
+	id := repositoryID(repository)
+	if id == "" {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		if matched, err := path.Match(strings.ToLower(strings.TrimSuffix(pattern, ".git")), id); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getJSON decodes the JSON response to a GET request of url into out
+func getJSON(ctx context.Context, httpClient *http.Client, url string, header http.Header, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request for %s", url)
+	}
+
+	req.Header = header
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to request %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("Request to %s failed with %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "Failed to decode response of %s", url)
+	}
+
+	return nil
+}
+
+// postJSON posts body encoded as JSON to url
+func postJSON(ctx context.Context, httpClient *http.Client, url string, header http.Header, body any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode request for %s", url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(encoded))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request for %s", url)
+	}
+
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to request %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("Request to %s failed with %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// truncateDescription shortens description to the length forges accept
+func truncateDescription(description string) string {
+	runes := []rune(description)
+	if len(runes) <= maxDescriptionLength {
+		return description
+	}
+
+	return string(runes[:maxDescriptionLength-1]) + "…"
+}
@@ -0,0 +1,299 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var tracer = noop.NewTracerProvider().Tracer("forge_test")
+
+func TestRepositoryPath(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/cedi/hugo-hoster.git":       "cedi/hugo-hoster",
+		"https://github.com/cedi/hugo-hoster":           "cedi/hugo-hoster",
+		"git@github.com:cedi/hugo-hoster.git":           "cedi/hugo-hoster",
+		"https://gitlab.example.com/group/sub/site.git": "group/sub/site",
+	}
+
+	for repository, want := range tests {
+		got, err := repositoryPath(repository)
+		if err != nil {
+			t.Errorf("repositoryPath(%q) failed: %v", repository, err)
+		}
+
+		if got != want {
+			t.Errorf("repositoryPath(%q) = %q, want %q", repository, got, want)
+		}
+	}
+
+	if _, err := repositoryPath("hugo-hoster"); err == nil {
+		t.Error("repositoryPath without owner succeeded")
+	}
+}
+
+func serveJSON(t *testing.T, routes map[string]any, check func(r *http.Request)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+
+		body, ok := routes[r.URL.RequestURI()]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL.RequestURI())
+			http.NotFound(w, r)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGitHubOpenPullRequests(t *testing.T) {
+	repo := map[string]any{"full_name": "cedi/site", "clone_url": "https://github.com/cedi/site.git"}
+	fork := map[string]any{"full_name": "someone/site", "clone_url": "https://github.com/someone/site.git"}
+
+	server := serveJSON(t, map[string]any{
+		"/repos/cedi/site/pulls?state=open&per_page=100&page=1": []any{
+			map[string]any{"number": 1, "head": map[string]any{"ref": "feature", "sha": "abc", "repo": repo}, "base": map[string]any{"repo": repo}},
+			map[string]any{"number": 2, "head": map[string]any{"ref": "main", "sha": "def", "repo": fork}, "base": map[string]any{"repo": repo}},
+			map[string]any{"number": 3, "head": map[string]any{"ref": "gone", "sha": "123", "repo": nil}, "base": map[string]any{"repo": repo}},
+		},
+	}, func(r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("want Authorization header, got %q", got)
+		}
+	})
+
+	github := NewGitHub(server.Client(), server.URL, "secret", tracer)
+	got, err := github.OpenPullRequests(context.Background(), "https://github.com/cedi/site.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PullRequest{
+		{Number: 1, Branch: "feature", Commit: "abc", CloneURL: "https://github.com/cedi/site.git"},
+		{Number: 2, Branch: "main", Commit: "def", CloneURL: "https://github.com/someone/site.git", Fork: true},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected pull requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestGitLabOpenPullRequests(t *testing.T) {
+	server := serveJSON(t, map[string]any{
+		"/projects/group%2Fsite/merge_requests?state=opened&per_page=100&page=1": []any{
+			map[string]any{"iid": 7, "source_branch": "feature", "sha": "abc", "source_project_id": 1, "target_project_id": 1},
+			map[string]any{"iid": 8, "source_branch": "main", "sha": "def", "source_project_id": 2, "target_project_id": 1},
+		},
+		"/projects/2": map[string]any{"http_url_to_repo": "https://gitlab.com/someone/site.git"},
+	}, func(r *http.Request) {
+		if got := r.Header.Get("PRIVATE-TOKEN"); got != "secret" {
+			t.Errorf("want PRIVATE-TOKEN header, got %q", got)
+		}
+	})
+
+	gitlab := NewGitLab(server.Client(), server.URL, "secret", tracer)
+	got, err := gitlab.OpenPullRequests(context.Background(), "https://gitlab.com/group/site.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PullRequest{
+		{Number: 7, Branch: "feature", Commit: "abc", CloneURL: "https://gitlab.com/group/site.git"},
+		{Number: 8, Branch: "main", Commit: "def", CloneURL: "https://gitlab.com/someone/site.git", Fork: true},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected merge requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestRequestFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	github := NewGitHub(server.Client(), server.URL, "", tracer)
+	if _, err := github.OpenPullRequests(context.Background(), "https://github.com/cedi/site.git"); err == nil {
+		t.Error("want error for unauthorized request")
+	}
+}
+
+func TestGiteaOpenPullRequests(t *testing.T) {
+	repo := map[string]any{"full_name": "cedi/site", "clone_url": "https://gitea.example.com/cedi/site.git"}
+
+	server := serveJSON(t, map[string]any{
+		"/repos/cedi/site/pulls?state=open&limit=50&page=1": []any{
+			map[string]any{"number": 4, "head": map[string]any{"ref": "feature", "sha": "abc", "repo": repo}, "base": map[string]any{"repo": repo}},
+		},
+	}, func(r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "token secret" {
+			t.Errorf("want Authorization header, got %q", got)
+		}
+	})
+
+	gitea := NewGitea(server.Client(), server.URL, "secret", tracer)
+	got, err := gitea.OpenPullRequests(context.Background(), "https://gitea.example.com/cedi/site.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PullRequest{{Number: 4, Branch: "feature", Commit: "abc", CloneURL: "https://gitea.example.com/cedi/site.git"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected pull requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetCommitStatus(t *testing.T) {
+	status := CommitStatus{
+		State:       CommitStateFailure,
+		Context:     "hugo-hoster",
+		Description: "Build #3 failed",
+		TargetURL:   "https://site.example.com/",
+	}
+
+	tests := []struct {
+		name  string
+		forge func(server *httptest.Server) Forge
+		path  string
+		body  map[string]any
+	}{
+		{
+			name:  "github",
+			forge: func(server *httptest.Server) Forge { return NewGitHub(server.Client(), server.URL, "secret", tracer) },
+			path:  "/repos/cedi/site/statuses/abc",
+			body:  map[string]any{"state": "failure", "context": "hugo-hoster", "description": "Build #3 failed", "target_url": "https://site.example.com/"},
+		},
+		{
+			name:  "gitlab",
+			forge: func(server *httptest.Server) Forge { return NewGitLab(server.Client(), server.URL, "secret", tracer) },
+			path:  "/projects/cedi%2Fsite/statuses/abc",
+			body:  map[string]any{"state": "failed", "name": "hugo-hoster", "description": "Build #3 failed", "target_url": "https://site.example.com/"},
+		},
+		{
+			name:  "gitea",
+			forge: func(server *httptest.Server) Forge { return NewGitea(server.Client(), server.URL, "secret", tracer) },
+			path:  "/repos/cedi/site/statuses/abc",
+			body:  map[string]any{"state": "failure", "context": "hugo-hoster", "description": "Build #3 failed", "target_url": "https://site.example.com/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				if r.Method != http.MethodPost || r.URL.EscapedPath() != tt.path {
+					t.Errorf("want POST %s, got %s %s", tt.path, r.Method, r.URL.EscapedPath())
+				}
+
+				body := map[string]any{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(tt.body, body); diff != "" {
+					t.Errorf("unexpected commit status (-want +got):\n%s", diff)
+				}
+
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+
+			if err := tt.forge(server).SetCommitStatus(context.Background(), "https://example.com/cedi/site.git", "abc", status); err != nil {
+				t.Fatal(err)
+			}
+
+			if requests != 1 {
+				t.Errorf("want 1 request, got %d", requests)
+			}
+		})
+	}
+}
+
+func TestTruncateDescription(t *testing.T) {
+	long := strings.Repeat("ä", 200)
+	if got := []rune(truncateDescription(long)); len(got) != maxDescriptionLength {
+		t.Errorf("want description truncated to %d characters, got %d", maxDescriptionLength, len(got))
+	}
+
+	if got := truncateDescription("short"); got != "short" {
+		t.Errorf("want short description unchanged, got %q", got)
+	}
+}
+
+func TestBranchCommit(t *testing.T) {
+	tests := []struct {
+		name  string
+		forge func(server *httptest.Server) Forge
+		path  string
+		body  any
+	}{
+		{
+			name:  "github",
+			forge: func(server *httptest.Server) Forge { return NewGitHub(server.Client(), server.URL, "secret", tracer) },
+			path:  "/repos/cedi/site/branches/release%2Fv1",
+			body:  map[string]any{"name": "release/v1", "commit": map[string]any{"sha": "abc"}},
+		},
+		{
+			name:  "gitlab",
+			forge: func(server *httptest.Server) Forge { return NewGitLab(server.Client(), server.URL, "secret", tracer) },
+			path:  "/projects/cedi%2Fsite/repository/branches/release%2Fv1",
+			body:  map[string]any{"name": "release/v1", "commit": map[string]any{"id": "abc"}},
+		},
+		{
+			name:  "gitea",
+			forge: func(server *httptest.Server) Forge { return NewGitea(server.Client(), server.URL, "secret", tracer) },
+			path:  "/repos/cedi/site/branches/release%2Fv1",
+			body:  map[string]any{"name": "release/v1", "commit": map[string]any{"id": "abc"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := serveJSON(t, map[string]any{tt.path: tt.body}, func(*http.Request) {})
+
+			commit, err := tt.forge(server).BranchCommit(context.Background(), "https://example.com/cedi/site.git", "release/v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if commit != "abc" {
+				t.Errorf("want commit abc, got %q", commit)
+			}
+		})
+	}
+}
+
+func TestMatchRepository(t *testing.T) {
+	patterns := []string{"github.com/cedi/*", "gitlab.example.com/group/site.git"}
+
+	tests := map[string]bool{
+		"https://github.com/cedi/site.git":           true,
+		"git@github.com:cedi/blog.git":               true,
+		"https://GitHub.com/Cedi/Site":               true,
+		"https://gitlab.example.com/group/site.git":  true,
+		"https://github.com/someone/site.git":        false,
+		"https://github.com/cedi/group/site.git":     false,
+		"https://gitlab.example.com/group/other.git": false,
+		"https://evil.example.com/github.com/cedi/x": false,
+		"not a repository":                           false,
+	}
+
+	for repository, want := range tests {
+		if got := MatchRepository(patterns, repository); got != want {
+			t.Errorf("MatchRepository(%q) = %v, want %v", repository, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// giteaPageSize is the number of items requested per page, as Gitea caps pages at 50 items by default
+const giteaPageSize = 50
+
+// Gitea is a client of the Gitea REST API, which is modelled after the one of GitHub
+type Gitea struct {
+	httpClient *http.Client
+	url        string
+	token      string
+	tracer     trace.Tracer
+}
+
+// NewGitea creates a new Gitea client for the API at url, like https://gitea.example.com/api/v1
+func NewGitea(httpClient *http.Client, url, token string, tracer trace.Tracer) *Gitea {
+	return &Gitea{
+		httpClient: httpClient,
+		url:        strings.TrimSuffix(url, "/"),
+		token:      token,
+		tracer:     tracer,
+	}
+}
+
+// OpenPullRequests lists the open pull requests of repository
+func (g *Gitea) OpenPullRequests(ct context.Context, repository string) ([]PullRequest, error) {
+	ctx, span := g.tracer.Start(ct, "Gitea.OpenPullRequests", trace.WithAttributes(attribute.String("repository", repository)))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	pullRequests := []PullRequest{}
+	for page := 1; ; page++ {
+		listURL := fmt.Sprintf("%s/repos/%s/pulls?state=open&limit=%d&page=%d", g.url, path, giteaPageSize, page)
+
+		items := []gitHubPullRequest{}
+		if err := getJSON(ctx, g.httpClient, listURL, g.header(), &items); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+
+		for _, item := range items {
+			// The repository of the head is gone if the fork was deleted
+			if item.Head.Repo == nil {
+				continue
+			}
+
+			pullRequests = append(pullRequests, PullRequest{
+				Number:   item.Number,
+				Branch:   item.Head.Ref,
+				Commit:   item.Head.SHA,
+				CloneURL: item.Head.Repo.CloneURL,
+				Fork:     item.Base.Repo == nil || item.Head.Repo.FullName != item.Base.Repo.FullName,
+			})
+		}
+
+		if len(items) < giteaPageSize {
+			return pullRequests, nil
+		}
+	}
+}
+
+// SetCommitStatus sets the status of commit in repository
+func (g *Gitea) SetCommitStatus(ct context.Context, repository, commit string, status CommitStatus) error {
+	ctx, span := g.tracer.Start(ct, "Gitea.SetCommitStatus", trace.WithAttributes(
+		attribute.String("repository", repository),
+		attribute.String("commit", commit),
+		attribute.String("state", string(status.State)),
+	))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	statusURL := fmt.Sprintf("%s/repos/%s/statuses/%s", g.url, path, commit)
+	if err := postJSON(ctx, g.httpClient, statusURL, g.header(), gitHubStatus{
+		State:       string(status.State),
+		TargetURL:   status.TargetURL,
+		Description: truncateDescription(status.Description),
+		Context:     status.Context,
+	}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (g *Gitea) header() http.Header {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+
+	if g.token != "" {
+		header.Set("Authorization", "token "+g.token)
+	}
+
+	return header
+}
+
+// giteaBranch is a branch as Gitea and GitLab return it
+type giteaBranch struct {
+	Commit struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+// BranchCommit returns the commit branch of repository points to
+func (g *Gitea) BranchCommit(ct context.Context, repository, branch string) (string, error) {
+	ctx, span := g.tracer.Start(ct, "Gitea.BranchCommit", trace.WithAttributes(
+		attribute.String("repository", repository),
+		attribute.String("branch", branch),
+	))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	result := giteaBranch{}
+	if err := getJSON(ctx, g.httpClient, fmt.Sprintf("%s/repos/%s/branches/%s", g.url, path, url.PathEscape(branch)), g.header(), &result); err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	return result.Commit.ID, nil
+}
@@ -0,0 +1,172 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultGitHubURL = "https://api.github.com"
+
+// GitHub is a client of the GitHub REST API
+type GitHub struct {
+	httpClient *http.Client
+	url        string
+	token      string
+	tracer     trace.Tracer
+}
+
+// NewGitHub creates a new GitHub client for the API at url, which defaults to api.github.com
+func NewGitHub(httpClient *http.Client, url, token string, tracer trace.Tracer) *GitHub {
+	if url == "" {
+		url = defaultGitHubURL
+	}
+
+	return &GitHub{
+		httpClient: httpClient,
+		url:        strings.TrimSuffix(url, "/"),
+		token:      token,
+		tracer:     tracer,
+	}
+}
+
+type gitHubRepository struct {
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+}
+
+type gitHubPullRequest struct {
+	Number int `json:"number"`
+	Head   struct {
+		Ref  string            `json:"ref"`
+		SHA  string            `json:"sha"`
+		Repo *gitHubRepository `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Repo *gitHubRepository `json:"repo"`
+	} `json:"base"`
+}
+
+// OpenPullRequests lists the open pull requests of repository
+func (g *GitHub) OpenPullRequests(ct context.Context, repository string) ([]PullRequest, error) {
+	ctx, span := g.tracer.Start(ct, "GitHub.OpenPullRequests", trace.WithAttributes(attribute.String("repository", repository)))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	pullRequests := []PullRequest{}
+	for page := 1; ; page++ {
+		listURL := fmt.Sprintf("%s/repos/%s/pulls?state=open&per_page=%d&page=%d", g.url, path, pageSize, page)
+
+		items := []gitHubPullRequest{}
+		if err := getJSON(ctx, g.httpClient, listURL, g.header(), &items); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+
+		for _, item := range items {
+			// The repository of the head is gone if the fork was deleted
+			if item.Head.Repo == nil {
+				continue
+			}
+
+			pullRequests = append(pullRequests, PullRequest{
+				Number:   item.Number,
+				Branch:   item.Head.Ref,
+				Commit:   item.Head.SHA,
+				CloneURL: item.Head.Repo.CloneURL,
+				Fork:     item.Base.Repo == nil || item.Head.Repo.FullName != item.Base.Repo.FullName,
+			})
+		}
+
+		if len(items) < pageSize {
+			return pullRequests, nil
+		}
+	}
+}
+
+func (g *GitHub) header() http.Header {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+
+	if g.token != "" {
+		header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	return header
+}
+
+// gitHubStatus is a commit status as GitHub and Gitea accept it
+type gitHubStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context"`
+}
+
+// SetCommitStatus sets the status of commit in repository
+func (g *GitHub) SetCommitStatus(ct context.Context, repository, commit string, status CommitStatus) error {
+	ctx, span := g.tracer.Start(ct, "GitHub.SetCommitStatus", trace.WithAttributes(
+		attribute.String("repository", repository),
+		attribute.String("commit", commit),
+		attribute.String("state", string(status.State)),
+	))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	statusURL := fmt.Sprintf("%s/repos/%s/statuses/%s", g.url, path, commit)
+	if err := postJSON(ctx, g.httpClient, statusURL, g.header(), gitHubStatus{
+		State:       string(status.State),
+		TargetURL:   status.TargetURL,
+		Description: truncateDescription(status.Description),
+		Context:     status.Context,
+	}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+type gitHubBranch struct {
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// BranchCommit returns the commit branch of repository points to
+func (g *GitHub) BranchCommit(ct context.Context, repository, branch string) (string, error) {
+	ctx, span := g.tracer.Start(ct, "GitHub.BranchCommit", trace.WithAttributes(
+		attribute.String("repository", repository),
+		attribute.String("branch", branch),
+	))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	result := gitHubBranch{}
+	if err := getJSON(ctx, g.httpClient, fmt.Sprintf("%s/repos/%s/branches/%s", g.url, path, url.PathEscape(branch)), g.header(), &result); err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	return result.Commit.SHA, nil
+}
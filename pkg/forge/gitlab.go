@@ -0,0 +1,183 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultGitLabURL = "https://gitlab.com/api/v4"
+
+// GitLab is a client of the GitLab REST API
+type GitLab struct {
+	httpClient *http.Client
+	url        string
+	token      string
+	tracer     trace.Tracer
+}
+
+// NewGitLab creates a new GitLab client for the API at url, which defaults to gitlab.com
+func NewGitLab(httpClient *http.Client, url, token string, tracer trace.Tracer) *GitLab {
+	if url == "" {
+		url = defaultGitLabURL
+	}
+
+	return &GitLab{
+		httpClient: httpClient,
+		url:        strings.TrimSuffix(url, "/"),
+		token:      token,
+		tracer:     tracer,
+	}
+}
+
+type gitLabMergeRequest struct {
+	IID             int    `json:"iid"`
+	SourceBranch    string `json:"source_branch"`
+	SHA             string `json:"sha"`
+	SourceProjectID int    `json:"source_project_id"`
+	TargetProjectID int    `json:"target_project_id"`
+}
+
+type gitLabProject struct {
+	HTTPURLToRepo string `json:"http_url_to_repo"`
+}
+
+// OpenPullRequests lists the open merge requests of repository
+func (g *GitLab) OpenPullRequests(ct context.Context, repository string) ([]PullRequest, error) {
+	ctx, span := g.tracer.Start(ct, "GitLab.OpenPullRequests", trace.WithAttributes(attribute.String("repository", repository)))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// the clone URLs of forks are looked up once per project
+	cloneURLs := map[int]string{}
+
+	pullRequests := []PullRequest{}
+	for page := 1; ; page++ {
+		listURL := fmt.Sprintf("%s/projects/%s/merge_requests?state=opened&per_page=%d&page=%d", g.url, url.PathEscape(path), pageSize, page)
+
+		items := []gitLabMergeRequest{}
+		if err := getJSON(ctx, g.httpClient, listURL, g.header(), &items); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+
+		for _, item := range items {
+			pullRequest := PullRequest{
+				Number:   item.IID,
+				Branch:   item.SourceBranch,
+				Commit:   item.SHA,
+				CloneURL: repository,
+				Fork:     item.SourceProjectID != item.TargetProjectID,
+			}
+
+			if pullRequest.Fork {
+				cloneURL, ok := cloneURLs[item.SourceProjectID]
+				if !ok {
+					project := gitLabProject{}
+					if err := getJSON(ctx, g.httpClient, fmt.Sprintf("%s/projects/%d", g.url, item.SourceProjectID), g.header(), &project); err != nil {
+						span.RecordError(err)
+						return nil, err
+					}
+
+					cloneURL = project.HTTPURLToRepo
+					cloneURLs[item.SourceProjectID] = cloneURL
+				}
+
+				pullRequest.CloneURL = cloneURL
+			}
+
+			pullRequests = append(pullRequests, pullRequest)
+		}
+
+		if len(items) < pageSize {
+			return pullRequests, nil
+		}
+	}
+}
+
+func (g *GitLab) header() http.Header {
+	header := http.Header{}
+
+	if g.token != "" {
+		header.Set("PRIVATE-TOKEN", g.token)
+	}
+
+	return header
+}
+
+type gitLabStatus struct {
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// gitLabStates maps commit states to the states of GitLab
+var gitLabStates = map[CommitState]string{
+	CommitStatePending: "pending",
+	CommitStateSuccess: "success",
+	CommitStateFailure: "failed",
+}
+
+// SetCommitStatus sets the status of commit in repository
+func (g *GitLab) SetCommitStatus(ct context.Context, repository, commit string, status CommitStatus) error {
+	ctx, span := g.tracer.Start(ct, "GitLab.SetCommitStatus", trace.WithAttributes(
+		attribute.String("repository", repository),
+		attribute.String("commit", commit),
+		attribute.String("state", string(status.State)),
+	))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	statusURL := fmt.Sprintf("%s/projects/%s/statuses/%s", g.url, url.PathEscape(path), commit)
+	if err := postJSON(ctx, g.httpClient, statusURL, g.header(), gitLabStatus{
+		State:       gitLabStates[status.State],
+		Name:        status.Context,
+		TargetURL:   status.TargetURL,
+		Description: truncateDescription(status.Description),
+	}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// BranchCommit returns the commit branch of repository points to
+func (g *GitLab) BranchCommit(ct context.Context, repository, branch string) (string, error) {
+	ctx, span := g.tracer.Start(ct, "GitLab.BranchCommit", trace.WithAttributes(
+		attribute.String("repository", repository),
+		attribute.String("branch", branch),
+	))
+	defer span.End()
+
+	path, err := repositoryPath(repository)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	result := giteaBranch{}
+	branchURL := fmt.Sprintf("%s/projects/%s/repository/branches/%s", g.url, url.PathEscape(path), url.PathEscape(branch))
+	if err := getJSON(ctx, g.httpClient, branchURL, g.header(), &result); err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	return result.Commit.ID, nil
+}
@@ -0,0 +1,165 @@
+package forge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxWebhookBody is the largest webhook request read, push events of large pushes list many commits
+const maxWebhookBody = 5 << 20
+
+// ErrUnauthorized is returned for a webhook request that was not sent with the secret of the webhook
+var ErrUnauthorized = errors.New("Webhook request is not signed with the secret")
+
+// Push is a push to a branch, as reported by the webhook of a forge
+type Push struct {
+	// Repository is the git URL of the repository pushed to
+	Repository string
+	Branch     string
+	Commit     string
+}
+
+// gitHubPush is the push event of GitHub and Gitea
+type gitHubPush struct {
+	Ref        string           `json:"ref"`
+	After      string           `json:"after"`
+	Deleted    bool             `json:"deleted"`
+	Repository gitHubRepository `json:"repository"`
+}
+
+// gitLabPush is the push event of GitLab
+type gitLabPush struct {
+	Ref         string `json:"ref"`
+	CheckoutSHA string `json:"checkout_sha"`
+	Project     struct {
+		GitHTTPURL string `json:"git_http_url"`
+	} `json:"project"`
+}
+
+// ParsePush parses the push event of a GitHub, GitLab or Gitea webhook after verifying it was sent with secret.
+// It returns nil for other events, like the ping sent when a webhook is created, and for pushes of tags or deleted branches
+func ParsePush(request *http.Request, secret string) (*Push, error) {
+	if secret == "" {
+		return nil, ErrUnauthorized
+	}
+
+	body, err := io.ReadAll(io.LimitReader(request.Body, maxWebhookBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read webhook request")
+	}
+
+	push := &Push{}
+	ref := ""
+
+	switch {
+	case request.Header.Get("X-Gitlab-Event") != "":
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return nil, ErrUnauthorized
+		}
+
+		if request.Header.Get("X-Gitlab-Event") != "Push Hook" {
+			return nil, nil
+		}
+
+		event := &gitLabPush{}
+		if err := json.Unmarshal(body, event); err != nil {
+			return nil, errors.Wrap(err, "Failed to decode GitLab push event")
+		}
+
+		// GitLab reports a deleted branch without a commit to check out
+		if event.CheckoutSHA == "" {
+			return nil, nil
+		}
+
+		ref = event.Ref
+		push.Repository = event.Project.GitHTTPURL
+		push.Commit = event.CheckoutSHA
+
+	// Gitea sends the headers of GitHub as well, so it is told apart first
+	case request.Header.Get("X-Gitea-Event") != "", request.Header.Get("X-GitHub-Event") != "":
+		event, signature := request.Header.Get("X-Gitea-Event"), request.Header.Get("X-Gitea-Signature")
+		if event == "" {
+			event = request.Header.Get("X-GitHub-Event")
+			signature = strings.TrimPrefix(request.Header.Get("X-Hub-Signature-256"), "sha256=")
+		}
+
+		if !validSignature(body, signature, secret) {
+			return nil, ErrUnauthorized
+		}
+
+		if event != "push" {
+			return nil, nil
+		}
+
+		payload := &gitHubPush{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return nil, errors.Wrap(err, "Failed to decode push event")
+		}
+
+		if payload.Deleted {
+			return nil, nil
+		}
+
+		ref = payload.Ref
+		push.Repository = payload.Repository.CloneURL
+		push.Commit = payload.After
+
+	default:
+		return nil, errors.New("Unsupported webhook request, expected a webhook of GitHub, GitLab or Gitea")
+	}
+
+	branch, ok := strings.CutPrefix(ref, "refs/heads/")
+	if !ok {
+		return nil, nil
+	}
+
+	push.Branch = branch
+	return push, nil
+}
+
+// validSignature reports whether signature is the hex encoded HMAC-SHA256 of body with secret
+func validSignature(body []byte, signature, secret string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// SameRepository reports whether the git URLs a and b point at the same repository,
+// like https://github.com/owner/repo and git@github.com:owner/repo.git
+func SameRepository(a, b string) bool {
+	id := repositoryID(a)
+	return id != "" && id == repositoryID(b)
+}
+
+// repositoryID returns the host and path of repository, or an empty string if it can not be parsed
+func repositoryID(repository string) string {
+	host := ""
+
+	if u, err := url.Parse(repository); err == nil && u.Host != "" {
+		host = u.Hostname()
+	} else if before, _, ok := strings.Cut(repository, ":"); ok {
+		host = before[strings.LastIndex(before, "@")+1:]
+	}
+
+	path, err := repositoryPath(repository)
+	if err != nil || host == "" {
+		return ""
+	}
+
+	return strings.ToLower(host + "/" + path)
+}
@@ -0,0 +1,103 @@
+package forge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sign(body, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParsePush(t *testing.T) {
+	const secret = "s3cr3t"
+	gitHubBody := `{"ref":"refs/heads/main","after":"abc123","repository":{"clone_url":"https://github.com/cedi/site.git"}}`
+	gitLabBody := `{"ref":"refs/heads/main","checkout_sha":"abc123","project":{"git_http_url":"https://gitlab.com/cedi/site.git"}}`
+
+	tests := []struct {
+		name    string
+		body    string
+		header  map[string]string
+		want    *Push
+		wantErr error
+	}{
+		{
+			name:   "github",
+			body:   gitHubBody,
+			header: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(gitHubBody, secret)},
+			want:   &Push{Repository: "https://github.com/cedi/site.git", Branch: "main", Commit: "abc123"},
+		},
+		{
+			name:    "github with another secret",
+			body:    gitHubBody,
+			header:  map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(gitHubBody, "guessed")},
+			wantErr: ErrUnauthorized,
+		},
+		{
+			name:   "github ping",
+			body:   `{"zen":"Keep it logically awesome."}`,
+			header: map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign(`{"zen":"Keep it logically awesome."}`, secret)},
+		},
+		{
+			name:   "gitea",
+			body:   gitHubBody,
+			header: map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push", "X-Gitea-Signature": sign(gitHubBody, secret)},
+			want:   &Push{Repository: "https://github.com/cedi/site.git", Branch: "main", Commit: "abc123"},
+		},
+		{
+			name:   "gitlab",
+			body:   gitLabBody,
+			header: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": secret},
+			want:   &Push{Repository: "https://gitlab.com/cedi/site.git", Branch: "main", Commit: "abc123"},
+		},
+		{
+			name:    "gitlab without token",
+			body:    gitLabBody,
+			header:  map[string]string{"X-Gitlab-Event": "Push Hook"},
+			wantErr: ErrUnauthorized,
+		},
+		{
+			name:   "tag",
+			body:   strings.Replace(gitLabBody, "refs/heads/main", "refs/tags/v1.0.0", 1),
+			header: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": secret},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/hooks/push", strings.NewReader(tt.body))
+			for key, value := range tt.header {
+				request.Header.Set(key, value)
+			}
+
+			got, err := ParsePush(request, secret)
+			if err != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("want push %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSameRepository(t *testing.T) {
+	if !SameRepository("https://github.com/Cedi/Site", "git@github.com:cedi/site.git") {
+		t.Error("want the HTTPS and SSH URL of a repository to be the same repository")
+	}
+
+	if SameRepository("https://github.com/cedi/site.git", "https://gitlab.com/cedi/site.git") {
+		t.Error("want repositories of different forges to differ")
+	}
+
+	if SameRepository("site", "site") {
+		t.Error("want URLs that can not be parsed to never match")
+	}
+}
@@ -0,0 +1,357 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends notifications about the builds of Hugo Pages to chat services and webhooks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TypeSlack   = "slack"
+	TypeMatrix  = "matrix"
+	TypeWebhook = "webhook"
+
+	EventBuildFailed     = "BuildFailed"
+	EventBuildRecovered  = "BuildRecovered"
+	EventDeploySucceeded = "DeploySucceeded"
+
+	// dedupWindow is how long a delivered notification is remembered to drop its duplicates
+	dedupWindow = 1 * time.Hour
+)
+
+// defaultTemplates render the message of an event if the sink has no template
+var defaultTemplates = map[string]string{
+	EventBuildFailed:     `Build #{{.Build}} of {{.Namespace}}/{{.Page}} failed after {{.Duration}}{{with .Commit}} at commit {{.}}{{end}}.{{with .LogURL}} Logs: {{.}}{{else}}{{with .Logs}} Read the logs with {{.}}{{end}}{{end}}`,
+	EventBuildRecovered:  `Build #{{.Build}} of {{.Namespace}}/{{.Page}} succeeded again{{with .Commit}} at commit {{.}}{{end}}, {{.URL}} is up to date.`,
+	EventDeploySucceeded: `Deployed {{.Namespace}}/{{.Page}}{{with .Commit}} at commit {{.}}{{end}} to {{.URL}} in {{.Duration}}.`,
+}
+
+// Sink is a service notifications are sent to
+type Sink struct {
+	Name string
+	Type string
+
+	// URL is the incoming webhook of slack, the homeserver of matrix or the URL of a webhook
+	URL    string
+	RoomID string
+
+	// Token is the access token of matrix or the bearer token of a webhook
+	Token    string
+	Template string
+
+	// Internal allows URL to point to a loopback, link-local or private address, which is refused for sinks
+	// configured by tenants, as they could reach services inside the cluster otherwise
+	Internal bool
+}
+
+// Notification is an event of a build of a Hugo Page
+type Notification struct {
+	Event     string        `json:"event"`
+	Page      string        `json:"page"`
+	Namespace string        `json:"namespace"`
+	URL       string        `json:"url,omitempty"`
+	Build     int32         `json:"build"`
+	Result    string        `json:"result"`
+	Commit    string        `json:"commit,omitempty"`
+	Duration  time.Duration `json:"-"`
+
+	// Logs is the kubectl command printing the log of the build
+	Logs string `json:"logs,omitempty"`
+
+	// LogURL links to the log of the build in a log viewer, if one is configured
+	LogURL string `json:"logURL,omitempty"`
+}
+
+// key identifies notification to sink, so retries of the same notification are dropped
+func (n Notification) key(sink Sink) string {
+	return fmt.Sprintf("%s/%s/%s/%d/%s", sink.Name, n.Namespace, n.Page, n.Build, n.Event)
+}
+
+// ErrInternalTarget is returned for a sink that is not Internal but resolves to an internal address
+var ErrInternalTarget = errors.New("Sink resolves to a loopback, link-local or private address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which clusters use for pods and services as well
+var sharedAddressSpace = net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// internalAddress reports whether ip is an address that is not reachable from the internet
+func internalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() ||
+		ip.IsUnspecified() || ip.IsMulticast() || sharedAddressSpace.Contains(ip)
+}
+
+// publicOnly returns a copy of httpClient that refuses to connect to internal addresses. The address is checked after
+// it was resolved, so a name can not resolve to a public address when checked and to an internal one when dialed.
+// Proxies are not used, as the proxy would be dialed instead of the sink
+func publicOnly(httpClient *http.Client) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if custom, ok := httpClient.Transport.(*http.Transport); ok {
+		transport = custom.Clone()
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || internalAddress(ip) {
+				return ErrInternalTarget
+			}
+
+			return nil
+		},
+	}
+
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	public := *httpClient
+	public.Transport = transport
+
+	return &public
+}
+
+// Notifier delivers notifications, retrying failed deliveries and dropping duplicates
+type Notifier struct {
+	httpClient *http.Client
+	tracer     trace.Tracer
+	attempts   int
+	backoff    time.Duration
+
+	// publicClient delivers to the sinks that are not Internal
+	publicClient *http.Client
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+	now  func() time.Time
+}
+
+// NewNotifier creates a new Notifier
+func NewNotifier(httpClient *http.Client, tracer trace.Tracer) *Notifier {
+	return &Notifier{
+		httpClient:   httpClient,
+		publicClient: publicOnly(httpClient),
+		tracer:       tracer,
+		attempts:     3,
+		backoff:      2 * time.Second,
+		sent:         map[string]time.Time{},
+		now:          time.Now,
+	}
+}
+
+// Send delivers notification to sink. A notification already delivered to sink is dropped
+func (n *Notifier) Send(ct context.Context, sink Sink, notification Notification) error {
+	ctx, span := n.tracer.Start(ct, "Notifier.Send", trace.WithAttributes(
+		attribute.String("sink", sink.Name),
+		attribute.String("type", sink.Type),
+		attribute.String("event", notification.Event),
+	))
+	defer span.End()
+
+	key := notification.key(sink)
+	if !n.claim(key) {
+		return nil
+	}
+
+	err := n.send(ctx, sink, notification, key)
+	if err != nil {
+		span.RecordError(err)
+
+		// the notification may be sent again, as it was not delivered
+		n.release(key)
+	}
+
+	return err
+}
+
+func (n *Notifier) send(ctx context.Context, sink Sink, notification Notification, key string) error {
+	text, err := Render(sink.Template, notification)
+	if err != nil {
+		return err
+	}
+
+	method, target, body, err := request(sink, notification, text, key)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		httpClient := n.publicClient
+		if sink.Internal {
+			httpClient = n.httpClient
+		}
+
+		retry, err := n.do(ctx, httpClient, method, target, sink.Token, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= n.attempts {
+			return errors.Wrapf(err, "Failed to notify %s", sink.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "Failed to notify %s", sink.Name)
+
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+// Render renders the message of notification with the Go template text, or the default template of its event
+func Render(text string, notification Notification) (string, error) {
+	if text == "" {
+		text = defaultTemplates[notification.Event]
+	}
+
+	tmpl, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to parse notification template")
+	}
+
+	message := &bytes.Buffer{}
+	if err := tmpl.Execute(message, notification); err != nil {
+		return "", errors.Wrap(err, "Failed to render notification template")
+	}
+
+	return message.String(), nil
+}
+
+// request returns the HTTP request delivering text to sink
+func request(sink Sink, notification Notification, text, key string) (string, string, []byte, error) {
+	var payload any
+	method := http.MethodPost
+	target := sink.URL
+
+	switch sink.Type {
+	case TypeSlack:
+		payload = map[string]string{"text": text}
+
+	case TypeMatrix:
+		// the transaction ID makes the homeserver drop a message it already received
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(key))
+
+		method = http.MethodPut
+		target = fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/hugo-hoster-%x",
+			strings.TrimSuffix(sink.URL, "/"), url.PathEscape(sink.RoomID), hash.Sum64())
+		payload = map[string]string{"msgtype": "m.notice", "body": text}
+
+	case TypeWebhook:
+		payload = struct {
+			Notification
+			DurationSeconds float64 `json:"durationSeconds"`
+			Text            string  `json:"text"`
+		}{notification, notification.Duration.Seconds(), text}
+
+	default:
+		return "", "", nil, errors.Errorf("Unsupported notification sink type %q", sink.Type)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", nil, errors.Wrap(err, "Failed to encode notification")
+	}
+
+	return method, target, body, nil
+}
+
+// do sends a request and reports whether it may succeed if retried
+func (n *Notifier) do(ctx context.Context, httpClient *http.Client, method, target, token string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	// the URL is left out of errors, as the URL of an incoming webhook is a credential
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+
+		// an internal address stays internal
+		return !errors.Is(err, ErrInternalTarget), errors.Wrap(err, "Request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+	return retry, errors.Errorf("Request failed with %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+}
+
+// claim reports whether key was not sent within the dedup window and marks it as sent
+func (n *Notifier) claim(key string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.now()
+	for sentKey, at := range n.sent {
+		if now.Sub(at) > dedupWindow {
+			delete(n.sent, sentKey)
+		}
+	}
+
+	if _, ok := n.sent[key]; ok {
+		return false
+	}
+
+	n.sent[key] = now
+	return true
+}
+
+func (n *Notifier) release(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.sent, key)
+}
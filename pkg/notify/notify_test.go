@@ -0,0 +1,301 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// receivedRequest is a request the stand-in server received
+type receivedRequest struct {
+	method        string
+	path          string
+	authorization string
+	body          map[string]any
+}
+
+// newStandIn starts a server answering with statuses in turn, and 200 once they are used up
+func newStandIn(t *testing.T, statuses ...int) (*httptest.Server, func() []receivedRequest) {
+	mu := sync.Mutex{}
+	received := []receivedRequest{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, receivedRequest{
+			method:        r.Method,
+			path:          r.URL.EscapedPath(),
+			authorization: r.Header.Get("Authorization"),
+			body:          body,
+		})
+
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]receivedRequest{}, received...)
+	}
+}
+
+func newTestNotifier(server *httptest.Server) *Notifier {
+	notifier := NewNotifier(server.Client(), noop.NewTracerProvider().Tracer("notify_test"))
+	notifier.backoff = time.Millisecond
+
+	return notifier
+}
+
+var failed = Notification{
+	Event:     EventBuildFailed,
+	Page:      "blog",
+	Namespace: "web",
+	URL:       "https://blog.example.com/",
+	Build:     7,
+	Result:    "Failed",
+	Commit:    "0a1b2c3",
+	Duration:  83 * time.Second,
+	Logs:      "kubectl hugo logs blog -n web --build 7",
+}
+
+func TestSinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		sink   Sink
+		method string
+		path   string
+		auth   string
+		body   map[string]any
+	}{
+		{
+			name:   "slack",
+			sink:   Sink{Name: "team", Type: TypeSlack, URL: "/services/T000/B000/XXXX", Internal: true},
+			method: http.MethodPost,
+			path:   "/services/T000/B000/XXXX",
+			body: map[string]any{
+				"text": "Build #7 of web/blog failed after 1m23s at commit 0a1b2c3. Read the logs with kubectl hugo logs blog -n web --build 7",
+			},
+		},
+		{
+			name:   "matrix",
+			sink:   Sink{Name: "room", Type: TypeMatrix, URL: "/", RoomID: "!abc:example.com", Token: "secret", Template: "{{.Page}} {{.Event}}", Internal: true},
+			method: http.MethodPut,
+			path:   "/_matrix/client/v3/rooms/%21abc:example.com/send/m.room.message/",
+			auth:   "Bearer secret",
+			body:   map[string]any{"msgtype": "m.notice", "body": "blog BuildFailed"},
+		},
+		{
+			name:   "webhook",
+			sink:   Sink{Name: "hook", Type: TypeWebhook, URL: "/hook", Template: "{{.Page}} failed", Internal: true},
+			method: http.MethodPost,
+			path:   "/hook",
+			body: map[string]any{
+				"event":           "BuildFailed",
+				"page":            "blog",
+				"namespace":       "web",
+				"url":             "https://blog.example.com/",
+				"build":           float64(7),
+				"result":          "Failed",
+				"commit":          "0a1b2c3",
+				"logs":            "kubectl hugo logs blog -n web --build 7",
+				"durationSeconds": float64(83),
+				"text":            "blog failed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newStandIn(t)
+			tt.sink.URL = server.URL + tt.sink.URL
+
+			if err := newTestNotifier(server).Send(context.Background(), tt.sink, failed); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := received()
+			if len(requests) != 1 {
+				t.Fatalf("want 1 request, got %d", len(requests))
+			}
+
+			request := requests[0]
+			if request.method != tt.method || !strings.HasPrefix(request.path, tt.path) || request.authorization != tt.auth {
+				t.Errorf("want %s %s with authorization %q, got %s %s with %q", tt.method, tt.path, tt.auth, request.method, request.path, request.authorization)
+			}
+
+			for key, want := range tt.body {
+				if request.body[key] != want {
+					t.Errorf("want %s %v, got %v", key, want, request.body[key])
+				}
+			}
+
+			if len(request.body) != len(tt.body) {
+				t.Errorf("want body %v, got %v", tt.body, request.body)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		fails    bool
+	}{
+		{name: "recovers from server errors", statuses: []int{http.StatusBadGateway, http.StatusTooManyRequests}, requests: 3},
+		{name: "gives up after three attempts", statuses: []int{500, 500, 500, 500}, requests: 3, fails: true},
+		{name: "does not retry client errors", statuses: []int{http.StatusNotFound}, requests: 1, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newStandIn(t, tt.statuses...)
+			sink := Sink{Name: "team", Type: TypeSlack, URL: server.URL + "/secret-path", Internal: true}
+
+			err := newTestNotifier(server).Send(context.Background(), sink, failed)
+			if (err != nil) != tt.fails {
+				t.Fatalf("want failure %v, got %v", tt.fails, err)
+			}
+
+			if err != nil && strings.Contains(err.Error(), "secret-path") {
+				t.Errorf("error %q reveals the webhook URL", err)
+			}
+
+			if got := len(received()); got != tt.requests {
+				t.Errorf("want %d requests, got %d", tt.requests, got)
+			}
+		})
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	server, received := newStandIn(t, http.StatusNotFound)
+	notifier := newTestNotifier(server)
+	sink := Sink{Name: "team", Type: TypeSlack, URL: server.URL, Internal: true}
+
+	// an undelivered notification is not remembered
+	if err := notifier.Send(context.Background(), sink, failed); err == nil {
+		t.Fatal("want first delivery to fail")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := notifier.Send(context.Background(), sink, failed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := failed
+	next.Build++
+	if err := notifier.Send(context.Background(), sink, next); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(received()); got != 3 {
+		t.Errorf("want the failed request and one request per build, got %d requests", got)
+	}
+
+	// duplicates are dropped within the dedup window only
+	notifier.now = func() time.Time { return time.Now().Add(2 * dedupWindow) }
+	if err := notifier.Send(context.Background(), sink, next); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(received()); got != 4 {
+		t.Errorf("want notification sent again after the dedup window, got %d requests", got)
+	}
+}
+
+func TestRenderInvalidTemplate(t *testing.T) {
+	if _, err := Render("{{.Branch}}", failed); err == nil {
+		t.Error("want error for a template using an unknown field")
+	}
+}
+
+func TestInternalTargets(t *testing.T) {
+	server, received := newStandIn(t)
+
+	// the stand-in listens on a loopback address, like a service of the cluster would be reached
+	sink := Sink{Name: "hook", Type: TypeWebhook, URL: server.URL}
+	err := newTestNotifier(server).Send(context.Background(), sink, failed)
+	if !errors.Is(err, ErrInternalTarget) {
+		t.Fatalf("want the internal sink refused, got %v", err)
+	}
+
+	if got := len(received()); got != 0 {
+		t.Errorf("want no request to the internal sink, got %d", got)
+	}
+
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"::1":             true,
+		"169.254.169.254": true,
+		"fe80::1":         true,
+		"10.96.0.1":       true,
+		"172.16.5.4":      true,
+		"192.168.1.1":     true,
+		"100.64.0.10":     true,
+		"fd00::1":         true,
+		"0.0.0.0":         true,
+		"1.1.1.1":         false,
+		"2606:4700::1111": false,
+	}
+
+	for address, want := range tests {
+		if got := internalAddress(net.ParseIP(address)); got != want {
+			t.Errorf("internalAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestRenderLogURL(t *testing.T) {
+	notification := failed
+	notification.LogURL = "https://logs.example.com/web/blog/7"
+
+	text, err := Render("", notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "Build #7 of web/blog failed after 1m23s at commit 0a1b2c3. Logs: https://logs.example.com/web/blog/7"; text != want {
+		t.Errorf("want %q, got %q", want, text)
+	}
+}
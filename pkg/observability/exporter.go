@@ -0,0 +1,163 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter selects where traces and metrics are exported to
+type Exporter string
+
+const (
+	ExporterOTLPHTTP Exporter = "otlp-http"
+	ExporterOTLPGRPC Exporter = "otlp-grpc"
+	ExporterStdout   Exporter = "stdout"
+	ExporterNone     Exporter = "none"
+)
+
+// ParseExporter parses the name of an exporter. An empty name selects the exporter from the OTEL_* environment
+func ParseExporter(name string) (Exporter, error) {
+	switch exporter := Exporter(strings.ToLower(name)); exporter {
+	case ExporterOTLPHTTP, ExporterOTLPGRPC, ExporterStdout, ExporterNone:
+		return exporter, nil
+
+	case "":
+		return exporterFromEnv(), nil
+
+	default:
+		return "", fmt.Errorf("unknown exporter %q, must be one of otlp-http, otlp-grpc, stdout or none", name)
+	}
+}
+
+// exporterFromEnv selects the exporter from OTEL_TRACES_EXPORTER and OTEL_EXPORTER_OTLP_PROTOCOL.
+// Without either of them or an OTLP endpoint nothing is exported, so the controller starts without a collector
+func exporterFromEnv() Exporter {
+	switch strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")) {
+	case "none":
+		return ExporterNone
+
+	case "console", "stdout":
+		return ExporterStdout
+
+	case "otlp":
+		return otlpExporterFromEnv()
+	}
+
+	for _, variable := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTLP_ENDPOINT"} {
+		if os.Getenv(variable) != "" {
+			return otlpExporterFromEnv()
+		}
+	}
+
+	return ExporterNone
+}
+
+// otlpExporterFromEnv selects the OTLP exporter of the protocol in the environment, which defaults to HTTP
+func otlpExporterFromEnv() Exporter {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	if protocol == "grpc" {
+		return ExporterOTLPGRPC
+	}
+
+	return ExporterOTLPHTTP
+}
+
+// legacyEndpoint returns the collector configured by OTLP_ENDPOINT and OTLP_INSECURE, unless the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT is set
+func legacyEndpoint() (string, bool, bool) {
+	endpoint, ok := os.LookupEnv("OTLP_ENDPOINT")
+	if !ok || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		return "", false, false
+	}
+
+	return endpoint, strings.ToLower(os.Getenv("OTLP_INSECURE")) == "true", true
+}
+
+// newSpanExporter creates the span exporter of exporter. The OTLP exporters read the OTEL_EXPORTER_OTLP_* environment
+func newSpanExporter(ctx context.Context, exporter Exporter) (sdkTrace.SpanExporter, error) {
+	endpoint, insecure, legacy := legacyEndpoint()
+
+	switch exporter {
+	case ExporterOTLPHTTP:
+		options := []otlptracehttp.Option{}
+		if legacy {
+			options = append(options, otlptracehttp.WithEndpoint(endpoint))
+			if insecure {
+				options = append(options, otlptracehttp.WithInsecure())
+			}
+		}
+
+		return otlptracehttp.New(ctx, options...)
+
+	case ExporterOTLPGRPC:
+		options := []otlptracegrpc.Option{}
+		if legacy {
+			options = append(options, otlptracegrpc.WithEndpoint(endpoint))
+			if insecure {
+				options = append(options, otlptracegrpc.WithInsecure())
+			}
+		}
+
+		return otlptracegrpc.New(ctx, options...)
+
+	case ExporterStdout:
+		return stdouttrace.New()
+
+	default:
+		return nil, nil
+	}
+}
+
+// newMetricExporter creates the metric exporter of exporter. OTEL_METRICS_EXPORTER=none turns off exporting metrics only
+func newMetricExporter(ctx context.Context, exporter Exporter) (sdkMetric.Exporter, error) {
+	if strings.ToLower(os.Getenv("OTEL_METRICS_EXPORTER")) == "none" {
+		return nil, nil
+	}
+
+	endpoint, insecure, legacy := legacyEndpoint()
+
+	switch exporter {
+	case ExporterOTLPHTTP:
+		options := []otlpmetrichttp.Option{}
+		if legacy {
+			options = append(options, otlpmetrichttp.WithEndpoint(endpoint))
+			if insecure {
+				options = append(options, otlpmetrichttp.WithInsecure())
+			}
+		}
+
+		return otlpmetrichttp.New(ctx, options...)
+
+	case ExporterOTLPGRPC:
+		options := []otlpmetricgrpc.Option{}
+		if legacy {
+			options = append(options, otlpmetricgrpc.WithEndpoint(endpoint))
+			if insecure {
+				options = append(options, otlpmetricgrpc.WithInsecure())
+			}
+		}
+
+		return otlpmetricgrpc.New(ctx, options...)
+
+	case ExporterStdout:
+		return stdoutmetric.New()
+
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,96 @@
+package observability
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseExporter(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		env     map[string]string
+		want    Exporter
+		wantErr bool
+	}{
+		{name: "nothing configured", want: ExporterNone},
+		{name: "flag", flag: "otlp-grpc", env: map[string]string{"OTEL_TRACES_EXPORTER": "none"}, want: ExporterOTLPGRPC},
+		{name: "unknown flag", flag: "jaeger", wantErr: true},
+		{name: "endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, want: ExporterOTLPHTTP},
+		{name: "grpc endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, want: ExporterOTLPGRPC},
+		{name: "legacy endpoint", env: map[string]string{"OTLP_ENDPOINT": "collector:4318"}, want: ExporterOTLPHTTP},
+		{name: "otlp defaults to http", env: map[string]string{"OTEL_TRACES_EXPORTER": "otlp"}, want: ExporterOTLPHTTP},
+		{name: "console", env: map[string]string{"OTEL_TRACES_EXPORTER": "console"}, want: ExporterStdout},
+		{name: "disabled with endpoint", env: map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, want: ExporterNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, variable := range []string{"OTEL_TRACES_EXPORTER", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTLP_ENDPOINT"} {
+				t.Setenv(variable, tt.env[variable])
+			}
+
+			got, err := ParseExporter(tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want exporter %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuilderEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTLP_ENDPOINT", "collector:4318")
+	t.Setenv("OTLP_INSECURE", "true")
+
+	telemetry := &Telemetry{config: TelemetryConfig{ServiceName: "hugo-hoster", Exporter: ExporterOTLPHTTP}}
+	env := telemetry.BuilderEnv()
+
+	if env["OTEL_EXPORTER_OTLP_ENDPOINT"] != "http://collector:4318" || env["OTEL_EXPORTER_OTLP_PROTOCOL"] != "http/protobuf" {
+		t.Errorf("want builders exporting to the collector of the controller, got %v", env)
+	}
+
+	telemetry.config.Exporter = ExporterStdout
+	if env := telemetry.BuilderEnv(); env != nil {
+		t.Errorf("want no builder environment without an OTLP exporter, got %v", env)
+	}
+}
+
+func TestInitTelemetryWithoutCollector(t *testing.T) {
+	for _, exporter := range []Exporter{ExporterNone, ExporterOTLPHTTP, ExporterOTLPGRPC} {
+		t.Run(string(exporter), func(t *testing.T) {
+			// nothing listens on the endpoint, which must not keep the controller from starting
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+			t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "100")
+
+			telemetry, err := InitTelemetry(context.Background(), TelemetryConfig{
+				ServiceName: "hugo-hoster",
+				Exporter:    exporter,
+				SampleRatio: 0.5,
+				Gatherer:    prometheus.NewRegistry(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, span := telemetry.Tracer.Start(context.Background(), "test")
+			span.End()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// the final export fails without a collector, but returns in time
+			_ = telemetry.Shutdown(ctx)
+			if ctx.Err() != nil {
+				t.Error("want shutdown without a collector to return before its deadline")
+			}
+		})
+	}
+}
@@ -4,15 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/MrAlias/flow"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	prometheusBridge "go.opentelemetry.io/contrib/bridges/prometheus"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
@@ -20,67 +20,152 @@ import (
 	"go.uber.org/zap"
 )
 
-func InitTracer(serviceName, serviceVersion string) (*sdkTrace.TracerProvider, trace.Tracer, error) {
-	otlpEndpoint, ok := os.LookupEnv("OTLP_ENDPOINT")
-	otlpInsecure := os.Getenv("OTLP_INSECURE")
+// TelemetryConfig configures the export of traces and metrics
+type TelemetryConfig struct {
+	ServiceName    string
+	ServiceVersion string
 
-	otlpOptions := make([]otlptracehttp.Option, 0)
+	// Exporter of the traces and metrics
+	Exporter Exporter
 
-	if ok {
-		otlpOptions = append(otlpOptions, otlptracehttp.WithEndpoint(otlpEndpoint))
+	// SampleRatio is the ratio of traces sampled that do not continue a trace of a parent.
+	// A negative ratio leaves the sampler to OTEL_TRACES_SAMPLER, which samples every trace by default
+	SampleRatio float64
 
-		if strings.ToLower(otlpInsecure) == "true" {
-			otlpOptions = append(otlpOptions, otlptracehttp.WithInsecure())
-		}
-	} else {
-		otlpOptions = append(otlpOptions, otlptracehttp.WithEndpoint("localhost:4318"))
-		otlpOptions = append(otlpOptions, otlptracehttp.WithInsecure())
-	}
+	// Gatherer holds the Prometheus metrics that are exported next to being served for scraping
+	Gatherer prometheus.Gatherer
+}
 
-	client := otlptracehttp.NewClient(otlpOptions...)
+// Telemetry exports the traces and metrics of the controller
+type Telemetry struct {
+	Tracer trace.Tracer
 
-	otlptracehttpExporter, err := otlptrace.New(context.Background(), client)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed creating OTLP trace exporter")
-	}
+	config         TelemetryConfig
+	tracerProvider *sdkTrace.TracerProvider
+	meterProvider  *sdkMetric.MeterProvider
+}
 
+// InitTelemetry sets up the global tracer and meter providers. Exporting to a collector that is not running
+// does not fail, the exporters retry in the background
+func InitTelemetry(ctx context.Context, config TelemetryConfig) (*Telemetry, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	resources, err := resource.New(
-		context.Background(),
-		resource.WithFromEnv(),   // pull attributes from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME environment variables
+		ctx,
 		resource.WithOS(),        // This option configures a set of Detectors that discover OS information
 		resource.WithContainer(), // This option configures a set of Detectors that discover container information
 		resource.WithHost(),      // This option configures a set of Detectors that discover host information
 		resource.WithAttributes(
-			semconv.ServiceNameKey.String(serviceName),
-			semconv.ServiceVersionKey.String(serviceVersion),
+			semconv.ServiceNameKey.String(config.ServiceName),
+			semconv.ServiceVersionKey.String(config.ServiceVersion),
 			semconv.ServiceInstanceIDKey.String(hostname),
 		),
+		resource.WithFromEnv(), // pull attributes from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME environment variables, which take precedence
 	)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to build resources")
+		return nil, errors.Wrap(err, "failed to build resources")
 	}
 
-	traceProvider := sdkTrace.NewTracerProvider(
-		flow.WithBatcher(otlptracehttpExporter),
-		sdkTrace.WithSampler(sdkTrace.AlwaysSample()),
-		sdkTrace.WithResource(resources),
-	)
+	traceOptions := []sdkTrace.TracerProviderOption{sdkTrace.WithResource(resources)}
+	if config.SampleRatio >= 0 {
+		traceOptions = append(traceOptions, sdkTrace.WithSampler(sdkTrace.ParentBased(sdkTrace.TraceIDRatioBased(config.SampleRatio))))
+	}
+
+	spanExporter, err := newSpanExporter(ctx, config.Exporter)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating %s trace exporter", config.Exporter)
+	}
+
+	if spanExporter != nil {
+		traceOptions = append(traceOptions, flow.WithBatcher(spanExporter))
+	}
+
+	metricOptions := []sdkMetric.Option{sdkMetric.WithResource(resources)}
+
+	metricExporter, err := newMetricExporter(ctx, config.Exporter)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating %s metric exporter", config.Exporter)
+	}
+
+	if metricExporter != nil {
+		readerOptions := []sdkMetric.PeriodicReaderOption{}
+		if config.Gatherer != nil {
+			readerOptions = append(readerOptions, sdkMetric.WithProducer(prometheusBridge.NewMetricProducer(prometheusBridge.WithGatherer(config.Gatherer))))
+		}
+
+		metricOptions = append(metricOptions, sdkMetric.WithReader(sdkMetric.NewPeriodicReader(metricExporter, readerOptions...)))
+	}
 
-	trace := traceProvider.Tracer(
-		serviceName,
-		trace.WithInstrumentationVersion(serviceVersion),
+	telemetry := &Telemetry{
+		config:         config,
+		tracerProvider: sdkTrace.NewTracerProvider(traceOptions...),
+		meterProvider:  sdkMetric.NewMeterProvider(metricOptions...),
+	}
+
+	telemetry.Tracer = telemetry.tracerProvider.Tracer(
+		config.ServiceName,
+		trace.WithInstrumentationVersion(config.ServiceVersion),
 		trace.WithSchemaURL(semconv.SchemaURL),
 	)
 
-	otel.SetTracerProvider(traceProvider)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTracerProvider(telemetry.tracerProvider)
+	otel.SetMeterProvider(telemetry.meterProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return telemetry, nil
+}
+
+// Shutdown exports the remaining traces and metrics and stops exporting
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	if err := t.tracerProvider.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "failed shutting down tracer provider")
+	}
+
+	if err := t.meterProvider.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "failed shutting down meter provider")
+	}
+
+	return nil
+}
+
+// BuilderEnv returns the environment pointing the OpenTelemetry SDK of the builders at the collector the controller exports to.
+// It is empty unless the controller exports to an explicitly configured OTLP endpoint, as the default collector on
+// localhost is not reachable from the builder pods
+func (t *Telemetry) BuilderEnv() map[string]string {
+	protocol := ""
+	switch t.config.Exporter {
+	case ExporterOTLPHTTP:
+		protocol = "http/protobuf"
 
-	return traceProvider, trace, nil
+	case ExporterOTLPGRPC:
+		protocol = "grpc"
+
+	default:
+		return nil
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if legacy, insecure, ok := legacyEndpoint(); ok {
+		scheme := "https"
+		if insecure {
+			scheme = "http"
+		}
+
+		endpoint = scheme + "://" + legacy
+	}
+
+	if endpoint == "" {
+		return nil
+	}
+
+	return map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": endpoint,
+		"OTEL_EXPORTER_OTLP_PROTOCOL": protocol,
+		"OTEL_SERVICE_NAME":           t.config.ServiceName + "-builder",
+	}
 }
 
 func InitLogging(debug bool) (*otelzap.Logger, func()) {
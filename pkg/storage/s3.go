@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// writeCheckObject is the object written and removed again to check that a bucket is writable
+const writeCheckObject = ".hugo-hoster/write-check"
+
+// S3Config holds everything needed to connect to an S3 bucket
+type S3Config struct {
+	Endpoint        string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// CheckResult is the outcome of checking an S3 bucket. A nil error means the check passed
+type CheckResult struct {
+	Reachable error
+	Writable  error
+}
+
+// Checker checks that an S3 bucket can be used to host pages
+type Checker interface {
+	Check(ctx context.Context, config S3Config) CheckResult
+}
+
+// S3Checker checks S3 buckets using the S3 API
+type S3Checker struct {
+	tracer trace.Tracer
+}
+
+// NewS3Checker creates a new S3Checker
+func NewS3Checker(tracer trace.Tracer) *S3Checker {
+	return &S3Checker{
+		tracer: tracer,
+	}
+}
+
+// Check verifies the bucket exists with a HEAD request and is writable by uploading and removing a test object
+func (c *S3Checker) Check(ct context.Context, config S3Config) CheckResult {
+	ctx, span := c.tracer.Start(ct, "S3Checker.Check", trace.WithAttributes(attribute.String("endpoint", config.Endpoint), attribute.String("bucket", config.Bucket)))
+	defer span.End()
+
+	s3Client, err := newS3Client(config)
+	if err != nil {
+		span.RecordError(err)
+		return CheckResult{Reachable: err, Writable: err}
+	}
+
+	exists, err := s3Client.BucketExists(ctx, config.Bucket)
+	if err == nil && !exists {
+		err = errors.Errorf("Bucket %s does not exist", config.Bucket)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		err = errors.Wrapf(err, "Failed to reach bucket %s", config.Bucket)
+		return CheckResult{Reachable: err, Writable: err}
+	}
+
+	content := []byte("hugo-hoster")
+	if _, err := s3Client.PutObject(ctx, config.Bucket, writeCheckObject, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{}); err != nil {
+		span.RecordError(err)
+		return CheckResult{Writable: errors.Wrapf(err, "Failed to write to bucket %s", config.Bucket)}
+	}
+
+	if err := s3Client.RemoveObject(ctx, config.Bucket, writeCheckObject, minio.RemoveObjectOptions{}); err != nil {
+		span.RecordError(err)
+		return CheckResult{Writable: errors.Wrapf(err, "Failed to remove test object from bucket %s", config.Bucket)}
+	}
+
+	return CheckResult{}
+}
+
+// newS3Client creates a client for the endpoint, which may either be a URL or a host
+func newS3Client(config S3Config) (*minio.Client, error) {
+	host := config.Endpoint
+	secure := true
+
+	if endpoint, err := url.Parse(config.Endpoint); err == nil && endpoint.Host != "" {
+		host = endpoint.Host
+		secure = endpoint.Scheme != "http"
+	}
+
+	s3Client, err := minio.New(host, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: secure,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create S3 client for %s", config.Endpoint)
+	}
+
+	return s3Client, nil
+}
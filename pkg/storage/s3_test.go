@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// fakeS3 serves the requests of a check against a single bucket
+type fakeS3 struct {
+	bucket   string
+	readOnly bool
+
+	mu      sync.Mutex
+	objects map[string]string
+	written []string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`)
+		return
+	}
+
+	switch {
+	case r.URL.Query().Has("location"):
+		_, _ = io.WriteString(w, `<LocationConstraint>us-east-1</LocationConstraint>`)
+
+	case object == "":
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPut && s.readOnly:
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+
+	case r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		s.objects[object] = string(content)
+		s.written = append(s.written, object)
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodDelete:
+		delete(s.objects, object)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3CheckerCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		bucket        string
+		readOnly      bool
+		wantReachable bool
+		wantWritable  bool
+	}{
+		{name: "writable bucket", bucket: "pages", wantReachable: true, wantWritable: true},
+		{name: "read-only bucket", bucket: "pages", readOnly: true, wantReachable: true},
+		{name: "missing bucket", bucket: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3 := &fakeS3{bucket: "pages", readOnly: tt.readOnly, objects: map[string]string{}}
+			server := httptest.NewServer(s3)
+			defer server.Close()
+
+			checker := NewS3Checker(noop.NewTracerProvider().Tracer("s3_test"))
+			result := checker.Check(context.Background(), S3Config{
+				Endpoint:        server.URL,
+				Bucket:          tt.bucket,
+				AccessKeyID:     "id",
+				SecretAccessKey: "key",
+			})
+
+			if (result.Reachable == nil) != tt.wantReachable {
+				t.Errorf("want reachable %t, got %v", tt.wantReachable, result.Reachable)
+			}
+
+			if (result.Writable == nil) != tt.wantWritable {
+				t.Errorf("want writable %t, got %v", tt.wantWritable, result.Writable)
+			}
+
+			s3.mu.Lock()
+			defer s3.mu.Unlock()
+
+			if tt.wantWritable && (len(s3.written) != 1 || s3.written[0] != writeCheckObject) {
+				t.Errorf("want the test object written, got %v", s3.written)
+			}
+
+			if len(s3.objects) != 0 {
+				t.Errorf("want the test object removed, got %v", s3.objects)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Syncer copies the published files of a page between prefixes of a bucket
+type Syncer interface {
+	// Sync makes the objects under the destination prefix a copy of the objects under the source prefix
+	Sync(ctx context.Context, config S3Config, source, destination string) error
+}
+
+// S3Syncer syncs prefixes with server-side copies of the S3 API
+type S3Syncer struct {
+	tracer trace.Tracer
+}
+
+// NewS3Syncer creates a new S3Syncer
+func NewS3Syncer(tracer trace.Tracer) *S3Syncer {
+	return &S3Syncer{
+		tracer: tracer,
+	}
+}
+
+// Sync copies every object under source to destination and removes the objects under destination that are not under source
+func (s *S3Syncer) Sync(ct context.Context, config S3Config, source, destination string) error {
+	ctx, span := s.tracer.Start(ct, "S3Syncer.Sync", trace.WithAttributes(
+		attribute.String("bucket", config.Bucket),
+		attribute.String("source", source),
+		attribute.String("destination", destination),
+	))
+	defer span.End()
+
+	source = strings.TrimSuffix(source, "/") + "/"
+	destination = strings.TrimSuffix(destination, "/") + "/"
+
+	s3Client, err := newS3Client(config)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	copied := map[string]bool{}
+	for object := range s3Client.ListObjects(ctx, config.Bucket, minio.ListObjectsOptions{Prefix: source, Recursive: true}) {
+		if object.Err != nil {
+			span.RecordError(object.Err)
+			return errors.Wrapf(object.Err, "Failed to list objects under %s", source)
+		}
+
+		key := strings.TrimPrefix(object.Key, source)
+		if _, err := s3Client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: config.Bucket, Object: destination + key},
+			minio.CopySrcOptions{Bucket: config.Bucket, Object: object.Key},
+		); err != nil {
+			span.RecordError(err)
+			return errors.Wrapf(err, "Failed to copy %s to %s", object.Key, destination+key)
+		}
+
+		copied[key] = true
+	}
+
+	if len(copied) == 0 {
+		err := errors.Errorf("No objects under %s to copy", source)
+		span.RecordError(err)
+		return err
+	}
+
+	for object := range s3Client.ListObjects(ctx, config.Bucket, minio.ListObjectsOptions{Prefix: destination, Recursive: true}) {
+		if object.Err != nil {
+			span.RecordError(object.Err)
+			return errors.Wrapf(object.Err, "Failed to list objects under %s", destination)
+		}
+
+		if copied[strings.TrimPrefix(object.Key, destination)] {
+			continue
+		}
+
+		if err := s3Client.RemoveObject(ctx, config.Bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			span.RecordError(err)
+			return errors.Wrapf(err, "Failed to remove %s", object.Key)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("objects", len(copied)))
+	return nil
+}